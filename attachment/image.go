@@ -0,0 +1,432 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+// Package attachment provides helpers for preparing message attachments for
+// transfer over low bandwidth links.
+package attachment
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"net/http"
+	"path"
+	"strings"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// ErrNotImage is returned by ShrinkImage if the given file is not a supported image.
+var ErrNotImage = errors.New("not a supported image")
+
+// ErrBudgetExceeded is returned by ShrinkImage if the image could not be re-encoded within the byte budget.
+var ErrBudgetExceeded = errors.New("unable to fit image within byte budget")
+
+// Options controls how images are re-encoded.
+type Options struct {
+	// MaxBytes is the target size (in bytes) of the re-encoded image.
+	MaxBytes int
+
+	// MaxDimension is the maximum width and height (in pixels) of the re-encoded image.
+	//
+	// Zero implies no limit other than what's required to fit within MaxBytes.
+	MaxDimension int
+
+	// MinQuality is the lowest JPEG quality [1,100] tried before the image is scaled down further.
+	//
+	// Defaults to DefaultMinQuality.
+	MinQuality int
+
+	// MinDimension is the smallest width or height (in pixels) the image will be scaled down to.
+	//
+	// Defaults to DefaultMinDimension.
+	MinDimension int
+}
+
+const (
+	DefaultMinQuality   = 30
+	DefaultMinDimension = 64
+
+	maxQuality = 85
+)
+
+// Result describes the outcome of ShrinkImage.
+type Result struct {
+	File *fbb.File // The (possibly) re-encoded file.
+
+	OriginalSize int // Size of the original file in bytes.
+	FinalSize    int // Size of the resulting file in bytes.
+
+	Width, Height int  // Dimensions of the resulting image.
+	Quality       int  // The JPEG quality used, zero if the original image data was kept.
+	Stripped      bool // Metadata was removed from the original JPEG without re-encoding.
+}
+
+// Changed reports whether the file was re-encoded or stripped of metadata.
+func (r Result) Changed() bool { return r.Quality > 0 || r.Stripped }
+
+// IsImage reports whether the attachment is an image format supported by ShrinkImage (JPEG, PNG or GIF).
+func IsImage(f *fbb.File) bool {
+	data := f.Data()
+	switch http.DetectContentType(data) {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return false
+	}
+	_, _, err := image.DecodeConfig(bytes.NewReader(data))
+	return err == nil
+}
+
+// ShrinkImage re-encodes the given image attachment as JPEG within the byte budget given by opts.
+//
+// The image is first encoded at decreasing quality until it fits within
+// opts.MaxBytes. If the lowest quality (opts.MinQuality) does not fit, the
+// image is scaled down and the search is repeated.
+//
+// Re-encoding drops all metadata (EXIF, comments, color profiles), and any
+// transparency is flattened onto a white background. The file name extension
+// is changed to .jpg. The EXIF orientation of a JPEG is applied to the pixels
+// before re-encoding, so that the image is displayed the same way without it.
+//
+// If the original file is already a JPEG within budget and no larger than
+// opts.MaxDimension, the image data is kept as is, but the metadata segments
+// (EXIF including GPS position, XMP, comments, color profiles etc.) are
+// removed losslessly. This is not done if the EXIF orientation requires the
+// image to be rotated or flipped, in which case the image is re-encoded.
+//
+// Other images within budget and opts.MaxDimension are returned unchanged if
+// re-encoding them as JPEG would not make them smaller.
+func ShrinkImage(f *fbb.File, opts Options) (Result, error) {
+	res := Result{File: f, OriginalSize: f.Size(), FinalSize: f.Size()}
+	if opts.MaxBytes <= 0 {
+		return res, errors.New("invalid byte budget")
+	}
+	if opts.MinQuality <= 0 || opts.MinQuality > maxQuality {
+		opts.MinQuality = DefaultMinQuality
+	}
+	if opts.MinDimension <= 0 {
+		opts.MinDimension = DefaultMinDimension
+	}
+
+	if !IsImage(f) {
+		return res, ErrNotImage
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(f.Data()))
+	if err != nil {
+		return res, err
+	}
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(f.Data())
+	}
+	if orientation > 1 {
+		img = orient(img, orientation)
+	}
+	bounds := img.Bounds()
+	res.Width, res.Height = bounds.Dx(), bounds.Dy()
+
+	fitsDimension := opts.MaxDimension <= 0 || (res.Width <= opts.MaxDimension && res.Height <= opts.MaxDimension)
+	fitsBudget := f.Size() <= opts.MaxBytes && fitsDimension
+	if format == "jpeg" && fitsBudget && orientation <= 1 {
+		if data, err := stripJPEGMetadata(f.Data()); err == nil {
+			if len(data) < f.Size() {
+				res.File = fbb.NewFile(f.Name(), data)
+				res.FinalSize = len(data)
+				res.Stripped = true
+			}
+			return res, nil
+		}
+		// Unable to parse the segments, fall back to re-encoding.
+	}
+
+	if o, ok := img.(interface{ Opaque() bool }); !ok || !o.Opaque() {
+		img = flatten(img)
+	}
+
+	if !fitsDimension {
+		img = scale(img, opts.MaxDimension)
+	}
+
+	// Keep other formats within budget unless re-encoding makes them smaller.
+	keepOriginal := format != "jpeg" && fitsBudget
+
+	for {
+		data, quality, ok := encodeWithin(img, opts.MinQuality, opts.MaxBytes)
+		if keepOriginal && (!ok || len(data) >= f.Size()) {
+			return res, nil
+		}
+		if ok {
+			b := img.Bounds()
+			res.File = fbb.NewFile(jpegName(f.Name()), data)
+			res.FinalSize = len(data)
+			res.Width, res.Height = b.Dx(), b.Dy()
+			res.Quality = quality
+			return res, nil
+		}
+
+		// Scale down by 25% and try again
+		b := img.Bounds()
+		next := max(b.Dx(), b.Dy()) * 3 / 4
+		if next < opts.MinDimension {
+			return res, ErrBudgetExceeded
+		}
+		img = scale(img, next)
+	}
+}
+
+// ShrinkFiles applies ShrinkImage to every image in files.
+//
+// Non-image files are passed through unchanged. The returned slice has one
+// Result per file, in the same order, and can be used to build a new message
+// with Message.AddFile.
+func ShrinkFiles(files []*fbb.File, opts Options) ([]Result, error) {
+	results := make([]Result, len(files))
+	for i, f := range files {
+		res, err := ShrinkImage(f, opts)
+		switch {
+		case err == ErrNotImage:
+			res = Result{File: f, OriginalSize: f.Size(), FinalSize: f.Size()}
+		case err != nil:
+			return nil, fmt.Errorf("%s: %w", f.Name(), err)
+		}
+		results[i] = res
+	}
+	return results, nil
+}
+
+// encodeWithin does a binary search for the highest JPEG quality that fits within maxBytes.
+func encodeWithin(img image.Image, minQuality, maxBytes int) (data []byte, quality int, ok bool) {
+	lo, hi := minQuality, maxQuality
+	for lo <= hi {
+		q := (lo + hi) / 2
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: q}); err != nil {
+			return nil, 0, false
+		}
+
+		if buf.Len() <= maxBytes {
+			data, quality, ok = buf.Bytes(), q, true
+			lo = q + 1
+		} else {
+			hi = q - 1
+		}
+	}
+	return data, quality, ok
+}
+
+// scale returns a copy of img scaled (by area averaging) so that neither side exceeds maxSide.
+func scale(img image.Image, maxSide int) image.Image {
+	src := flatten(img)
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	if sw <= maxSide && sh <= maxSide {
+		return src
+	}
+
+	dw, dh := maxSide, maxSide
+	if sw > sh {
+		dh = max(1, sh*maxSide/sw)
+	} else {
+		dw = max(1, sw*maxSide/sh)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				off := src.PixOffset(sb.Min.X+x0, sb.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[off+0])
+					g += uint32(src.Pix[off+1])
+					b += uint32(src.Pix[off+2])
+					a += uint32(src.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), uint8(a / n)})
+		}
+	}
+	return dst
+}
+
+// flatten converts img to *image.RGBA, flattening any transparency onto a white background.
+func flatten(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Opaque() {
+		return rgba
+	}
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Over)
+	return dst
+}
+
+// stripJPEGMetadata returns the JPEG data without application (APP1-APP15) and comment segments.
+//
+// The JFIF header (APP0), the Adobe segment (APP14, which tells how the color
+// components are transformed) and all segments needed to decode the image are
+// kept. The entropy coded data following the start of scan is copied as is.
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xFF, 0xD8) // SOI
+	scan, err := walkJPEG(data, func(marker byte, segment []byte) {
+		switch {
+		case marker == 0xEE: // APP14 (Adobe)
+		case marker >= 0xE1 && marker <= 0xEF, marker == 0xFE: // APPn (except JFIF) and COM
+			return
+		}
+		out = append(out, segment...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(out, data[scan:]...), nil
+}
+
+// walkJPEG calls fn with each marker segment (including the marker) preceding the start of scan.
+//
+// It returns the offset of the start of scan marker.
+func walkJPEG(data []byte, fn func(marker byte, segment []byte)) (int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, errors.New("missing JPEG SOI marker")
+	}
+	for i := 2; ; {
+		// Markers may be preceded by any number of 0xFF fill bytes
+		for i < len(data) && data[i] == 0xFF && i+1 < len(data) && data[i+1] == 0xFF {
+			i++
+		}
+		if i+4 > len(data) || data[i] != 0xFF {
+			return 0, errors.New("invalid JPEG segment")
+		}
+		marker := data[i+1]
+		if marker == 0xDA { // Start of scan, the rest is image data
+			return i, nil
+		}
+		length := int(data[i+2])<<8 | int(data[i+3])
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return 0, errors.New("truncated JPEG segment")
+		}
+		fn(marker, data[i:end])
+		i = end
+	}
+}
+
+// jpegOrientation returns the EXIF orientation [1,8] of the JPEG data.
+//
+// 1 (no transformation) is returned if the orientation is missing or invalid.
+func jpegOrientation(data []byte) int {
+	orientation := 1
+	walkJPEG(data, func(marker byte, segment []byte) {
+		const header = "Exif\x00\x00"
+		if marker != 0xE1 || len(segment) < 4+len(header) || string(segment[4:4+len(header)]) != header {
+			return
+		}
+		if o := exifOrientation(segment[4+len(header):]); o >= 1 && o <= 8 {
+			orientation = o
+		}
+	})
+	return orientation
+}
+
+// exifOrientation returns the orientation tag of the first IFD of the EXIF (TIFF) data, or zero if not found.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		const tagOrientation, typeShort = 0x0112, 3
+		if order.Uint16(tiff[entry:]) == tagOrientation && order.Uint16(tiff[entry+2:]) == typeShort {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
+
+// orient returns a copy of img rotated and/or flipped as given by the EXIF orientation [2,8].
+func orient(img image.Image, orientation int) image.Image {
+	src := flatten(img)
+	sb := src.Bounds()
+	w, h := sb.Dx(), sb.Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 { // Rotated by 90 or 270 degrees
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // Mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // Rotated 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // Mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // Mirrored horizontally and rotated 270 CW
+				sx, sy = y, x
+			case 6: // Rotated 90 CW
+				sx, sy = y, h-1-x
+			case 7: // Mirrored horizontally and rotated 90 CW
+				sx, sy = w-1-y, h-1-x
+			case 8: // Rotated 270 CW
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			dst.SetRGBA(x, y, src.RGBAAt(sb.Min.X+sx, sb.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+func jpegName(name string) string {
+	ext := path.Ext(name)
+	switch strings.ToLower(ext) {
+	case ".jpg", ".jpeg":
+		return name
+	}
+	return strings.TrimSuffix(name, ext) + ".jpg"
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
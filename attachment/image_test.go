@@ -0,0 +1,245 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package attachment
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+func noisyPNG(t *testing.T, w, h int) []byte {
+	rnd := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(rnd.Intn(256)), uint8(x), uint8(y), 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestShrinkImage(t *testing.T) {
+	f := fbb.NewFile("photo.png", noisyPNG(t, 640, 480))
+
+	res, err := ShrinkImage(f, Options{MaxBytes: 20000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Changed() {
+		t.Fatal("expected image to be re-encoded")
+	}
+	if res.FinalSize > 20000 || res.File.Size() != res.FinalSize {
+		t.Errorf("unexpected final size %d", res.FinalSize)
+	}
+	if res.OriginalSize != f.Size() {
+		t.Errorf("unexpected original size %d", res.OriginalSize)
+	}
+	if res.File.Name() != "photo.jpg" {
+		t.Errorf("unexpected file name %q", res.File.Name())
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(res.File.Data()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || cfg.Width != res.Width || cfg.Height != res.Height {
+		t.Errorf("unexpected result: %s %dx%d", format, cfg.Width, cfg.Height)
+	}
+	if cfg.Width*3 != cfg.Height*4 {
+		t.Errorf("aspect ratio not preserved: %dx%d", cfg.Width, cfg.Height)
+	}
+}
+
+func TestShrinkImageMaxDimension(t *testing.T) {
+	f := fbb.NewFile("photo.png", noisyPNG(t, 300, 100))
+
+	res, err := ShrinkImage(f, Options{MaxBytes: 1 << 20, MaxDimension: 150})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Width != 150 || res.Height != 50 {
+		t.Errorf("unexpected dimensions %dx%d", res.Width, res.Height)
+	}
+}
+
+func TestShrinkFilesSkipsNonImages(t *testing.T) {
+	files := []*fbb.File{
+		fbb.NewFile("notes.txt", []byte("hello")),
+		fbb.NewFile("photo.png", noisyPNG(t, 64, 64)),
+	}
+	results, err := ShrinkFiles(files, Options{MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].File != files[0] || results[0].Changed() {
+		t.Error("non-image file was modified")
+	}
+	if !results[1].Changed() {
+		t.Error("png was not converted")
+	}
+}
+
+func TestShrinkImageBudgetExceeded(t *testing.T) {
+	f := fbb.NewFile("photo.png", noisyPNG(t, 128, 128))
+	if _, err := ShrinkImage(f, Options{MaxBytes: 10}); err != ErrBudgetExceeded {
+		t.Errorf("expected ErrBudgetExceeded, got %v", err)
+	}
+}
+
+func TestShrinkImageStripsEXIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 32, 32)), nil); err != nil {
+		t.Fatal(err)
+	}
+	// Insert an EXIF segment with a GPS IFD and a comment after the SOI marker
+	gps := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x88\x25GPSLatitude=59.9N")
+	app1 := append([]byte{0xFF, 0xE1, 0, byte(len(gps) + 2)}, gps...)
+	com := append([]byte{0xFF, 0xFE, 0, 9}, "LA5NTA!"...)
+	data := append(append(append([]byte{0xFF, 0xD8}, app1...), com...), buf.Bytes()[2:]...)
+
+	res, err := ShrinkImage(fbb.NewFile("photo.jpg", data), Options{MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Changed() || res.Quality != 0 {
+		t.Errorf("expected metadata to be stripped without re-encoding: %+v", res)
+	}
+	out := res.File.Data()
+	for _, s := range []string{"Exif", "GPS", "LA5NTA"} {
+		if bytes.Contains(out, []byte(s)) {
+			t.Errorf("result still contains %q", s)
+		}
+	}
+	if !bytes.Equal(out[2:], buf.Bytes()[2:]) {
+		t.Error("image data was modified")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(out)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShrinkImageFlattensAlpha(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 16)) // Fully transparent
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	// MaxDimension forces re-encoding of the (otherwise tiny) PNG
+	res, err := ShrinkImage(fbb.NewFile("logo.png", buf.Bytes()), Options{MaxBytes: 1 << 20, MaxDimension: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := jpeg.Decode(bytes.NewReader(res.File.Data()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := out.At(4, 4).RGBA(); r < 0xf000 || g < 0xf000 || b < 0xf000 {
+		t.Errorf("expected white, got %v", out.At(4, 4))
+	}
+}
+
+func TestShrinkImageKeepsSmallPNG(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64)) // Compresses far better as PNG than JPEG
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	f := fbb.NewFile("logo.png", buf.Bytes())
+
+	res, err := ShrinkImage(f, Options{MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.File != f || res.Changed() || res.FinalSize != f.Size() {
+		t.Errorf("expected original file to be kept: %+v", res)
+	}
+}
+
+func TestShrinkImageKeepsAdobeSegment(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 32, 32)), nil); err != nil {
+		t.Fatal(err)
+	}
+	adobe := append([]byte{0xFF, 0xEE, 0, 14}, "Adobe\x00\x64\x00\x00\x00\x00\x00"...)
+	com := append([]byte{0xFF, 0xFE, 0, 9}, "LA5NTA!"...)
+	data := append(append(append([]byte{0xFF, 0xD8}, adobe...), com...), buf.Bytes()[2:]...)
+
+	res, err := ShrinkImage(fbb.NewFile("photo.jpg", data), Options{MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := res.File.Data()
+	if !res.Stripped || bytes.Contains(out, []byte("LA5NTA")) {
+		t.Errorf("expected comment to be stripped: %+v", res)
+	}
+	if !bytes.Contains(out, adobe) {
+		t.Error("APP14 (Adobe) segment was removed")
+	}
+}
+
+// exifOrientationSegment returns an APP1 segment with a big endian EXIF IFD holding only the given orientation.
+func exifOrientationSegment(orientation byte) []byte {
+	exif := []byte("Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08" + // TIFF header, IFD0 at offset 8
+		"\x00\x01" + // 1 entry
+		"\x01\x12\x00\x03\x00\x00\x00\x01" + // Orientation, SHORT, count 1
+		"\x00" + string(orientation) + "\x00\x00" +
+		"\x00\x00\x00\x00") // No next IFD
+	return append([]byte{0xFF, 0xE1, 0, byte(len(exif) + 2)}, exif...)
+}
+
+func TestShrinkImageAppliesOrientation(t *testing.T) {
+	// A 32x16 image, black on the left half and white on the right half
+	img := image.NewGray(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 16; x < 32; x++ {
+			img.SetGray(x, y, color.Gray{0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+	data := append(append([]byte{0xFF, 0xD8}, exifOrientationSegment(6)...), buf.Bytes()[2:]...)
+
+	res, err := ShrinkImage(fbb.NewFile("photo.jpg", data), Options{MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Quality == 0 || res.Width != 16 || res.Height != 32 {
+		t.Fatalf("expected rotated image to be re-encoded: %+v", res)
+	}
+	out, err := jpeg.Decode(bytes.NewReader(res.File.Data()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rotated 90 degrees clockwise, the left (black) half is now on top
+	if top, _, _, _ := out.At(8, 4).RGBA(); top > 0x1000 {
+		t.Errorf("expected black top, got %v", out.At(8, 4))
+	}
+	if bottom, _, _, _ := out.At(8, 28).RGBA(); bottom < 0xf000 {
+		t.Errorf("expected white bottom, got %v", out.At(8, 28))
+	}
+	if bytes.Contains(res.File.Data(), []byte("Exif")) {
+		t.Error("result still contains EXIF")
+	}
+
+	// Normal orientation is stripped losslessly
+	data = append(append([]byte{0xFF, 0xD8}, exifOrientationSegment(1)...), buf.Bytes()[2:]...)
+	if res, err := ShrinkImage(fbb.NewFile("photo.jpg", data), Options{MaxBytes: 1 << 20}); err != nil || !res.Stripped {
+		t.Errorf("expected metadata to be stripped without re-encoding: %+v (%v)", res, err)
+	}
+}
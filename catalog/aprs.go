@@ -0,0 +1,161 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultAPRSSymbol is the APRS symbol (table and code) used by PosReport.APRS if none is given.
+const DefaultAPRSSymbol = "/-" // House
+
+var (
+	// The uncompressed APRS position format, e.g. "4903.50N/07201.75W-".
+	aprsPosRe = regexp.MustCompile(`^(\d{2})(\d{2}\.\d{2})([NS])(.)(\d{3})(\d{2}\.\d{2})([EW])(.)`)
+
+	// Course/speed data extension, e.g. "088/036".
+	aprsCSERe = regexp.MustCompile(`^(\d{3})/(\d{3})`)
+
+	// Altitude (in feet) in the comment, e.g. "/A=001234".
+	aprsAltRe = regexp.MustCompile(`/A=(-?\d{5,6})`)
+)
+
+// APRS returns the report as an APRS position (without timestamp) information field, e.g. "!4903.50N/07201.75W-088/036/A=001234Comment".
+//
+// symbol is the APRS symbol table and code, DefaultAPRSSymbol if empty. A speed
+// of unknown unit is assumed to be in knots. The date is not included.
+func (p PosReport) APRS(symbol string) (string, error) {
+	if symbol == "" {
+		symbol = DefaultAPRSSymbol
+	}
+	if len(symbol) != 2 {
+		return "", fmt.Errorf("Invalid APRS symbol %q", symbol)
+	}
+	if p.Lat == nil || p.Lon == nil {
+		return "", errors.New("Missing position")
+	}
+
+	var b strings.Builder
+	b.WriteByte('!')
+	b.WriteString(aprsCoordinate(*p.Lat, true))
+	b.WriteByte(symbol[0])
+	b.WriteString(aprsCoordinate(*p.Lon, false))
+	b.WriteByte(symbol[1])
+
+	if p.Course != nil && p.Speed != nil {
+		speed, ok := p.SpeedIn(SpeedKnots)
+		if !ok {
+			speed = *p.Speed
+		}
+		course := p.Course.Degrees()
+		if course == 0 {
+			course = 360 // 000 means unknown in APRS
+		}
+		fmt.Fprintf(&b, "%03d/%03d", course, int(math.Round(speed)))
+	}
+	if p.Altitude != nil {
+		fmt.Fprintf(&b, "/A=%06d", int(math.Round(*p.Altitude/0.3048)))
+	}
+	b.WriteString(p.Comment)
+	return b.String(), nil
+}
+
+// Format: 4903.50N or 07201.75W
+func aprsCoordinate(dec float64, latitude bool) string {
+	var sign byte
+	switch {
+	case latitude && dec >= 0:
+		sign = 'N'
+	case latitude:
+		sign = 'S'
+	case dec >= 0:
+		sign = 'E'
+	default:
+		sign = 'W'
+	}
+
+	format := "%02d%05.2f%c"
+	if !latitude {
+		format = "%03d%05.2f%c"
+	}
+
+	// Round to hundredths of minutes first, to avoid 60.00 minutes.
+	hmin := int(math.Round(math.Abs(dec) * 6000))
+	return fmt.Sprintf(format, hmin/6000, float64(hmin%6000)/100, sign)
+}
+
+// ParseAPRS parses an APRS position report in the uncompressed format.
+//
+// The information field may be preceded by the packet header (e.g. "N0CALL>APRS,WIDE2-1:").
+// Course and speed (in knots) are read from the data extension, and the
+// altitude from the comment. Timestamps are skipped, and compressed positions
+// are not supported. The returned APRS symbol is the table and code.
+func ParseAPRS(packet string) (p PosReport, symbol string, err error) {
+	info := packet
+	if i := strings.Index(packet, ":"); i > 0 && strings.Contains(packet[:i], ">") {
+		info = packet[i+1:]
+	}
+	if info == "" {
+		return p, "", errors.New("Empty APRS packet")
+	}
+
+	switch info[0] {
+	case '!', '=':
+		info = info[1:]
+	case '/', '@':
+		if len(info) < 8 {
+			return p, "", errors.New("Truncated APRS timestamp")
+		}
+		info = info[8:]
+	default:
+		return p, "", fmt.Errorf("Unsupported APRS data type %q", info[0])
+	}
+
+	m := aprsPosRe.FindStringSubmatch(info)
+	if m == nil {
+		return p, "", errors.New("Unsupported APRS position format")
+	}
+	lat := aprsDegrees(m[1], m[2], m[3] == "S")
+	lon := aprsDegrees(m[5], m[6], m[7] == "W")
+	if math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+		return p, "", errors.New("APRS position out of bounds")
+	}
+	p.Lat, p.Lon = &lat, &lon
+	symbol = m[4] + m[8]
+	rest := info[len(m[0]):]
+
+	if m := aprsCSERe.FindStringSubmatch(rest); m != nil {
+		course, _ := strconv.Atoi(m[1])
+		speed, _ := strconv.ParseFloat(m[2], 64)
+		if course > 0 && course <= 360 {
+			p.Course, _ = NewCourse(course, false)
+			p.Speed, p.SpeedUnit = &speed, SpeedKnots
+		}
+		rest = rest[len(m[0]):]
+	}
+	if m := aprsAltRe.FindStringSubmatch(rest); m != nil {
+		feet, _ := strconv.Atoi(m[1])
+		alt := float64(feet) * 0.3048
+		p.Altitude = &alt
+		rest = strings.Replace(rest, m[0], "", 1)
+	}
+	p.Comment = strings.TrimSpace(rest)
+	return p, symbol, nil
+}
+
+func aprsDegrees(deg, min string, negative bool) float64 {
+	d, _ := strconv.ParseFloat(deg, 64)
+	m, _ := strconv.ParseFloat(min, 64)
+	v := d + m/60
+	if negative {
+		v = -v
+	}
+	return v
+}
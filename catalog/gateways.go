@@ -0,0 +1,276 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package catalog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+	"github.com/pnousiai/wl2k-go/maidenhead"
+)
+
+// Gateway is an RMS gateway channel, as listed in the RMS channel list.
+type Gateway struct {
+	Callsign  string
+	Locator   string
+	Frequency float64 // Dial frequency in kHz.
+	Mode      string  // Upper case, e.g. "ARDOP", "PACKET", "VARA HF", "VARA FM" or "PACTOR".
+	Bandwidth int     // In Hz, or zero if not listed.
+	Hours     Hours
+}
+
+// Hours is the operating hours (UTC) of a gateway channel.
+type Hours struct {
+	From, To int // Minute of the day [0,1439], inclusive. From > To wraps around midnight.
+}
+
+// AllHours is the operating hours of a channel open around the clock.
+var AllHours = Hours{0, 24*60 - 1}
+
+// Open reports whether the channel is open at the given time.
+func (h Hours) Open(t time.Time) bool {
+	t = t.UTC()
+	min := t.Hour()*60 + t.Minute()
+	if h.From <= h.To {
+		return min >= h.From && min <= h.To
+	}
+	return min >= h.From || min <= h.To
+}
+
+func (h Hours) String() string {
+	return fmt.Sprintf("%02d%02d-%02d%02d", h.From/60, h.From%60, h.To/60, h.To%60)
+}
+
+var (
+	callsignRe = regexp.MustCompile(`^[A-Z0-9]{1,3}[0-9][A-Z0-9]{0,4}(?:-\d{1,2})?$`)
+	hoursRe    = regexp.MustCompile(`^(\d{2})(\d{2})?(?:Z|UTC)?-(\d{2})(\d{2})?(?:Z|UTC)?$`)
+	freqRe     = regexp.MustCompile(`^(\d+(?:\.\d+)?)(KHZ|MHZ)?$`)
+	bwRe       = regexp.MustCompile(`^(\d+)(?:HZ)?$`)
+)
+
+// Known modes, the more specific names (e.g. "VARA HF") before their prefix (e.g. "VARA").
+var gatewayModes = []string{"ARDOP", "PACKET", "VARA HF", "VARA FM", "VARA", "PACTOR", "ROBUST PACKET"}
+
+// LineError is an error in a line of a listing.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e LineError) Error() string { return fmt.Sprintf("Line %d: %s", e.Line, e.Err) }
+func (e LineError) Unwrap() error { return e.Err }
+
+// LineErrors is the lines skipped by ParseGateways.
+type LineErrors []LineError
+
+func (e LineErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more)", e[0], len(e)-1)
+}
+
+// ParseGateways parses an RMS channel list.
+//
+// Each channel is listed on a separate line with whitespace separated columns:
+// callsign, locator, frequency, mode with optional bandwidth (e.g. "ARDOP 2000"
+// or "VARA HF 2300") and operating hours. Header and other lines not starting
+// with a callsign and a locator are ignored.
+//
+// The frequency is in kHz, unless suffixed by a unit (e.g. "1296.5MHZ" or
+// "144.8 MHz"). Without a unit, values below 1800 (the lower edge of the 160 m
+// band) are taken as MHz, covering the VHF/UHF bands up to 23 cm.
+//
+// The operating hours are either hours (e.g. "00-23", where the closing hour
+// is inclusive), hours and minutes (e.g. "0630-1800") or "24/7".
+//
+// Channels that can not be parsed (e.g. an unknown mode) are skipped. All other
+// channels are returned, with a LineErrors describing the skipped lines.
+func ParseGateways(r io.Reader) ([]Gateway, error) {
+	var gateways []Gateway
+	var skipped LineErrors
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		fields := strings.Fields(strings.ToUpper(s.Text()))
+		if len(fields) < 3 || !callsignRe.MatchString(fields[0]) || !maidenhead.Valid(fields[1]) {
+			continue
+		}
+		g, err := parseGateway(fields)
+		if err != nil {
+			skipped = append(skipped, LineError{n, err})
+			continue
+		}
+		gateways = append(gateways, g)
+	}
+	if err := s.Err(); err != nil {
+		return gateways, err
+	}
+	if len(skipped) > 0 {
+		return gateways, skipped
+	}
+	return gateways, nil
+}
+
+// ParseGatewaysMessage parses the RMS channel list in the body of msg. See ParseGateways.
+func ParseGatewaysMessage(msg *fbb.Message) ([]Gateway, error) {
+	body, err := msg.Body()
+	if err != nil {
+		return nil, err
+	}
+	return ParseGateways(strings.NewReader(body))
+}
+
+func parseGateway(fields []string) (Gateway, error) {
+	g := Gateway{Callsign: fields[0], Hours: AllHours}
+	g.Locator, _ = maidenhead.Normalize(fields[1])
+
+	m := freqRe.FindStringSubmatch(fields[2])
+	if m == nil {
+		return g, fmt.Errorf("Invalid frequency %q", fields[2])
+	}
+	freq, _ := strconv.ParseFloat(m[1], 64)
+	unit := m[2]
+	if unit == "" && len(fields) > 3 && (fields[3] == "KHZ" || fields[3] == "MHZ") {
+		unit, fields = fields[3], append(fields[:3:3], fields[4:]...)
+	}
+	if unit == "MHZ" || unit == "" && freq < 1800 {
+		freq *= 1000
+	}
+	g.Frequency = freq
+
+	rest := strings.Join(fields[3:], " ")
+	for _, mode := range gatewayModes {
+		if !strings.HasPrefix(rest, mode) {
+			continue
+		}
+		// The mode name may be followed by a space or the bandwidth, e.g. "ARDOP2000".
+		if next := rest[len(mode):]; next == "" || next[0] == ' ' || next[0] >= '0' && next[0] <= '9' {
+			g.Mode = mode
+			rest = strings.TrimSpace(next)
+			break
+		}
+	}
+	if g.Mode == "" {
+		return g, fmt.Errorf("Unknown mode %q", rest)
+	}
+
+	for _, f := range strings.Fields(rest) {
+		switch {
+		case f == "24/7" || f == "H24":
+			g.Hours = AllHours
+		case hoursRe.MatchString(f):
+			hours, err := parseHours(hoursRe.FindStringSubmatch(f))
+			if err != nil {
+				return g, fmt.Errorf("Invalid hours %q", f)
+			}
+			g.Hours = hours
+		case bwRe.MatchString(f):
+			g.Bandwidth, _ = strconv.Atoi(bwRe.FindStringSubmatch(f)[1])
+		}
+	}
+	return g, nil
+}
+
+// parseHours returns the operating hours of a hoursRe match.
+func parseHours(m []string) (Hours, error) {
+	from, _ := strconv.Atoi(m[1])
+	fromMin, _ := strconv.Atoi(m[2])
+	to, _ := strconv.Atoi(m[3])
+	toMin, _ := strconv.Atoi(m[4])
+	if from > 23 || fromMin > 59 || to > 24 || toMin > 59 || to == 24 && toMin > 0 {
+		return Hours{}, errors.New("out of range")
+	}
+	h := Hours{From: from*60 + fromMin, To: to*60 + toMin}
+	if m[4] == "" {
+		h.To += 59 // The closing hour is inclusive
+	}
+	if h.To >= 24*60 {
+		h.To = 24*60 - 1
+	}
+	return h, nil
+}
+
+// Mode is a transport mode supported by the client, used by RankGateways.
+type Mode struct {
+	Name         string // Mode name, e.g. "ARDOP" or "VARA" (matching both "VARA HF" and "VARA FM").
+	MaxBandwidth int    // The widest bandwidth supported (Hz), or zero for any.
+}
+
+// RankOptions controls RankGateways.
+type RankOptions struct {
+	Locator     string    // Our Maidenhead locator.
+	Modes       []Mode    // Supported modes. Gateways of other modes are excluded. Empty means any mode.
+	Time        time.Time // The time of connection. Gateways closed at this time are ranked last. Zero means now.
+	MaxDistance float64   // Gateways further away (km) are excluded. Zero means no limit.
+}
+
+// RankedGateway is a gateway ranked by RankGateways.
+type RankedGateway struct {
+	Gateway
+	Distance float64 // In km.
+	Bearing  float64 // In degrees from true north.
+	Open     bool    // Open at the time of connection.
+}
+
+// RankGateways returns the gateways compatible with the given options, best candidate first.
+//
+// Gateways open at the time of connection are ranked before closed ones, and
+// then by distance from our locator (nearest first).
+func RankGateways(gateways []Gateway, opts RankOptions) ([]RankedGateway, error) {
+	if _, err := maidenhead.Decode(opts.Locator); err != nil {
+		return nil, err
+	}
+	if opts.Time.IsZero() {
+		opts.Time = time.Now()
+	}
+
+	var ranked []RankedGateway
+	for _, g := range gateways {
+		if !compatibleMode(g, opts.Modes) {
+			continue
+		}
+		dist, err := maidenhead.Distance(opts.Locator, g.Locator)
+		if err != nil {
+			continue
+		}
+		if opts.MaxDistance > 0 && dist > opts.MaxDistance {
+			continue
+		}
+		bearing, _ := maidenhead.Bearing(opts.Locator, g.Locator)
+		ranked = append(ranked, RankedGateway{Gateway: g, Distance: dist, Bearing: bearing, Open: g.Hours.Open(opts.Time)})
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Open != ranked[j].Open {
+			return ranked[i].Open
+		}
+		return ranked[i].Distance < ranked[j].Distance
+	})
+	return ranked, nil
+}
+
+func compatibleMode(g Gateway, modes []Mode) bool {
+	if len(modes) == 0 {
+		return true
+	}
+	for _, m := range modes {
+		name := strings.ToUpper(m.Name)
+		if g.Mode != name && !strings.HasPrefix(g.Mode, name+" ") {
+			continue
+		}
+		if m.MaxBandwidth == 0 || g.Bandwidth == 0 || g.Bandwidth <= m.MaxBandwidth {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package catalog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testGateways = `RMS channel list
+Callsign   Grid     Freq       Mode         Hours
+---------  -------  ---------  -----------  -----
+LA1B-10    JP20qh   3594.500   ARDOP 2000   00-23
+LA1B-10    jp20QH   7.0525     VARA HF 2300 0630-1800
+LA1B-10    JP20qh   10145.0    WINMOR 1600  00-23
+LA3F       JO59jw   144.800    PACKET 1200  24/7
+LA3F       JO59jw   1296.500   VARA FM      00-23
+SM0XYZ-10  JO99bh   3597.0     ARDOP500     20-04
+SM0XYZ-10  JO99bh   2300.1 MHz VARA FM      0000-2400
+OH2ABC     KP20     14109.0    PACTOR       00-23
+`
+
+func TestParseGateways(t *testing.T) {
+	// The WINMOR channel is skipped, the rest are returned
+	gateways, err := ParseGateways(strings.NewReader(testGateways))
+	var skipped LineErrors
+	if !errors.As(err, &skipped) || len(skipped) != 1 || skipped[0].Line != 6 {
+		t.Errorf("Expected line 6 to be skipped, got %v", err)
+	}
+	expect := []Gateway{
+		{"LA1B-10", "JP20qh", 3594.5, "ARDOP", 2000, AllHours},
+		{"LA1B-10", "JP20qh", 7052.5, "VARA HF", 2300, Hours{6*60 + 30, 18 * 60}},
+		{"LA3F", "JO59jw", 144800, "PACKET", 1200, AllHours},
+		{"LA3F", "JO59jw", 1296500, "VARA FM", 0, AllHours},
+		{"SM0XYZ-10", "JO99bh", 3597, "ARDOP", 500, Hours{20 * 60, 4*60 + 59}},
+		{"SM0XYZ-10", "JO99bh", 2300100, "VARA FM", 0, AllHours},
+		{"OH2ABC", "KP20", 14109, "PACTOR", 0, AllHours},
+	}
+	if len(gateways) != len(expect) {
+		t.Fatalf("Expected %d gateways, got %d: %+v", len(expect), len(gateways), gateways)
+	}
+	for i := range expect {
+		if gateways[i] != expect[i] {
+			t.Errorf("Expected %+v, got %+v", expect[i], gateways[i])
+		}
+	}
+
+	if _, err := ParseGateways(strings.NewReader("LA1B JP20qh 3594.5 CW 00-23\n")); err == nil {
+		t.Errorf("Expected error for unknown mode")
+	}
+
+	open := Hours{6*60 + 30, 18 * 60}
+	for at, expect := range map[string]bool{"06:29": false, "06:30": true, "18:00": true, "18:01": false} {
+		tm, _ := time.Parse("15:04", at)
+		if open.Open(tm) != expect {
+			t.Errorf("%s at %s: expected open=%t", open, at, expect)
+		}
+	}
+}
+
+func TestRankGateways(t *testing.T) {
+	gateways, _ := ParseGateways(strings.NewReader(testGateways))
+
+	rank := func(opts RankOptions) []string {
+		t.Helper()
+		ranked, err := RankGateways(gateways, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, g := range ranked {
+			got = append(got, g.Callsign+"/"+g.Mode)
+		}
+		return got
+	}
+
+	// From Oslo (JO59) at 22Z with ARDOP (up to 1000 Hz) and VARA HF
+	got := rank(RankOptions{
+		Locator: "JO59jw",
+		Modes:   []Mode{{"ARDOP", 1000}, {"VARA HF", 0}},
+		Time:    time.Date(2026, 5, 1, 22, 0, 0, 0, time.UTC),
+	})
+	if strings.Join(got, " ") != "SM0XYZ-10/ARDOP LA1B-10/VARA HF" {
+		t.Errorf("Unexpected ranking %v", got)
+	}
+
+	// Any mode within 50 km, at noon
+	got = rank(RankOptions{Locator: "JO59jw", MaxDistance: 50, Time: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)})
+	if strings.Join(got, " ") != "LA3F/PACKET LA3F/VARA FM" {
+		t.Errorf("Unexpected ranking %v", got)
+	}
+
+	if _, err := RankGateways(gateways, RankOptions{Locator: "X"}); err == nil {
+		t.Errorf("Expected error for invalid locator")
+	}
+}
@@ -0,0 +1,607 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// ErrNotGRIB is returned by ReadGRIB if no GRIB message is found.
+var ErrNotGRIB = errors.New("Not a GRIB file")
+
+// GRIBField is the header of a single field (a GRIB message, or a product in a GRIB2 message).
+type GRIBField struct {
+	Edition   int    // 1 or 2.
+	Centre    int    // Originating centre, e.g. 7 (NCEP) or 98 (ECMWF).
+	Process   int    // Generating process (model) identifier, as assigned by the centre.
+	Parameter string // Abbreviated parameter name (e.g. "PRMSL" or "UGRD"), or the numeric code if unknown.
+
+	RefTime  time.Time     // Reference (analysis) time.
+	Forecast time.Duration // Forecast time relative to RefTime.
+
+	// The grid, in decimal degrees. Only set for regular lat/lon grids.
+	Grid *GRIBGrid
+}
+
+// ValidTime returns the time the field is valid for.
+func (f GRIBField) ValidTime() time.Time { return f.RefTime.Add(f.Forecast) }
+
+// GRIBGrid is a regular lat/lon grid.
+type GRIBGrid struct {
+	Ni, Nj       int     // Number of points along a parallel and a meridian.
+	South, North float64 // Latitude bounds.
+	West, East   float64 // Longitude bounds in [-180,180]. West is greater than East if the grid crosses the antimeridian.
+	DLat, DLon   float64 // Grid spacing.
+}
+
+// GRIBSummary summarises the headers of a GRIB file.
+type GRIBSummary struct {
+	Size    int64 // Total size in bytes.
+	Fields  []GRIBField
+	Invalid int // Number of truncated or malformed messages skipped.
+}
+
+// Models returns the names of the originating centres and models (e.g. "NCEP/96").
+func (s GRIBSummary) Models() []string {
+	var models []string
+	seen := make(map[string]bool)
+	for _, f := range s.Fields {
+		name := gribCentres[f.Centre]
+		if name == "" {
+			name = fmt.Sprintf("Centre %d", f.Centre)
+		}
+		name = fmt.Sprintf("%s/%d", name, f.Process)
+		if !seen[name] {
+			seen[name] = true
+			models = append(models, name)
+		}
+	}
+	return models
+}
+
+// Parameters returns the parameter names in order of first appearance.
+func (s GRIBSummary) Parameters() []string {
+	var params []string
+	seen := make(map[string]bool)
+	for _, f := range s.Fields {
+		if !seen[f.Parameter] {
+			seen[f.Parameter] = true
+			params = append(params, f.Parameter)
+		}
+	}
+	return params
+}
+
+// Grid returns the grid of the first field with a lat/lon grid, or nil if none.
+func (s GRIBSummary) Grid() *GRIBGrid {
+	for _, f := range s.Fields {
+		if f.Grid != nil {
+			return f.Grid
+		}
+	}
+	return nil
+}
+
+// RefTime returns the earliest reference time.
+func (s GRIBSummary) RefTime() time.Time {
+	var t time.Time
+	for _, f := range s.Fields {
+		if t.IsZero() || f.RefTime.Before(t) {
+			t = f.RefTime
+		}
+	}
+	return t
+}
+
+// ValidTimes returns the sorted, distinct valid times.
+func (s GRIBSummary) ValidTimes() []time.Time {
+	seen := make(map[int64]bool)
+	for _, f := range s.Fields {
+		seen[f.ValidTime().Unix()] = true
+	}
+	times := make([]time.Time, 0, len(seen))
+	for unix := range seen {
+		times = append(times, time.Unix(unix, 0).UTC())
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times
+}
+
+// ForecastHours returns the sorted, distinct forecast hours.
+func (s GRIBSummary) ForecastHours() []int {
+	seen := make(map[int]bool)
+	for _, f := range s.Fields {
+		seen[int(f.Forecast/time.Hour)] = true
+	}
+	return sortedInts(seen)
+}
+
+func (s GRIBSummary) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d fields, %d bytes\n", len(s.Fields), s.Size)
+	fmt.Fprintf(&b, "Model: %s\n", strings.Join(s.Models(), ", "))
+	if g := s.Grid(); g != nil {
+		fmt.Fprintf(&b, "Area: %s to %s, %s to %s (%gx%g°)\n",
+			gribDegrees(g.South, "N", "S"), gribDegrees(g.North, "N", "S"),
+			gribDegrees(g.West, "E", "W"), gribDegrees(g.East, "E", "W"),
+			g.DLat, g.DLon,
+		)
+	}
+	if t := s.RefTime(); !t.IsZero() {
+		fmt.Fprintf(&b, "Reference time: %s\n", t.Format(fbb.DateLayout))
+	}
+	fmt.Fprintf(&b, "Forecast hours: %s\n", formatHours(s.ForecastHours()))
+	fmt.Fprintf(&b, "Parameters: %s\n", strings.Join(s.Parameters(), ", "))
+	if s.Invalid > 0 {
+		fmt.Fprintf(&b, "Invalid messages: %d\n", s.Invalid)
+	}
+	return b.String()
+}
+
+// ReadGRIB reads the section headers of the GRIB1 and/or GRIB2 messages in r.
+//
+// Only the headers are decoded. The data sections are discarded as they're read,
+// so memory use does not depend on the (untrusted) message lengths. Bytes between
+// messages (e.g. padding) and stray "GRIB" markers are skipped. Truncated or
+// malformed messages are counted in GRIBSummary.Invalid, the fields of the valid
+// messages are still returned. ErrNotGRIB is returned if no valid message is found.
+func ReadGRIB(r io.Reader) (GRIBSummary, error) {
+	var s GRIBSummary
+	cr := &countingReader{r: r}
+	br := bufio.NewReader(cr)
+	for {
+		if err := skipToGRIB(br); err == io.EOF {
+			break
+		} else if err != nil {
+			s.Size = cr.n
+			return s, err
+		}
+
+		ind, _ := br.Peek(16)
+		length, ok := gribIndicator(ind)
+		if !ok {
+			br.Discard(4) // Not an indicator section, keep looking.
+			continue
+		}
+		indLen := 16
+		if ind[7] == 1 {
+			indLen = 8
+		}
+		br.Discard(indLen)
+
+		lr := &io.LimitedReader{R: br, N: int64(length) - int64(indLen)}
+		var (
+			fields []GRIBField
+			err    error
+		)
+		switch ind[7] {
+		case 1:
+			fields, err = readGRIB1(lr)
+		case 2:
+			fields, err = readGRIB2(lr, ind[6])
+		}
+		if err == nil {
+			err = readEndSection(lr)
+		}
+		if err != nil {
+			// Keep looking for the next message after the last byte read.
+			s.Invalid++
+			continue
+		}
+		s.Fields = append(s.Fields, fields...)
+	}
+	s.Size = cr.n
+	if len(s.Fields) == 0 {
+		return s, ErrNotGRIB
+	}
+	return s, nil
+}
+
+// ReadGRIBFile reads the GRIB headers of the given attachment. See ReadGRIB.
+func ReadGRIBFile(f *fbb.File) (GRIBSummary, error) {
+	return ReadGRIB(bytes.NewReader(f.Data()))
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// skipToGRIB discards bytes until the next "GRIB" marker. io.EOF is returned if none is found.
+func skipToGRIB(br *bufio.Reader) error {
+	for {
+		p, err := br.Peek(4)
+		if string(p) == "GRIB" {
+			return nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return io.EOF
+		} else if err != nil {
+			return err
+		}
+		br.Discard(1)
+	}
+}
+
+// gribIndicator returns the total message length given by the indicator section at the start of ind (16 bytes).
+//
+// ok is false if ind is not a valid GRIB1 or GRIB2 indicator section.
+func gribIndicator(ind []byte) (length uint64, ok bool) {
+	if len(ind) < 16 {
+		return 0, false
+	}
+	switch ind[7] {
+	case 1:
+		// Smallest possible message: indicator, PDS, BDS and end section.
+		length = uint64(uint24(ind[4:]))
+		return length, length >= 8+28+11+4
+	case 2:
+		length = binary.BigEndian.Uint64(ind[8:])
+		return length, ind[4] == 0 && ind[5] == 0 && length >= 16+21+4
+	default:
+		return 0, false
+	}
+}
+
+// maxHeaderSection is the maximum number of bytes of a header section kept in memory.
+// The header fields are all found in the first few dozen bytes, the rest is discarded.
+const maxHeaderSection = 1024
+
+var errShortSection = errors.New("Truncated GRIB section")
+
+// readSection reads a section of the given length, returning (at most maxHeaderSection of) its content.
+//
+// head holds the bytes of the section already read (e.g. the length field).
+func readSection(r io.Reader, head []byte, length int64) ([]byte, error) {
+	if length < int64(len(head)) {
+		return nil, errShortSection
+	}
+	keep := length
+	if keep > maxHeaderSection {
+		keep = maxHeaderSection
+	}
+	sec := make([]byte, keep)
+	copy(sec, head)
+	if _, err := io.ReadFull(r, sec[len(head):]); err != nil {
+		return nil, errShortSection
+	}
+	if err := discard(r, length-keep); err != nil {
+		return nil, err
+	}
+	return sec, nil
+}
+
+// discard reads and discards n bytes from r.
+func discard(r io.Reader, n int64) error {
+	if m, _ := io.CopyN(io.Discard, r, n); m != n {
+		return errShortSection
+	}
+	return nil
+}
+
+// readEndSection reads the "7777" end section.
+func readEndSection(r io.Reader) error {
+	end := make([]byte, 4)
+	if _, err := io.ReadFull(r, end); err != nil || string(end) != "7777" {
+		return errors.New("Missing GRIB end section")
+	}
+	return nil
+}
+
+// readGRIB1 reads the sections of a GRIB1 message following the indicator section.
+//
+// Octet n of a section in the WMO specification is at index n-1.
+func readGRIB1(r io.Reader) ([]GRIBField, error) {
+	head := make([]byte, 3)
+	readSection1 := func(min int) ([]byte, error) {
+		if _, err := io.ReadFull(r, head); err != nil {
+			return nil, errShortSection
+		}
+		length := int64(uint24(head))
+		if length < int64(min) {
+			return nil, errShortSection
+		}
+		return readSection(r, head, length)
+	}
+
+	// Product definition section (PDS)
+	pds, err := readSection1(28)
+	if err != nil {
+		return nil, err
+	}
+	f := GRIBField{
+		Edition:   1,
+		Centre:    int(pds[4]),
+		Process:   int(pds[5]),
+		Parameter: gribParameter1(pds[8]),
+	}
+
+	year := (int(pds[24])-1)*100 + int(pds[12])
+	f.RefTime = time.Date(year, time.Month(pds[13]), int(pds[14]), int(pds[15]), int(pds[16]), 0, 0, time.UTC)
+
+	unit := gribTimeUnit1(pds[17])
+	switch p1, p2 := int(pds[18]), int(pds[19]); pds[20] {
+	case 2, 3, 4, 5: // Time ranges, the field is valid at the end of the period.
+		f.Forecast = time.Duration(p2) * unit
+	case 10: // P1 occupies octets 19 and 20.
+		f.Forecast = time.Duration(p1<<8|p2) * unit
+	default:
+		f.Forecast = time.Duration(p1) * unit
+	}
+
+	// Grid description section (GDS), if present.
+	if pds[7]&0x80 != 0 {
+		gds, err := readSection1(6)
+		if err != nil {
+			return nil, err
+		}
+		if gds[5] == 0 && len(gds) >= 28 { // Regular lat/lon grid.
+			g := GRIBGrid{
+				Ni:    int(binary.BigEndian.Uint16(gds[6:])),
+				Nj:    int(binary.BigEndian.Uint16(gds[8:])),
+				DLon:  float64(binary.BigEndian.Uint16(gds[23:])) / 1e3,
+				DLat:  float64(binary.BigEndian.Uint16(gds[25:])) / 1e3,
+				South: float64(signed(uint64(uint24(gds[10:])), 24)) / 1e3,
+				West:  float64(signed(uint64(uint24(gds[13:])), 24)) / 1e3,
+				North: float64(signed(uint64(uint24(gds[17:])), 24)) / 1e3,
+				East:  float64(signed(uint64(uint24(gds[20:])), 24)) / 1e3,
+			}
+			f.Grid = normalizeGrid(g)
+		}
+	}
+
+	// Bit map section (BMS), if present, and binary data section (BDS).
+	sections := []bool{pds[7]&0x40 != 0, true}
+	for _, present := range sections {
+		if !present {
+			continue
+		}
+		if _, err := io.ReadFull(r, head); err != nil {
+			return nil, errShortSection
+		}
+		if err := discard(r, int64(uint24(head))-int64(len(head))); err != nil {
+			return nil, err
+		}
+	}
+	return []GRIBField{f}, nil
+}
+
+// readGRIB2 reads the sections of a GRIB2 message following the indicator section.
+//
+// Octet n of a section in the WMO specification is at index n-1.
+func readGRIB2(r *io.LimitedReader, discipline byte) ([]GRIBField, error) {
+	var (
+		fields []GRIBField
+		ident  GRIBField
+		grid   *GRIBGrid
+		head   = make([]byte, 5)
+	)
+	for {
+		// The end section ("7777") is 4 bytes, every other section is at least 5.
+		if r.N <= 4 {
+			return fields, nil
+		}
+		if _, err := io.ReadFull(r, head); err != nil {
+			return nil, errShortSection
+		}
+		length := int64(binary.BigEndian.Uint32(head))
+		if length < int64(len(head)) {
+			return nil, errShortSection
+		}
+
+		switch head[4] {
+		case 1: // Identification section
+			sec, err := readSection(r, head, length)
+			if err != nil {
+				return nil, err
+			}
+			if len(sec) < 19 {
+				return nil, errShortSection
+			}
+			ident.Centre = int(binary.BigEndian.Uint16(sec[5:]))
+			ident.RefTime = time.Date(int(binary.BigEndian.Uint16(sec[12:])), time.Month(sec[14]), int(sec[15]),
+				int(sec[16]), int(sec[17]), int(sec[18]), 0, time.UTC)
+		case 3: // Grid definition section
+			sec, err := readSection(r, head, length)
+			if err != nil {
+				return nil, err
+			}
+			grid = nil
+			if len(sec) >= 72 && binary.BigEndian.Uint16(sec[12:]) == 0 { // Template 3.0, regular lat/lon grid.
+				g := GRIBGrid{
+					Ni:    int(binary.BigEndian.Uint32(sec[30:])),
+					Nj:    int(binary.BigEndian.Uint32(sec[34:])),
+					South: float64(signed(uint64(binary.BigEndian.Uint32(sec[46:])), 32)) / 1e6,
+					West:  float64(signed(uint64(binary.BigEndian.Uint32(sec[50:])), 32)) / 1e6,
+					North: float64(signed(uint64(binary.BigEndian.Uint32(sec[55:])), 32)) / 1e6,
+					East:  float64(signed(uint64(binary.BigEndian.Uint32(sec[59:])), 32)) / 1e6,
+					DLon:  float64(binary.BigEndian.Uint32(sec[63:])) / 1e6,
+					DLat:  float64(binary.BigEndian.Uint32(sec[67:])) / 1e6,
+				}
+				grid = normalizeGrid(g)
+			}
+		case 4: // Product definition section
+			sec, err := readSection(r, head, length)
+			if err != nil {
+				return nil, err
+			}
+			if len(sec) < 22 {
+				return nil, errShortSection
+			}
+			f := ident
+			f.Edition = 2
+			f.Grid = grid
+			f.Parameter = gribParameter2(discipline, sec[9], sec[10])
+			f.Process = int(sec[13])
+			f.Forecast = time.Duration(binary.BigEndian.Uint32(sec[18:])) * gribTimeUnit2(sec[17])
+			fields = append(fields, f)
+		default: // Local use, data representation, bit map and data sections
+			if err := discard(r, length-int64(len(head))); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// normalizeGrid orders the bounds south to north and converts the longitudes to [-180,180].
+func normalizeGrid(g GRIBGrid) *GRIBGrid {
+	if g.South > g.North {
+		g.South, g.North = g.North, g.South
+	}
+	if g.West > 180 {
+		g.West -= 360
+	}
+	if g.East > 180 {
+		g.East -= 360
+	}
+	return &g
+}
+
+func uint24(b []byte) uint32 { return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]) }
+
+// signed converts a sign and magnitude integer of the given bit size.
+func signed(v uint64, bits int) int64 {
+	sign := uint64(1) << (bits - 1)
+	if v&sign != 0 {
+		return -int64(v &^ sign)
+	}
+	return int64(v)
+}
+
+// gribTimeUnit1 returns the duration of a time unit of GRIB1 code table 4, or zero if unsupported.
+func gribTimeUnit1(code byte) time.Duration {
+	switch code {
+	case 0:
+		return time.Minute
+	case 1:
+		return time.Hour
+	case 2:
+		return 24 * time.Hour
+	case 10:
+		return 3 * time.Hour
+	case 11:
+		return 6 * time.Hour
+	case 12:
+		return 12 * time.Hour
+	case 13:
+		return 15 * time.Minute
+	case 14:
+		return 30 * time.Minute
+	case 254:
+		return time.Second
+	default:
+		return 0 // Months, years etc. (not used by forecast models)
+	}
+}
+
+// gribTimeUnit2 returns the duration of a time unit of GRIB2 code table 4.4, or zero if unsupported.
+func gribTimeUnit2(code byte) time.Duration {
+	switch code {
+	case 0:
+		return time.Minute
+	case 1:
+		return time.Hour
+	case 2:
+		return 24 * time.Hour
+	case 10:
+		return 3 * time.Hour
+	case 11:
+		return 6 * time.Hour
+	case 12:
+		return 12 * time.Hour
+	case 13:
+		return time.Second
+	default:
+		return 0 // Months, years etc. (not used by forecast models)
+	}
+}
+
+var gribCentres = map[int]string{
+	7:  "NCEP",
+	34: "JMA",
+	54: "CMC",
+	58: "FNMOC",
+	74: "UKMO",
+	78: "DWD",
+	85: "Meteo-France",
+	98: "ECMWF",
+}
+
+// Parameter names of GRIB1 table 2 (WMO/NCEP).
+var gribParameters1 = map[byte]string{
+	1:   "PRES",
+	2:   "PRMSL",
+	7:   "HGT",
+	11:  "TMP",
+	33:  "UGRD",
+	34:  "VGRD",
+	52:  "RH",
+	59:  "PRATE",
+	61:  "APCP",
+	71:  "TCDC",
+	100: "HTSGW",
+	101: "WVDIR",
+	103: "WVPER",
+	180: "GUST",
+}
+
+// Parameter names of GRIB2 code table 4.2, keyed by discipline, category and number.
+var gribParameters2 = map[[3]byte]string{
+	{0, 0, 0}:   "TMP",
+	{0, 1, 1}:   "RH",
+	{0, 1, 7}:   "PRATE",
+	{0, 1, 8}:   "APCP",
+	{0, 2, 2}:   "UGRD",
+	{0, 2, 3}:   "VGRD",
+	{0, 2, 22}:  "GUST",
+	{0, 3, 0}:   "PRES",
+	{0, 3, 1}:   "PRMSL",
+	{0, 3, 5}:   "HGT",
+	{0, 6, 1}:   "TCDC",
+	{10, 0, 3}:  "HTSGW",
+	{10, 0, 4}:  "WVDIR",
+	{10, 0, 5}:  "WVHGT",
+	{10, 0, 11}: "PERPW",
+}
+
+func gribParameter1(code byte) string {
+	if name, ok := gribParameters1[code]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d", code)
+}
+
+func gribParameter2(discipline, category, number byte) string {
+	if name, ok := gribParameters2[[3]byte{discipline, category, number}]; ok {
+		return name
+	}
+	return fmt.Sprintf("%d.%d.%d", discipline, category, number)
+}
+
+// sortedInts returns the keys of m in increasing order.
+func sortedInts(m map[int]bool) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,217 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package catalog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func put24(b []byte, v uint32) { b[0], b[1], b[2] = byte(v>>16), byte(v>>8), byte(v) }
+
+// signMag returns v in sign and magnitude representation of the given bit size.
+func signMag(v int64, bits int) uint64 {
+	if v < 0 {
+		return uint64(-v) | 1<<(bits-1)
+	}
+	return uint64(v)
+}
+
+// testGRIB1 returns a GRIB1 message with a PDS, a lat/lon GDS and an empty BDS.
+func testGRIB1(param, p1 byte) []byte {
+	pds := make([]byte, 28)
+	put24(pds, 28)
+	pds[4], pds[5] = 7, 96 // NCEP GFS
+	pds[7] = 0x80          // GDS included
+	pds[8] = param
+	pds[12], pds[13], pds[14], pds[15] = 26, 5, 1, 12 // 2026-05-01 12:00
+	pds[17], pds[18] = 1, p1                          // Hours
+	pds[24] = 21                                      // Century
+
+	gds := make([]byte, 32)
+	put24(gds, 32)
+	binary.BigEndian.PutUint16(gds[6:], 21)
+	binary.BigEndian.PutUint16(gds[8:], 21)
+	put24(gds[10:], uint32(signMag(50000, 24)))
+	put24(gds[13:], uint32(signMag(-130000, 24)))
+	put24(gds[17:], uint32(signMag(40000, 24)))
+	put24(gds[20:], uint32(signMag(-120000, 24)))
+	binary.BigEndian.PutUint16(gds[23:], 500)
+	binary.BigEndian.PutUint16(gds[25:], 500)
+
+	bds := make([]byte, 12)
+	put24(bds, 12)
+
+	msg := append([]byte("GRIB\x00\x00\x00\x01"), pds...)
+	msg = append(append(msg, gds...), bds...)
+	msg = append(msg, "7777"...)
+	put24(msg[4:], uint32(len(msg)))
+	return msg
+}
+
+func grib2Section(num byte, length int) []byte {
+	sec := make([]byte, length)
+	binary.BigEndian.PutUint32(sec, uint32(length))
+	sec[4] = num
+	return sec
+}
+
+// testGRIB2 returns a GRIB2 message with one product per forecast hour (wind components).
+func testGRIB2(hours ...uint32) []byte {
+	ident := grib2Section(1, 21)
+	binary.BigEndian.PutUint16(ident[5:], 98) // ECMWF
+	binary.BigEndian.PutUint16(ident[12:], 2026)
+	ident[14], ident[15], ident[16] = 5, 2, 0 // 2026-05-02 00:00
+
+	grid := grib2Section(3, 72)
+	binary.BigEndian.PutUint32(grid[30:], 41)
+	binary.BigEndian.PutUint32(grid[34:], 21)
+	binary.BigEndian.PutUint32(grid[46:], uint32(signMag(-10000000, 32)))
+	binary.BigEndian.PutUint32(grid[50:], 170000000)
+	binary.BigEndian.PutUint32(grid[55:], uint32(signMag(-20000000, 32)))
+	binary.BigEndian.PutUint32(grid[59:], 190000000)
+	binary.BigEndian.PutUint32(grid[63:], 500000)
+	binary.BigEndian.PutUint32(grid[67:], 500000)
+
+	msg := append([]byte("GRIB\x00\x00\x00\x02"), make([]byte, 8)...)
+	msg = append(append(msg, ident...), grid...)
+	for _, h := range hours {
+		for _, number := range []byte{2, 3} { // UGRD, VGRD
+			prod := grib2Section(4, 34)
+			prod[9], prod[10] = 2, number
+			prod[13] = 1
+			prod[17] = 1
+			binary.BigEndian.PutUint32(prod[18:], h)
+			msg = append(msg, prod...)
+			msg = append(msg, grib2Section(5, 21)...)
+			msg = append(msg, grib2Section(7, 8)...)
+		}
+	}
+	msg = append(msg, "7777"...)
+	binary.BigEndian.PutUint64(msg[8:], uint64(len(msg)))
+	return msg
+}
+
+func TestReadGRIB1(t *testing.T) {
+	var data []byte
+	for _, p1 := range []byte{0, 3, 6} {
+		data = append(data, testGRIB1(2, p1)...)
+		data = append(data, testGRIB1(33, p1)...)
+	}
+
+	s, err := ReadGRIB(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Size != int64(len(data)) || len(s.Fields) != 6 {
+		t.Errorf("Unexpected size %d and %d fields", s.Size, len(s.Fields))
+	}
+	if got := strings.Join(s.Models(), ","); got != "NCEP/96" {
+		t.Errorf("Unexpected models %s", got)
+	}
+	if got := strings.Join(s.Parameters(), ","); got != "PRMSL,UGRD" {
+		t.Errorf("Unexpected parameters %s", got)
+	}
+	if expect := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC); !s.RefTime().Equal(expect) {
+		t.Errorf("Unexpected reference time %s", s.RefTime())
+	}
+	if got := s.ValidTimes(); len(got) != 3 || got[2] != time.Date(2026, 5, 1, 18, 0, 0, 0, time.UTC) {
+		t.Errorf("Unexpected valid times %v", got)
+	}
+	expect := GRIBGrid{Ni: 21, Nj: 21, South: 40, North: 50, West: -130, East: -120, DLat: 0.5, DLon: 0.5}
+	if g := s.Grid(); g == nil || *g != expect {
+		t.Errorf("Unexpected grid %+v", g)
+	}
+	if got := s.String(); !strings.Contains(got, "Area: 40N to 50N, 130W to 120W") || !strings.Contains(got, "Forecast hours: 0,3,6") {
+		t.Errorf("Unexpected summary:\n%s", got)
+	}
+}
+
+func TestReadGRIB2(t *testing.T) {
+	data := append([]byte("padding"), testGRIB2(0, 12, 24, 36)...)
+
+	s, err := ReadGRIB(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Size != int64(len(data)) || len(s.Fields) != 8 {
+		t.Errorf("Unexpected size %d and %d fields", s.Size, len(s.Fields))
+	}
+	if f := s.Fields[0]; f.Edition != 2 || f.Centre != 98 || f.Process != 1 {
+		t.Errorf("Unexpected field %+v", f)
+	}
+	if got := strings.Join(s.Parameters(), ","); got != "UGRD,VGRD" {
+		t.Errorf("Unexpected parameters %s", got)
+	}
+	if got := formatHours(s.ForecastHours()); got != "0,12..36" {
+		t.Errorf("Unexpected forecast hours %s", got)
+	}
+
+	// Crossing the antimeridian
+	expect := GRIBGrid{Ni: 41, Nj: 21, South: -20, North: -10, West: 170, East: -170, DLat: 0.5, DLon: 0.5}
+	if g := s.Grid(); g == nil || *g != expect {
+		t.Errorf("Unexpected grid %+v", g)
+	}
+}
+
+func TestReadGRIBErrors(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"text":          []byte("not a grib file"),
+		"stray marker":  []byte("Subject: GRIB request\r\nGRIB files attached, GRIB\x00"),
+		"bad edition":   []byte("GRIB\x00\x00\x00\x03\x00\x00\x00\x00\x00\x00\x01\x00 trailing data"),
+		"huge length":   append([]byte("GRIB\x00\x00\x00\x02"), 0, 0, 0, 0, 0x40, 0, 0, 0),
+		"huge section":  append(append([]byte("GRIB\x00\x00\x00\x02"), 0, 0, 0, 0, 0x40, 0, 0, 0), 0x7f, 0xff, 0xff, 0xff, 7),
+		"truncated":     testGRIB1(2, 0)[:50],
+		"missing end":   append(testGRIB1(2, 0)[:len(testGRIB1(2, 0))-4], "8888"...),
+		"short message": []byte("GRIB\x00\x00\x10\x01\x00\x00\x00\x00\x00\x00\x00\x00"),
+	} {
+		s, err := ReadGRIB(bytes.NewReader(data))
+		if !errors.Is(err, ErrNotGRIB) {
+			t.Errorf("%s: expected ErrNotGRIB, got %v", name, err)
+		}
+		if s.Size != int64(len(data)) {
+			t.Errorf("%s: expected size %d, got %d", name, len(data), s.Size)
+		}
+	}
+
+	// The message length in the header must not be trusted for allocations
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	ReadGRIB(bytes.NewReader(append([]byte("GRIB\x00\x00\x00\x02"), 0, 0, 0, 0x40, 0, 0, 0, 0)))
+	runtime.ReadMemStats(&after)
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("Allocated %d bytes for a 16 byte input", n)
+	}
+
+	// A bad trailing message does not discard the valid ones
+	data := append(testGRIB2(0, 6), testGRIB2(12)[:60]...)
+	s, err := ReadGRIB(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Fields) != 4 || s.Invalid != 1 {
+		t.Errorf("Expected 4 fields and 1 invalid message, got %d and %d", len(s.Fields), s.Invalid)
+	}
+}
+
+func TestGRIBTimeUnits(t *testing.T) {
+	msg := testGRIB1(2, 4)
+	msg[8+17] = 13 // Quarter hours in GRIB1
+	s, err := ReadGRIB(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := s.Fields[0].Forecast; f != time.Hour {
+		t.Errorf("Expected 1h forecast, got %s", f)
+	}
+	if gribTimeUnit2(13) != time.Second {
+		t.Errorf("Expected seconds for GRIB2 time unit 13")
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package catalog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// Catalog inquiries are sent as a message to InquiryAddress with InquirySubject,
+// listing the requested item codes in the body (one per line). The items are
+// returned by the CMS in separate messages.
+const (
+	InquiryAddress = "INQUIRY"
+	InquirySubject = "REQUEST"
+)
+
+var (
+	// Item codes, e.g. "WX_NWS_FORECAST" or "PROP.3DAY".
+	itemCodeRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.\-/]*$`)
+
+	// An item line: code, separator and description, with an optional trailing size.
+	//
+	// The size is either in parentheses (e.g. "(2400)" or "(12 KB)"), or
+	// followed by a unit (e.g. "12K" or "2400 bytes"). A bare trailing number
+	// is part of the description (e.g. "Forecast for day 3").
+	itemLineRe = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_.\-/]*)(?:\s*[-:|]\s+|\t+\s*|\s{2,})(.+?)` +
+		`(?:\s*\((\d+(?:\.\d+)?)\s*([KkMm]?)(?:B|b|bytes)?\)|\s+(\d+(?:\.\d+)?)\s*(?:([KkMm])(?:B|b|bytes)?|B|bytes))?$`)
+
+	// Category headings, e.g. "[Weather]", "--- Weather ---", "== Weather ==" or "WEATHER:".
+	headingRe = regexp.MustCompile(`^(?:\[\s*(.+?)\s*\]|[-=#*]{2,}\s*(.+?)\s*[-=#*]*|([^\s:][^:]*):)$`)
+)
+
+// NewInquiry returns a catalog inquiry requesting the given items (e.g. weather, propagation or news bulletins).
+//
+// The item codes are found in the catalog listing, see ParseCatalog.
+func NewInquiry(mycall string, items ...string) (*fbb.Message, error) {
+	if len(items) == 0 {
+		return nil, errors.New("No catalog items requested")
+	}
+	var body strings.Builder
+	for _, code := range items {
+		code = strings.TrimSpace(code)
+		if !itemCodeRe.MatchString(code) {
+			return nil, fmt.Errorf("Invalid catalog item code %q", code)
+		}
+		fmt.Fprintf(&body, "%s\r\n", code)
+	}
+
+	msg := fbb.NewMessage(fbb.Private, mycall)
+	msg.AddTo(InquiryAddress)
+	msg.SetSubject(InquirySubject)
+	if err := msg.SetBody(body.String()); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// IsInquiry reports whether the message is a catalog inquiry.
+func IsInquiry(msg *fbb.Message) bool {
+	return msg.IsOnlyReceiver(fbb.AddressFromString(InquiryAddress)) && strings.EqualFold(strings.TrimSpace(msg.Subject()), InquirySubject)
+}
+
+// Item is an entry in the catalog listing.
+type Item struct {
+	Code        string
+	Description string
+	Category    string // The heading the item was listed under, if any.
+	Size        int    // Approximate size in bytes, if listed.
+}
+
+// Catalog is a list of catalog items, as parsed by ParseCatalog.
+type Catalog []Item
+
+// ParseCatalog parses a catalog listing.
+//
+// The listing is a plain text list of item codes followed by a description
+// (separated by a tab, multiple spaces or a dash), optionally grouped under
+// category headings (e.g. "[Weather]" or "WEATHER:"). A trailing size (e.g.
+// "(1200)" or "1.2K") is stored in Item.Size. Other lines are ignored.
+func ParseCatalog(r io.Reader) (Catalog, error) {
+	var (
+		c        Catalog
+		category string
+	)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		if m := itemLineRe.FindStringSubmatch(line); m != nil {
+			item := Item{Code: m[1], Description: strings.TrimSpace(m[2]), Category: category}
+			switch {
+			case m[3] != "":
+				item.Size = parseSize(m[3], m[4])
+			case m[5] != "":
+				item.Size = parseSize(m[5], m[6])
+			}
+			c = append(c, item)
+			continue
+		}
+		if m := headingRe.FindStringSubmatch(line); m != nil {
+			category = strings.TrimSpace(m[1] + m[2] + m[3])
+		}
+	}
+	return c, s.Err()
+}
+
+// ParseCatalogMessage parses the catalog listing in the body of msg. See ParseCatalog.
+func ParseCatalogMessage(msg *fbb.Message) (Catalog, error) {
+	body, err := msg.Body()
+	if err != nil {
+		return nil, err
+	}
+	return ParseCatalog(strings.NewReader(body))
+}
+
+func parseSize(num, unit string) int {
+	v, _ := strconv.ParseFloat(num, 64)
+	switch strings.ToUpper(unit) {
+	case "K":
+		v *= 1024
+	case "M":
+		v *= 1024 * 1024
+	}
+	return int(v)
+}
+
+// Lookup returns the item with the given code (case insensitive).
+func (c Catalog) Lookup(code string) (Item, bool) {
+	for _, item := range c {
+		if strings.EqualFold(item.Code, code) {
+			return item, true
+		}
+	}
+	return Item{}, false
+}
+
+// Search returns the items where all the given words are found in the code, description or category (case insensitive).
+func (c Catalog) Search(words ...string) Catalog {
+	var res Catalog
+	for _, item := range c {
+		text := strings.ToLower(item.Code + " " + item.Description + " " + item.Category)
+		match := true
+		for _, w := range words {
+			if !strings.Contains(text, strings.ToLower(w)) {
+				match = false
+				break
+			}
+		}
+		if match {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// Category returns the items listed under the given category (case insensitive).
+func (c Catalog) Category(name string) Catalog {
+	var res Catalog
+	for _, item := range c {
+		if strings.EqualFold(item.Category, name) {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// Categories returns the sorted names of all categories.
+func (c Catalog) Categories() []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, item := range c {
+		if item.Category != "" && !seen[item.Category] {
+			seen[item.Category] = true
+			names = append(names, item.Category)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Inquiry returns an inquiry requesting the given items, which must be listed in the catalog.
+func (c Catalog) Inquiry(mycall string, codes ...string) (*fbb.Message, error) {
+	items := make([]string, len(codes))
+	for i, code := range codes {
+		item, ok := c.Lookup(code)
+		if !ok {
+			return nil, fmt.Errorf("Unknown catalog item %q", code)
+		}
+		items[i] = item.Code
+	}
+	return NewInquiry(mycall, items...)
+}
@@ -0,0 +1,94 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package catalog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+const testCatalog = `Winlink catalog listing
+
+[Weather]
+WX_NWS_FORECAST      NWS zone forecast (2400)
+WX_SAT.GOES          GOES satellite image 12K
+WX_DAY3  Forecast for day 3
+WX_FAX   Surface analysis 1.5 MB
+
+--- Propagation ---
+PROP.3DAY - Three day propagation forecast
+PROP_SOLAR	Solar and geomagnetic indices
+
+NEWS:
+NEWS_ARRL            ARRL letter
+NEWS_BULLETIN        ARRL bulletin 2026
+`
+
+func TestParseCatalog(t *testing.T) {
+	c, err := ParseCatalog(strings.NewReader(testCatalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := Catalog{
+		{Code: "WX_NWS_FORECAST", Description: "NWS zone forecast", Category: "Weather", Size: 2400},
+		{Code: "WX_SAT.GOES", Description: "GOES satellite image", Category: "Weather", Size: 12 * 1024},
+		{Code: "WX_DAY3", Description: "Forecast for day 3", Category: "Weather"},
+		{Code: "WX_FAX", Description: "Surface analysis", Category: "Weather", Size: 1.5 * 1024 * 1024},
+		{Code: "PROP.3DAY", Description: "Three day propagation forecast", Category: "Propagation"},
+		{Code: "PROP_SOLAR", Description: "Solar and geomagnetic indices", Category: "Propagation"},
+		{Code: "NEWS_ARRL", Description: "ARRL letter", Category: "NEWS"},
+		{Code: "NEWS_BULLETIN", Description: "ARRL bulletin 2026", Category: "NEWS"},
+	}
+	if len(c) != len(expect) {
+		t.Fatalf("Expected %d items, got %d: %+v", len(expect), len(c), c)
+	}
+	for i := range expect {
+		if c[i] != expect[i] {
+			t.Errorf("Expected %+v, got %+v", expect[i], c[i])
+		}
+	}
+
+	if got := c.Categories(); strings.Join(got, ",") != "NEWS,Propagation,Weather" {
+		t.Errorf("Unexpected categories %v", got)
+	}
+	if got := c.Search("forecast"); len(got) != 3 {
+		t.Errorf("Expected 3 forecasts, got %+v", got)
+	}
+	if got := c.Search("weather", "goes"); len(got) != 1 || got[0].Code != "WX_SAT.GOES" {
+		t.Errorf("Unexpected search result %+v", got)
+	}
+	if got := c.Category("propagation"); len(got) != 2 {
+		t.Errorf("Expected 2 propagation items, got %+v", got)
+	}
+}
+
+func TestInquiry(t *testing.T) {
+	c, _ := ParseCatalog(strings.NewReader(testCatalog))
+	msg, err := c.Inquiry("N0CALL", "prop.3day", "NEWS_ARRL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsInquiry(msg) || !msg.IsOnlyReceiver(fbb.AddressFromString("INQUIRY")) {
+		t.Errorf("Unexpected inquiry to %v: %s", msg.Receivers(), msg.Subject())
+	}
+	if body, _ := msg.Body(); body != "PROP.3DAY\r\nNEWS_ARRL\r\n" {
+		t.Errorf("Unexpected body %q", body)
+	}
+	if err := msg.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := c.Inquiry("N0CALL", "UNKNOWN"); err == nil {
+		t.Errorf("Expected error for unknown item")
+	}
+	if _, err := NewInquiry("N0CALL"); err == nil {
+		t.Errorf("Expected error for empty inquiry")
+	}
+	if _, err := NewInquiry("N0CALL", "TWO WORDS"); err == nil {
+		t.Errorf("Expected error for invalid code")
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package catalog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// ErrNoPosition is returned by ParsePosReport if the message is not a position report.
+var ErrNoPosition = errors.New("no position report found")
+
+var (
+	// Degrees and decimal minutes, e.g. "23-42.3N", "N23-42.30", "023 42.3 E" or "23°42.3'N".
+	minDecRe = regexp.MustCompile(`^([NSEW])?\s*(\d{1,3})(?:-|\s+|°)\s*(\d{1,2}(?:\.\d*)?)'?\s*([NSEW])?$`)
+
+	// Decimal degrees, e.g. "-23.705" or "23.705N".
+	decRe = regexp.MustCompile(`^([-+]?\d{1,3}(?:\.\d*)?)°?\s*([NSEW])?$`)
+
+	// A number with an optional unit, e.g. "5.5 KTS" or "12km/h".
+	quantityRe = regexp.MustCompile(`^([-+]?\d+(?:\.\d*)?)\s*(\S*)$`)
+)
+
+// ParsePosReport parses a position report, as created by PosReport.Message or Winlink clients.
+//
+// The body is a list of "KEY: value" lines. Latitude and longitude are accepted
+// in degrees and decimal minutes (the "23-42.3N" format and common variants)
+// or in decimal degrees. ErrNoPosition is returned if the body holds neither
+// a position nor a date.
+func ParsePosReport(msg *fbb.Message) (PosReport, error) {
+	body, err := msg.Body()
+	if err != nil {
+		return PosReport{}, err
+	}
+	return parsePosReport(body)
+}
+
+func parsePosReport(body string) (PosReport, error) {
+	var (
+		p        PosReport
+		lat, lon string
+		found    bool
+	)
+	s := bufio.NewScanner(strings.NewReader(body))
+	for s.Scan() {
+		key, value, ok := strings.Cut(s.Text(), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+
+		var err error
+		switch strings.ToUpper(strings.TrimSpace(key)) {
+		case "DATE":
+			p.Date, err = fbb.ParseDate(value)
+			p.Date = p.Date.UTC()
+		case "LATITUDE", "LAT":
+			lat = value
+		case "LONGITUDE", "LON", "LONG":
+			lon = value
+		case "SPEED":
+			p.Speed, p.SpeedUnit, err = parseSpeed(value)
+		case "COURSE":
+			p.Course, err = parseCourse(value)
+		case "ALTITUDE", "ALT":
+			p.Altitude, err = parseAltitude(value)
+		case "COMMENT":
+			p.Comment = value
+		default:
+			continue
+		}
+		if err != nil {
+			return p, fmt.Errorf("Invalid %s: %w", strings.ToLower(strings.TrimSpace(key)), err)
+		}
+		found = true
+	}
+	if err := s.Err(); err != nil {
+		return p, err
+	}
+
+	switch {
+	case lat == "" && lon == "":
+	case lat == "" || lon == "":
+		return p, errors.New("Incomplete position: both latitude and longitude are required")
+	default:
+		latV, err := parseCoordinate(lat, true)
+		if err != nil {
+			return p, fmt.Errorf("Invalid latitude: %w", err)
+		}
+		lonV, err := parseCoordinate(lon, false)
+		if err != nil {
+			return p, fmt.Errorf("Invalid longitude: %w", err)
+		}
+		p.Lat, p.Lon = &latV, &lonV
+	}
+	if !found && p.Lat == nil {
+		return p, ErrNoPosition
+	}
+	return p, nil
+}
+
+// parseCoordinate parses a latitude or longitude to decimal degrees.
+func parseCoordinate(str string, latitude bool) (float64, error) {
+	str = strings.ToUpper(strings.TrimSpace(str))
+
+	var (
+		v          float64
+		hemisphere string
+	)
+	if m := minDecRe.FindStringSubmatch(str); m != nil {
+		if m[1] != "" && m[4] != "" {
+			return 0, fmt.Errorf("%q: ambiguous hemisphere", str)
+		}
+		deg, _ := strconv.ParseFloat(m[2], 64)
+		min, _ := strconv.ParseFloat(m[3], 64)
+		if min >= 60 {
+			return 0, fmt.Errorf("%q: minutes out of bounds", str)
+		}
+		v, hemisphere = deg+min/60, m[1]+m[4]
+	} else if m := decRe.FindStringSubmatch(str); m != nil {
+		v, _ = strconv.ParseFloat(m[1], 64)
+		hemisphere = m[2]
+		if hemisphere != "" && v < 0 {
+			return 0, fmt.Errorf("%q: ambiguous hemisphere", str)
+		}
+	} else {
+		return 0, fmt.Errorf("%q: unknown format", str)
+	}
+
+	switch {
+	case hemisphere == "":
+	case latitude && !strings.ContainsAny(hemisphere, "NS"), !latitude && !strings.ContainsAny(hemisphere, "EW"):
+		return 0, fmt.Errorf("%q: unexpected hemisphere", str)
+	case hemisphere == "S", hemisphere == "W":
+		v = -v
+	}
+
+	max := 180.0
+	if latitude {
+		max = 90
+	}
+	if math.Abs(v) > max {
+		return 0, fmt.Errorf("%q: out of bounds", str)
+	}
+	return v, nil
+}
+
+func parseQuantity(str string) (float64, string, error) {
+	m := quantityRe.FindStringSubmatch(strings.TrimSpace(str))
+	if m == nil {
+		return 0, "", fmt.Errorf("%q: not a number", str)
+	}
+	v, err := strconv.ParseFloat(m[1], 64)
+	return v, strings.ToUpper(m[2]), err
+}
+
+func parseSpeed(str string) (*float64, SpeedUnit, error) {
+	v, unit, err := parseQuantity(str)
+	if err != nil {
+		return nil, SpeedUnknown, err
+	}
+	switch unit {
+	case "":
+		return &v, SpeedUnknown, nil
+	case "KT", "KTS", "KN", "KNOTS":
+		return &v, SpeedKnots, nil
+	case "KM/H", "KMH", "KPH":
+		return &v, SpeedKPH, nil
+	case "MPH":
+		return &v, SpeedMPH, nil
+	default:
+		return nil, SpeedUnknown, fmt.Errorf("%q: unknown unit", str)
+	}
+}
+
+func parseAltitude(str string) (*float64, error) {
+	v, unit, err := parseQuantity(str)
+	if err != nil {
+		return nil, err
+	}
+	switch unit {
+	case "", "M":
+	case "FT", "FEET":
+		v *= 0.3048
+	default:
+		return nil, fmt.Errorf("%q: unknown unit", str)
+	}
+	return &v, nil
+}
+
+func parseCourse(str string) (*Course, error) {
+	str = strings.ToUpper(strings.TrimSpace(str))
+	magnetic := strings.HasSuffix(str, "M")
+	str = strings.TrimRight(str, "TM°")
+	degrees, err := strconv.Atoi(strings.TrimSpace(str))
+	if err != nil {
+		return nil, fmt.Errorf("%q: not a number", str)
+	}
+	return NewCourse(degrees, magnetic)
+}
@@ -10,17 +10,54 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pnousiai/wl2k-go/fbb"
+	"github.com/pnousiai/wl2k-go/maidenhead"
 )
 
 type PosReport struct {
-	Date     time.Time
-	Lat, Lon *float64 // In decimal degrees
-	Speed    *float64 // Unit not specified in winlink docs
-	Course   *Course
-	Comment  string // Up to 80 characters
+	Date      time.Time
+	Lat, Lon  *float64 // In decimal degrees
+	Speed     *float64 // In SpeedUnit
+	SpeedUnit SpeedUnit
+	Course    *Course
+	Altitude  *float64 // In meters above sea level
+	Comment   string   // Up to 80 characters
+}
+
+// SpeedUnit is the unit of PosReport.Speed.
+//
+// The unit is not specified in the winlink docs, so reports without an
+// explicit unit are parsed as SpeedUnknown.
+type SpeedUnit string
+
+const (
+	SpeedUnknown SpeedUnit = ""
+	SpeedKnots   SpeedUnit = "KTS"
+	SpeedKPH     SpeedUnit = "KM/H"
+	SpeedMPH     SpeedUnit = "MPH"
+)
+
+// Conversion factors to knots.
+var knotsPer = map[SpeedUnit]float64{
+	SpeedKnots: 1,
+	SpeedKPH:   1 / 1.852,
+	SpeedMPH:   1.609344 / 1.852,
+}
+
+// SpeedIn returns the speed converted to the given unit.
+//
+// ok is false if the report has no speed, or if either unit is unknown.
+func (p PosReport) SpeedIn(unit SpeedUnit) (speed float64, ok bool) {
+	from, fromOK := knotsPer[p.SpeedUnit]
+	to, toOK := knotsPer[unit]
+	if p.Speed == nil || !fromOK || !toOK {
+		return 0, false
+	}
+	return *p.Speed * from / to, true
 }
 
 type Course struct {
@@ -40,6 +77,31 @@ func NewCourse(degrees int, magnetic bool) (*Course, error) {
 	return &c, nil
 }
 
+// Locator returns the Maidenhead locator of the position, with the given number of characters (see maidenhead.Encode).
+func (p PosReport) Locator(chars int) (string, error) {
+	if p.Lat == nil || p.Lon == nil {
+		return "", errors.New("Missing position")
+	}
+	return maidenhead.Encode(*p.Lat, *p.Lon, chars)
+}
+
+// SetLocator sets the position to the center of the given Maidenhead locator.
+func (p *PosReport) SetLocator(locator string) error {
+	sq, err := maidenhead.Decode(locator)
+	if err != nil {
+		return err
+	}
+	lat, lon := sq.Center()
+	p.Lat, p.Lon = &lat, &lon
+	return nil
+}
+
+// Degrees returns the course in degrees [0,360).
+func (c Course) Degrees() int {
+	n, _ := strconv.Atoi(strings.TrimSpace(string(c.Digits[:])))
+	return n
+}
+
 func (c Course) String() string {
 	if c.Magnetic {
 		return fmt.Sprintf("%sM", string(c.Digits[:]))
@@ -56,12 +118,17 @@ func (p PosReport) Message(mycall string) *fbb.Message {
 		fmt.Fprintf(&buf, "LATITUDE: %s\r\n", decToMinDec(*p.Lat, true))
 		fmt.Fprintf(&buf, "LONGITUDE: %s\r\n", decToMinDec(*p.Lon, false))
 	}
-	if p.Speed != nil {
+	if p.Speed != nil && p.SpeedUnit == SpeedUnknown {
 		fmt.Fprintf(&buf, "SPEED: %f\r\n", *p.Speed)
+	} else if p.Speed != nil {
+		fmt.Fprintf(&buf, "SPEED: %s %s\r\n", strconv.FormatFloat(*p.Speed, 'f', -1, 64), p.SpeedUnit)
 	}
 	if p.Course != nil {
 		fmt.Fprintf(&buf, "COURSE: %s\r\n", *p.Course)
 	}
+	if p.Altitude != nil {
+		fmt.Fprintf(&buf, "ALTITUDE: %s M\r\n", strconv.FormatFloat(*p.Altitude, 'f', -1, 64))
+	}
 	if len(p.Comment) > 0 {
 		fmt.Fprintf(&buf, "COMMENT: %s\r\n", p.Comment)
 	}
@@ -88,3 +88,19 @@ func ExamplePosReport_Message() {
 	msg := posRe.Message("N0CALL")
 	msg.Write(os.Stdout)
 }
+
+func TestPosReportLocator(t *testing.T) {
+	var p PosReport
+	if _, err := p.Locator(6); err == nil {
+		t.Errorf("Expected error for missing position")
+	}
+	if err := p.SetLocator("JP20qh"); err != nil {
+		t.Fatal(err)
+	}
+	if loc, _ := p.Locator(6); loc != "JP20qh" {
+		t.Errorf("Expected JP20qh, got %s", loc)
+	}
+	if err := p.SetLocator("JP2"); err == nil {
+		t.Errorf("Expected error for invalid locator")
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// SaildocsAddress is the address of the Saildocs query service.
+const SaildocsAddress = "query@saildocs.com"
+
+// DefaultGRIBModel is the model requested if GRIBRequest.Model is empty.
+const DefaultGRIBModel = "GFS"
+
+var gribTokenRe = regexp.MustCompile(`^[A-Za-z0-9_.]+$`)
+
+// GRIBRequest is a Saildocs GRIB file request.
+//
+// See https://saildocs.com/gribinfo for the supported models and parameters.
+type GRIBRequest struct {
+	Model string // E.g. "GFS", "ECMWF" or "COAMPS". Default is DefaultGRIBModel.
+
+	// The area, in decimal degrees. West may be greater than East for areas
+	// crossing the antimeridian.
+	South, North float64
+	West, East   float64
+
+	Resolution float64  // Grid spacing in degrees (e.g. 0.5), or zero for the model's default.
+	Hours      []int    // Forecast hours (e.g. 0, 24, 48), or empty for the default.
+	Parameters []string // E.g. "PRMSL", "WIND", "HGT500", "WAVES" and "RAIN", or empty for the default.
+}
+
+// Validate returns an error if the request is malformed.
+func (r GRIBRequest) Validate() error {
+	switch {
+	case r.Model != "" && !gribTokenRe.MatchString(r.Model):
+		return fmt.Errorf("Invalid model %q", r.Model)
+	case r.South < -90 || r.North > 90 || r.South >= r.North:
+		return fmt.Errorf("Invalid latitude range %g to %g", r.South, r.North)
+	case r.West < -180 || r.West > 180 || r.East < -180 || r.East > 180 || r.West == r.East:
+		return fmt.Errorf("Invalid longitude range %g to %g", r.West, r.East)
+	case r.Resolution < 0:
+		return fmt.Errorf("Invalid resolution %g", r.Resolution)
+	}
+	for i, h := range r.Hours {
+		if h < 0 || i > 0 && h <= r.Hours[i-1] {
+			return errors.New("Forecast hours must be positive and increasing")
+		}
+	}
+	for _, p := range r.Parameters {
+		if !gribTokenRe.MatchString(p) {
+			return fmt.Errorf("Invalid parameter %q", p)
+		}
+	}
+	return nil
+}
+
+// String returns the request in Saildocs format, e.g. "send GFS:40N,50N,130W,120W|0.5,0.5|0,3..120|PRMSL,WIND".
+func (r GRIBRequest) String() string {
+	model := r.Model
+	if model == "" {
+		model = DefaultGRIBModel
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "send %s:%s,%s,%s,%s", strings.ToUpper(model),
+		gribDegrees(r.South, "N", "S"), gribDegrees(r.North, "N", "S"),
+		gribDegrees(r.West, "E", "W"), gribDegrees(r.East, "E", "W"),
+	)
+
+	// Optional fields are positional, so preceding fields are left empty if unset.
+	fields := []string{"", formatHours(r.Hours), strings.ToUpper(strings.Join(r.Parameters, ","))}
+	if r.Resolution > 0 {
+		res := strconv.FormatFloat(r.Resolution, 'f', -1, 64)
+		fields[0] = res + "," + res
+	}
+	for len(fields) > 0 && fields[len(fields)-1] == "" {
+		fields = fields[:len(fields)-1]
+	}
+	for _, f := range fields {
+		b.WriteString("|" + f)
+	}
+	return b.String()
+}
+
+func gribDegrees(v float64, pos, neg string) string {
+	suffix := pos
+	if v < 0 {
+		v, suffix = -v, neg
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64) + suffix
+}
+
+// formatHours formats the forecast hours, using the Saildocs range notation for evenly spaced hours (e.g. "0,3..120").
+func formatHours(hours []int) string {
+	if len(hours) == 0 {
+		return ""
+	}
+	if len(hours) > 3 {
+		step := hours[1] - hours[0]
+		even := true
+		for i := 2; i < len(hours); i++ {
+			even = even && hours[i]-hours[i-1] == step
+		}
+		if even {
+			return fmt.Sprintf("%d,%d..%d", hours[0], hours[1], hours[len(hours)-1])
+		}
+	}
+	strs := make([]string, len(hours))
+	for i, h := range hours {
+		strs[i] = strconv.Itoa(h)
+	}
+	return strings.Join(strs, ",")
+}
+
+// ForecastHours returns the forecast hours from 0 to max (inclusive) at the given interval.
+func ForecastHours(interval, max int) []int {
+	var hours []int
+	for h := 0; interval > 0 && h <= max; h += interval {
+		hours = append(hours, h)
+	}
+	return hours
+}
+
+// NewGRIBRequest returns a message to Saildocs with the given GRIB requests.
+//
+// The GRIB files are returned by Saildocs as attachments. See ReadGRIB.
+func NewGRIBRequest(mycall string, requests ...GRIBRequest) (*fbb.Message, error) {
+	if len(requests) == 0 {
+		return nil, errors.New("No GRIB requests")
+	}
+	var body strings.Builder
+	for _, r := range requests {
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&body, "%s\r\n", r)
+	}
+
+	msg := fbb.NewMessage(fbb.Private, mycall)
+	msg.AddTo(SaildocsAddress)
+	msg.SetSubject("GRIB request")
+	if err := msg.SetBody(body.String()); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package catalog
+
+import (
+	"testing"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+func TestGRIBRequestString(t *testing.T) {
+	tests := []struct {
+		req    GRIBRequest
+		expect string
+	}{
+		{
+			GRIBRequest{South: 40, North: 50, West: -130, East: -120, Resolution: 0.5, Hours: ForecastHours(3, 120), Parameters: []string{"prmsl", "WIND"}},
+			"send GFS:40N,50N,130W,120W|0.5,0.5|0,3..120|PRMSL,WIND",
+		},
+		{
+			GRIBRequest{Model: "ecmwf", South: -35.5, North: -30, West: 170, East: -175},
+			"send ECMWF:35.5S,30S,170E,175W",
+		},
+		{
+			GRIBRequest{South: 0, North: 10, West: 0, East: 10, Hours: []int{0, 24, 72}},
+			"send GFS:0N,10N,0E,10E||0,24,72",
+		},
+	}
+	for _, tt := range tests {
+		if err := tt.req.Validate(); err != nil {
+			t.Errorf("%+v: %s", tt.req, err)
+		}
+		if got := tt.req.String(); got != tt.expect {
+			t.Errorf("Expected %q, got %q", tt.expect, got)
+		}
+	}
+}
+
+func TestGRIBRequestValidate(t *testing.T) {
+	for _, req := range []GRIBRequest{
+		{South: 50, North: 40, West: 0, East: 10},
+		{South: 0, North: 10, West: 0, East: 181},
+		{South: 0, North: 10, West: 5, East: 5},
+		{South: 0, North: 10, West: 0, East: 10, Resolution: -1},
+		{South: 0, North: 10, West: 0, East: 10, Hours: []int{24, 12}},
+		{South: 0, North: 10, West: 0, East: 10, Parameters: []string{"WIND|RAIN"}},
+		{Model: "GFS:", South: 0, North: 10, West: 0, East: 10},
+	} {
+		if err := req.Validate(); err == nil {
+			t.Errorf("Expected error for %+v", req)
+		}
+	}
+}
+
+func TestNewGRIBRequest(t *testing.T) {
+	msg, err := NewGRIBRequest("N0CALL",
+		GRIBRequest{South: 40, North: 50, West: -130, East: -120},
+		GRIBRequest{Model: "WW3", South: 40, North: 50, West: -130, East: -120, Parameters: []string{"WAVES"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msg.IsOnlyReceiver(fbb.AddressFromString(SaildocsAddress)) {
+		t.Errorf("Unexpected receivers %v", msg.Receivers())
+	}
+	if body, _ := msg.Body(); body != "send GFS:40N,50N,130W,120W\r\nsend WW3:40N,50N,130W,120W|||WAVES\r\n" {
+		t.Errorf("Unexpected body %q", body)
+	}
+	if err := msg.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err := NewGRIBRequest("N0CALL"); err == nil {
+		t.Errorf("Expected error for empty request")
+	}
+}
@@ -66,7 +66,7 @@ func (s *Session) handleOutbound(rw io.ReadWriter) (quitSent bool, err error) {
 	// Report rejected now, they can safely be omitted even if an error occures
 	for mid, rej := range sent {
 		if rej {
-			s.h.SetSent(mid, rej)
+			s.setSent(mid, rej)
 			delete(sent, mid)
 		}
 	}
@@ -110,7 +110,7 @@ func (s *Session) handleOutbound(rw io.ReadWriter) (quitSent bool, err error) {
 
 	// Report successfully sent messages
 	for mid, rej := range sent {
-		s.h.SetSent(mid, rej)
+		s.setSent(mid, rej)
 		if !rej {
 			s.trafficStats.Sent = append(s.trafficStats.Sent, mid)
 		}
@@ -179,7 +179,7 @@ func (s *Session) sendOutbound(rw io.ReadWriter) (sent map[string]bool, err erro
 	for _, prop := range outbound {
 		switch prop.answer {
 		case Defer:
-			s.h.SetDeferred(prop.mid)
+			s.setDeferred(prop.mid)
 		case Reject:
 			sent[prop.mid] = true
 		case Accept:
@@ -163,6 +163,19 @@ func (d *WordDecoder) DecodeHeader(header string) (string, error) {
 	return string(decoded), nil
 }
 
+// encodeWord Q-encodes (RFC 2047) words of s containing non-ASCII characters using the charset selected by SelectCharset.
+func encodeWord(s string) string {
+	switch set := SelectCharset(s); set {
+	case CharsetASCII:
+		return mime.QEncoding.Encode(DefaultCharset, s) // Encodes control characters, if any
+	case CharsetUTF8:
+		return mime.QEncoding.Encode(set, s)
+	default:
+		encoded, _ := toCharset(set, s)
+		return mime.QEncoding.Encode(set, encoded)
+	}
+}
+
 func toCharset(set, s string) (string, error) {
 	buf := new(bytes.Buffer)
 	w, err := charset.NewWriter(set, buf)
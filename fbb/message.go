@@ -97,13 +97,20 @@ func init() {
 
 // NewMessage initializes and returns a new message with Type, Mbo, From and Date set.
 //
+// The MID is generated by DefaultMIDGenerator.
+//
 // If the message type t is empty, it defaults to Private.
 func NewMessage(t MsgType, mycall string) *Message {
+	return NewMessageWithMIDGenerator(t, mycall, DefaultMIDGenerator)
+}
+
+// NewMessageWithMIDGenerator is like NewMessage, but the MID is generated by gen.
+func NewMessageWithMIDGenerator(t MsgType, mycall string, gen MIDGenerator) *Message {
 	msg := &Message{
 		Header: make(Header),
 	}
 
-	msg.Header.Set(HEADER_MID, GenerateMid(mycall))
+	msg.Header.Set(HEADER_MID, gen.GenerateMID(mycall))
 
 	msg.SetDate(time.Now())
 	msg.SetFrom(mycall)
@@ -117,6 +124,25 @@ func NewMessage(t MsgType, mycall string) *Message {
 	return msg
 }
 
+// RegenerateMID replaces the MID of the message with a new one from gen.
+//
+// If gen is a ContentMIDGenerator (like DefaultMIDGenerator), the current
+// content of the message is mixed into the MID. It's intended to be called
+// once the message is composed, before it's added to an outbox.
+func (m *Message) RegenerateMID(gen MIDGenerator) error {
+	cgen, ok := gen.(ContentMIDGenerator)
+	if !ok {
+		m.Header.Set(HEADER_MID, gen.GenerateMID(m.From().Addr))
+		return nil
+	}
+	content, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+	m.Header.Set(HEADER_MID, cgen.GenerateContentMID(m.From().Addr, content))
+	return nil
+}
+
 // Validate returns an error if this message violates any Winlink Message Structure constraints
 func (m *Message) Validate() error {
 	switch {
@@ -156,13 +182,9 @@ func (m *Message) MID() string { return m.Header.Get(HEADER_MID) }
 
 // SetSubject sets this message's subject field.
 //
-// The Winlink Message Format only allow ASCII characters. Words containing non-ASCII characters are Q-encoded with DefaultCharset (as defined by RFC 2047).
-func (m *Message) SetSubject(str string) {
-	encoded, _ := toCharset(DefaultCharset, str)
-	encoded = mime.QEncoding.Encode(DefaultCharset, encoded)
-
-	m.Header.Set(HEADER_SUBJECT, encoded)
-}
+// The Winlink Message Format only allow ASCII characters. Words containing non-ASCII characters are Q-encoded (as defined by RFC 2047)
+// with the charset selected by SelectCharset.
+func (m *Message) SetSubject(str string) { m.Header.Set(HEADER_SUBJECT, encodeWord(str)) }
 
 // Subject returns this message's subject header decoded using WordDecoder.
 func (m *Message) Subject() string {
@@ -179,7 +201,13 @@ func (m *Message) Type() MsgType { return MsgType(m.Header.Get(HEADER_TYPE)) }
 func (m *Message) Mbo() string { return m.Header.Get(HEADER_MBO) }
 
 // Body returns this message's body encoded as utf8.
-func (m *Message) Body() (string, error) { return BodyFromBytes(m.body, m.Charset()) }
+//
+// The body is decoded using the charset returned by DetectCharset, as the
+// declared charset is not always correct for messages relayed through the
+// Winlink system.
+func (m *Message) Body() (string, error) {
+	return BodyFromBytes(m.body, DetectCharset(m.body, m.Charset()))
+}
 
 // Files returns the message attachments.
 func (m *Message) Files() []*File { return m.files }
@@ -211,29 +239,32 @@ func (m *Message) Date() time.Time {
 // Header field Content-Type is set according to charset.
 // All lines are modified to ensure CRLF.
 //
-// Use SetBody to use default character encoding.
+// A *CharsetError is returned (and the body is left unchanged) if the body
+// contains characters that can not be represented in the given charset.
+//
+// Use SetBody to select the charset automatically.
 func (m *Message) SetBodyWithCharset(charset, body string) error {
+	bytes, err := StringToBody(body, charset)
+	if err != nil {
+		return err
+	}
+
 	m.Header.Set(HEADER_CONTENT_TRANSFER_ENCODING, DefaultTransferEncoding)
 	m.Header.Set(HEADER_CONTENT_TYPE, mime.FormatMediaType(
 		"text/plain",
-		map[string]string{"charset": DefaultCharset},
+		map[string]string{"charset": charset},
 	))
 
-	bytes, err := StringToBody(body, DefaultCharset)
-	if err != nil {
-		return err
-	}
-
 	m.body = bytes
 	m.Header.Set(HEADER_BODY, fmt.Sprintf("%d", len(bytes)))
 	return nil
 }
 
-// SetBody sets the given string as message body using DefaultCharset.
+// SetBody sets the given string as message body using the charset selected by SelectCharset.
 //
 // See SetBodyWithCharset for more info.
 func (m *Message) SetBody(body string) error {
-	return m.SetBodyWithCharset(DefaultCharset, body)
+	return m.SetBodyWithCharset(SelectCharset(body), body)
 }
 
 // BodySize returns the expected size of the body (in bytes) as defined in the header.
@@ -433,11 +464,7 @@ func (m *Message) AddFile(f *File) {
 	m.files = append(m.files, f)
 
 	// According to spec, only ASCII is allowed.
-	encodedName, _ := toCharset(DefaultCharset, f.Name())
-	encodedName = mime.QEncoding.Encode(DefaultCharset, encodedName)
-
-	// Add header
-	m.Header.Add(HEADER_FILE, fmt.Sprintf("%d %s", f.Size(), encodedName))
+	m.Header.Add(HEADER_FILE, fmt.Sprintf("%d %s", f.Size(), encodeWord(f.Name())))
 }
 
 // Bytes returns the message in the Winlink Message format.
@@ -7,15 +7,94 @@ package fbb
 import (
 	"bufio"
 	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/paulrosania/go-charset/charset"
 	_ "github.com/paulrosania/go-charset/data"
 )
 
-// StringToBytes converts the body into a slice of bytes with the given charset encoding.
+// Charsets selected by SelectCharset.
+const (
+	CharsetASCII = "US-ASCII"
+	CharsetUTF8  = "UTF-8"
+)
+
+// CharsetError is returned when a string contains characters that can not be represented in the given charset.
+type CharsetError struct {
+	Charset string
+	Rune    rune // The first character that could not be represented.
+	Offset  int  // The byte offset of Rune in the (CRLF normalized) string.
+}
+
+func (e *CharsetError) Error() string {
+	return fmt.Sprintf("character %q at offset %d can not be represented in %s", e.Rune, e.Offset, e.Charset)
+}
+
+// SelectCharset returns the most compact charset able to represent str.
+//
+// The charsets are tried in order: CharsetASCII, DefaultCharset (ISO-8859-1) and CharsetUTF8.
+func SelectCharset(str string) string {
+	charset := CharsetASCII
+	for _, r := range str {
+		switch {
+		case r < utf8.RuneSelf:
+		case r <= 0xFF:
+			charset = DefaultCharset
+		default:
+			return CharsetUTF8
+		}
+	}
+	return charset
+}
+
+// DetectCharset returns the charset most likely used to encode data, given the declared charset.
+//
+// Messages relayed through the Winlink system are often re-encoded without
+// updating the Content-Type header (or the header is stripped entirely). If
+// data contains non-ASCII characters and is valid UTF-8, it is assumed to be
+// UTF-8 regardless of the declared charset. If the declared charset is UTF-8
+// (or ASCII) but data is not valid UTF-8, DefaultCharset is assumed.
+// Otherwise the declared charset is returned.
+func DetectCharset(data []byte, declared string) string {
+	if isASCII(data) {
+		return declared
+	}
+	if utf8.Valid(data) {
+		return CharsetUTF8
+	}
+	if isCharset(declared, CharsetUTF8, "UTF8", CharsetASCII, "ASCII") {
+		return DefaultCharset
+	}
+	return declared
+}
+
+func isASCII(data []byte) bool {
+	for _, b := range data {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func isCharset(charset string, names ...string) bool {
+	for _, name := range names {
+		if strings.EqualFold(charset, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// StringToBody converts the body into a slice of bytes with the given charset encoding.
 //
 // CRLF line break is enforced.
 // Line break are inserted if a line is longer than 1000 characters (including CRLF).
+//
+// If the body contains characters that can not be represented in the given
+// charset, the (lossy) translated body is returned with a *CharsetError.
 func StringToBody(str, encoding string) ([]byte, error) {
 	in := bufio.NewScanner(bytes.NewBufferString(str))
 	out := new(bytes.Buffer)
@@ -44,7 +123,29 @@ func StringToBody(str, encoding string) ([]byte, error) {
 	}
 
 	_, translated, err := translator.Translate(out.Bytes(), true)
-	return translated, err
+	if err != nil {
+		return translated, err
+	}
+
+	// The translator silently replaces unsupported characters. Verify by round-trip.
+	if decoded, err := BodyFromBytes(translated, encoding); err != nil {
+		return translated, err
+	} else if decoded != out.String() {
+		return translated, charsetError(encoding, out.String(), decoded)
+	}
+	return translated, nil
+}
+
+// charsetError returns a *CharsetError describing the first difference between want and got.
+func charsetError(charset, want, got string) *CharsetError {
+	for i, r := range want {
+		g, _ := utf8.DecodeRuneInString(got)
+		if len(got) == 0 || g != r {
+			return &CharsetError{Charset: charset, Rune: r, Offset: i}
+		}
+		got = got[utf8.RuneLen(g):]
+	}
+	return &CharsetError{Charset: charset, Offset: len(want)}
 }
 
 func min(a, b int) int {
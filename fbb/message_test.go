@@ -163,3 +163,70 @@ func IsIllegalHeader(str string) bool {
 func IsGraphicASCII(c rune) bool {
 	return c <= unicode.MaxASCII && unicode.IsGraphic(c)
 }
+
+func TestSetBodySelectsCharset(t *testing.T) {
+	tests := []struct{ body, charset string }{
+		{"Hello world", CharsetASCII},
+		{"Hilsen fra Bømlo", DefaultCharset},
+		{"Καλημέρα", CharsetUTF8},
+		{"æøå and €", CharsetUTF8},
+	}
+	for _, test := range tests {
+		msg := NewMessage(Private, "N0CALL")
+		if err := msg.SetBody(test.body); err != nil {
+			t.Fatal(err)
+		}
+		if got := msg.Charset(); got != test.charset {
+			t.Errorf("%q: expected charset %s, got %s", test.body, test.charset, got)
+		}
+		if got, _ := msg.Body(); got != test.body+"\r\n" {
+			t.Errorf("%q: body did not survive round trip, got %q", test.body, got)
+		}
+	}
+}
+
+func TestSetBodyWithCharsetReportsLoss(t *testing.T) {
+	msg := NewMessage(Private, "N0CALL")
+	err := msg.SetBodyWithCharset(DefaultCharset, "abc\nΩ")
+	cerr, ok := err.(*CharsetError)
+	if !ok {
+		t.Fatalf("Expected *CharsetError, got %v", err)
+	}
+	if cerr.Rune != 'Ω' || cerr.Offset != 5 {
+		t.Errorf("Unexpected error %#v", cerr)
+	}
+	if msg.BodySize() != 0 {
+		t.Errorf("Body was set despite error")
+	}
+}
+
+func TestBodyCharsetSniffing(t *testing.T) {
+	msg := NewMessage(Private, "N0CALL")
+	msg.SetBody("Καλημέρα")
+
+	// Relayed with the wrong charset declared
+	msg.Header.Set(HEADER_CONTENT_TYPE, "text/plain; charset=ISO-8859-1")
+	if got, _ := msg.Body(); got != "Καλημέρα\r\n" {
+		t.Errorf("UTF-8 body declared as ISO-8859-1 decoded as %q", got)
+	}
+
+	// Latin1 declared as UTF-8
+	msg.SetBodyWithCharset(DefaultCharset, "blåbær")
+	msg.Header.Set(HEADER_CONTENT_TYPE, "text/plain; charset=UTF-8")
+	if got, _ := msg.Body(); got != "blåbær\r\n" {
+		t.Errorf("ISO-8859-1 body declared as UTF-8 decoded as %q", got)
+	}
+}
+
+func TestSubjectCharset(t *testing.T) {
+	for _, subject := range []string{"Hello", "Blåbær", "Καλημέρα"} {
+		msg := NewMessage(Private, "N0CALL")
+		msg.SetSubject(subject)
+		if IsIllegalHeader(msg.Header.Get(HEADER_SUBJECT)) {
+			t.Errorf("Non-ascii character in encoded Subject header")
+		}
+		if got := msg.Subject(); got != subject {
+			t.Errorf("Expected %q, got %q", subject, got)
+		}
+	}
+}
@@ -6,19 +6,213 @@ package fbb
 
 import (
 	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base32"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 )
 
 const MaxMIDLength = 12
 
+// A MIDGenerator generates message IDs for new messages.
+//
+// Implementations must be safe for concurrent use.
+type MIDGenerator interface {
+	// GenerateMID returns a new MID (at most MaxMIDLength characters) for a message created by callsign.
+	GenerateMID(callsign string) string
+}
+
+// MIDGeneratorFunc is an adapter to allow the use of ordinary functions as MIDGenerator.
+type MIDGeneratorFunc func(callsign string) string
+
+func (f MIDGeneratorFunc) GenerateMID(callsign string) string { return f(callsign) }
+
+// A ContentMIDGenerator is a MIDGenerator that can also derive the MID from the message content.
+//
+// See Message.RegenerateMID.
+type ContentMIDGenerator interface {
+	MIDGenerator
+
+	// GenerateContentMID returns a new MID for a message created by callsign with the given (encoded) content.
+	GenerateContentMID(callsign string, content []byte) string
+}
+
+// DefaultMIDGenerator is the MIDGenerator used by NewMessage and GenerateMid.
+//
+// It mixes the callsign and current time with random bytes from crypto/rand,
+// so that it's collision resistant even if the system clock is coarse or wrong.
+// It's a ContentMIDGenerator, so that a hash of the message content is mixed
+// in as well when used with Message.RegenerateMID.
+var DefaultMIDGenerator MIDGenerator = defaultMIDGenerator{}
+
+type defaultMIDGenerator struct{}
+
+func (defaultMIDGenerator) GenerateMID(callsign string) string { return randomMID(callsign) }
+
+func (defaultMIDGenerator) GenerateContentMID(callsign string, content []byte) string {
+	sum := sha256.Sum256(content)
+	return randomMID(callsign, sum[:]...)
+}
+
 // Generates a unique message ID in the format specified by the protocol.
-func GenerateMid(callsign string) string {
-	sum := md5.Sum(midPayload(callsign, time.Now()))
-	return base32.StdEncoding.EncodeToString(sum[0:])[0:MaxMIDLength]
+//
+// See DefaultMIDGenerator.
+func GenerateMid(callsign string) string { return DefaultMIDGenerator.GenerateMID(callsign) }
+
+// randomMID returns a MID derived from the callsign, the current time, random bytes and extra (if any).
+func randomMID(callsign string, extra ...byte) string {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		// Should never happen, but fall back to time-based MID (better than nothing).
+		nonce = nil
+	}
+	payload := append(midPayload(callsign, time.Now()), nonce...)
+	return encodeMID(append(payload, extra...))
 }
 
 func midPayload(callsign string, t time.Time) []byte {
-	return []byte(fmt.Sprintf("%s-%s", time.Now(), callsign))
+	return []byte(fmt.Sprintf("%s-%s", t.Format(time.RFC3339Nano), callsign))
+}
+
+func encodeMID(payload []byte) string {
+	sum := md5.Sum(payload)
+	return base32.StdEncoding.EncodeToString(sum[0:])[0:MaxMIDLength]
+}
+
+// DeterministicMIDGenerator generates reproducible MIDs, derived from the
+// seed, the callsign and a sequence number.
+//
+// It's intended for tests. The zero value is ready to use.
+type DeterministicMIDGenerator struct {
+	Seed string
+
+	mu  sync.Mutex
+	seq uint64
+}
+
+// NewDeterministicMIDGenerator returns a new DeterministicMIDGenerator with the given seed.
+func NewDeterministicMIDGenerator(seed string) *DeterministicMIDGenerator {
+	return &DeterministicMIDGenerator{Seed: seed}
+}
+
+func (g *DeterministicMIDGenerator) GenerateMID(callsign string) string {
+	g.mu.Lock()
+	g.seq++
+	seq := g.seq
+	g.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s-%s-%d", g.Seed, strings.ToUpper(callsign), seq)))
+	return base32.StdEncoding.EncodeToString(sum[:])[0:MaxMIDLength]
+}
+
+// MIDHistory is implemented by stores that know about previously seen MIDs (e.g. a mailbox).
+type MIDHistory interface {
+	// HasMID reports whether the given MID is known.
+	HasMID(mid string) bool
+}
+
+// DefaultMaxIssued is the number of recently issued MIDs remembered by a UniqueMIDGenerator by default.
+const DefaultMaxIssued = 4096
+
+// UniqueMIDGenerator wraps a MIDGenerator, guaranteeing that the returned MIDs
+// are not found in History and has not recently been returned by this generator.
+//
+// Only the last MaxIssued MIDs are remembered, so that memory use is bounded.
+// Older MIDs are expected to be found in History (e.g. a mailbox's MID history).
+type UniqueMIDGenerator struct {
+	Generator MIDGenerator // If nil, DefaultMIDGenerator is used.
+	History   MIDHistory   // Optional.
+	MaxIssued int          // If zero, DefaultMaxIssued is used.
+
+	mu     sync.Mutex
+	issued map[string]struct{}
+	recent []string // Ring buffer of the issued MIDs, oldest at next.
+	next   int
+}
+
+// NewUniqueMIDGenerator returns a new UniqueMIDGenerator using gen and checking against history.
+func NewUniqueMIDGenerator(gen MIDGenerator, history MIDHistory) *UniqueMIDGenerator {
+	return &UniqueMIDGenerator{Generator: gen, History: history}
+}
+
+// maxUniqueAttempts is the number of MIDs tried from each source before giving up on it.
+const maxUniqueAttempts = 100
+
+// GenerateMID returns a new MID from the underlying generator.
+//
+// If the underlying generator fails to produce a unique MID after 100
+// attempts (implying a broken generator), MIDs are generated from the
+// callsign, the current time and random bytes instead (see DefaultMIDGenerator).
+func (g *UniqueMIDGenerator) GenerateMID(callsign string) string {
+	return g.generate(func(gen MIDGenerator) string { return gen.GenerateMID(callsign) })
+}
+
+// GenerateContentMID is like GenerateMID, but uses GenerateContentMID of the
+// underlying generator if it's a ContentMIDGenerator.
+func (g *UniqueMIDGenerator) GenerateContentMID(callsign string, content []byte) string {
+	return g.generate(func(gen MIDGenerator) string {
+		if cgen, ok := gen.(ContentMIDGenerator); ok {
+			return cgen.GenerateContentMID(callsign, content)
+		}
+		return gen.GenerateMID(callsign)
+	})
+}
+
+func (g *UniqueMIDGenerator) generate(next func(gen MIDGenerator) string) string {
+	gen := g.Generator
+	if gen == nil {
+		gen = DefaultMIDGenerator
+	}
+
+	var mid string
+	for _, src := range []MIDGenerator{gen, defaultMIDGenerator{}} {
+		for i := 0; i < maxUniqueAttempts; i++ {
+			if mid = next(src); g.unique(mid) {
+				return mid
+			}
+		}
+	}
+	// Only possible if History reports every MID as known. The random MID is
+	// unique with overwhelming probability, so use it anyway.
+	return mid
+}
+
+// unique reports whether mid has not been issued before, nor is found in History.
+//
+// The MID is reserved (remembered as issued) before History is consulted
+// without holding g.mu, so that a slow History does not block other callers,
+// and concurrent callers can't be given the same MID.
+func (g *UniqueMIDGenerator) unique(mid string) bool {
+	g.mu.Lock()
+	_, dup := g.issued[mid]
+	if !dup {
+		g.remember(mid)
+	}
+	g.mu.Unlock()
+	if dup {
+		return false
+	}
+	return g.History == nil || !g.History.HasMID(mid)
+}
+
+// remember adds mid to the issued MIDs, forgetting the oldest if full. The caller must hold g.mu.
+func (g *UniqueMIDGenerator) remember(mid string) {
+	max := g.MaxIssued
+	if max <= 0 {
+		max = DefaultMaxIssued
+	}
+	if g.issued == nil {
+		g.issued = make(map[string]struct{})
+	}
+	if len(g.recent) < max {
+		g.recent = append(g.recent, mid)
+	} else {
+		delete(g.issued, g.recent[g.next])
+		g.recent[g.next] = mid
+		g.next = (g.next + 1) % len(g.recent)
+	}
+	g.issued[mid] = struct{}{}
 }
@@ -0,0 +1,168 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package fbb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMIDPayloadUsesTime(t *testing.T) {
+	t1 := time.Date(2016, 12, 30, 1, 0, 0, 0, time.UTC)
+	if string(midPayload("N0CALL", t1)) == string(midPayload("N0CALL", t1.Add(time.Second))) {
+		t.Error("midPayload ignores time argument")
+	}
+}
+
+func TestGenerateMidUnique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 10000; i++ {
+		mid := GenerateMid("N0CALL")
+		if len(mid) != MaxMIDLength {
+			t.Fatalf("Unexpected MID length: %q", mid)
+		}
+		if seen[mid] {
+			t.Fatalf("Duplicate MID after %d iterations", i)
+		}
+		seen[mid] = true
+	}
+}
+
+func TestDeterministicMIDGenerator(t *testing.T) {
+	a, b := NewDeterministicMIDGenerator("seed"), NewDeterministicMIDGenerator("seed")
+	for i := 0; i < 3; i++ {
+		if x, y := a.GenerateMID("N0CALL"), b.GenerateMID("n0call"); x != y {
+			t.Errorf("%d: %q != %q", i, x, y)
+		}
+	}
+	if a.GenerateMID("N0CALL") == a.GenerateMID("N0CALL") {
+		t.Error("Expected different MIDs for consecutive calls")
+	}
+
+	msg := NewMessageWithMIDGenerator(Private, "N0CALL", NewDeterministicMIDGenerator("seed"))
+	if msg.MID() != NewDeterministicMIDGenerator("seed").GenerateMID("N0CALL") {
+		t.Error("NewMessageWithMIDGenerator did not use the given generator")
+	}
+}
+
+type midSet map[string]bool
+
+func (s midSet) HasMID(mid string) bool { return s[mid] }
+
+func TestUniqueMIDGenerator(t *testing.T) {
+	// A broken generator alternating between two MIDs, where the first is already in use.
+	var n int
+	broken := MIDGeneratorFunc(func(string) string {
+		n++
+		if n%2 == 0 {
+			return "AAAAAAAAAAAA"
+		}
+		return "BBBBBBBBBBBB"
+	})
+
+	g := NewUniqueMIDGenerator(broken, midSet{"BBBBBBBBBBBB": true})
+	if mid := g.GenerateMID("N0CALL"); mid != "AAAAAAAAAAAA" {
+		t.Errorf("Got MID found in history: %s", mid)
+	}
+
+	// Falls back to random MIDs instead of failing
+	mid := g.GenerateMID("N0CALL")
+	if mid == "AAAAAAAAAAAA" || mid == "BBBBBBBBBBBB" || len(mid) != MaxMIDLength {
+		t.Errorf("Expected random fallback MID, got %s", mid)
+	}
+}
+
+func TestUniqueMIDGeneratorBounded(t *testing.T) {
+	g := &UniqueMIDGenerator{Generator: NewDeterministicMIDGenerator("seed"), MaxIssued: 10}
+	for i := 0; i < 100; i++ {
+		g.GenerateMID("N0CALL")
+	}
+	if len(g.issued) != 10 || len(g.recent) != 10 {
+		t.Errorf("Expected 10 remembered MIDs, got %d (%d)", len(g.issued), len(g.recent))
+	}
+	if _, ok := g.issued[g.recent[(g.next+9)%10]]; !ok {
+		t.Errorf("Most recent MID forgotten")
+	}
+}
+
+// blockingHistory blocks HasMID until release is closed.
+type blockingHistory struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (h blockingHistory) HasMID(mid string) bool {
+	select {
+	case h.entered <- struct{}{}:
+		<-h.release
+	default:
+	}
+	return false
+}
+
+func TestUniqueMIDGeneratorHistoryUnlocked(t *testing.T) {
+	history := blockingHistory{entered: make(chan struct{}), release: make(chan struct{})}
+	g := NewUniqueMIDGenerator(nil, history)
+
+	first := make(chan string)
+	go func() { first <- g.GenerateMID("N0CALL") }()
+	<-history.entered
+
+	// Another caller is not blocked by the slow history check of the first
+	done := make(chan string)
+	go func() { done <- g.GenerateMID("N0CALL") }()
+	var second string
+	select {
+	case second = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("GenerateMID blocked by a concurrent History check")
+	}
+	close(history.release)
+	if mid := <-first; mid == second {
+		t.Errorf("Concurrent callers got the same MID %s", mid)
+	}
+}
+
+// contentRecorder is a ContentMIDGenerator recording the content it's given.
+type contentRecorder struct{ content []byte }
+
+func (r *contentRecorder) GenerateMID(callsign string) string { return "NOCONTENT" }
+
+func (r *contentRecorder) GenerateContentMID(callsign string, content []byte) string {
+	r.content = content
+	return "CONTENT"
+}
+
+func TestRegenerateMID(t *testing.T) {
+	msg := NewMessage(Private, "N0CALL")
+	msg.AddTo("LA5NTA")
+	msg.SetSubject("Test")
+	msg.SetBody("Hello world")
+
+	rec := &contentRecorder{}
+	if err := msg.RegenerateMID(NewUniqueMIDGenerator(rec, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if msg.MID() != "CONTENT" || !bytes.Contains(rec.content, []byte("Hello world")) {
+		t.Errorf("Expected MID derived from content, got %s (%q)", msg.MID(), rec.content)
+	}
+
+	// The default generator mixes in the content, and the random bytes
+	a, b := *msg, *msg
+	a.Header, b.Header = make(Header), make(Header)
+	for k, v := range msg.Header {
+		a.Header[k], b.Header[k] = v, v
+	}
+	if err := a.RegenerateMID(DefaultMIDGenerator); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RegenerateMID(DefaultMIDGenerator); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.MID()) != MaxMIDLength || a.MID() == b.MID() || a.MID() == msg.MID() {
+		t.Errorf("Unexpected MIDs %s and %s", a.MID(), b.MID())
+	}
+}
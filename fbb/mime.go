@@ -0,0 +1,430 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package fbb
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/paulrosania/go-charset/charset"
+)
+
+// Headers used to preserve Winlink specific fields when a message is converted to MIME.
+const (
+	HEADER_X_WINLINK_MID  = `X-Winlink-Mid`
+	HEADER_X_WINLINK_TYPE = `X-Winlink-Type`
+	HEADER_X_WINLINK_MBO  = `X-Winlink-Mbo`
+)
+
+// winlinkDomain is the domain of Winlink (callsign) addresses in the MIME representation.
+const winlinkDomain = "winlink.org"
+
+// MIMEAddress returns the Internet mail representation of the address.
+//
+// Winlink addresses are suffixed with @winlink.org.
+func (a Address) MIMEAddress() string {
+	if a.Proto == "" {
+		return a.Addr + "@" + winlinkDomain
+	}
+	return a.Addr
+}
+
+// WriteMIME writes the message to w as an Internet (RFC 5322) mail message.
+//
+// The body is encoded as UTF-8 quoted-printable. Attachments are added as
+// base64 encoded MIME parts of a multipart/mixed message. The MID, Type and
+// Mbo header fields are preserved as X-Winlink-* header fields, and all other
+// custom (X-) header fields are copied as is.
+func (m *Message) WriteMIME(w io.Writer) error {
+	date, err := ParseDate(m.Header.Get(HEADER_DATE))
+	if err != nil {
+		return err
+	}
+	body, err := m.Body()
+	if err != nil {
+		return err
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Message-Id", "<"+m.MID()+"@"+winlinkDomain+">")
+	h.Set("Date", date.Format(time.RFC1123Z))
+	h.Set("From", m.From().MIMEAddress())
+	if to := mimeAddressList(m.To()); to != "" {
+		h.Set("To", to)
+	}
+	if cc := mimeAddressList(m.Cc()); cc != "" {
+		h.Set("Cc", cc)
+	}
+	h.Set("Subject", mime.QEncoding.Encode(CharsetUTF8, m.Subject()))
+	if parent := m.InReplyTo(); parent != "" {
+		h.Set("In-Reply-To", "<"+parent+"@"+winlinkDomain+">")
+	}
+	h.Set("Mime-Version", "1.0")
+	h.Set(HEADER_X_WINLINK_MID, m.MID())
+	h.Set(HEADER_X_WINLINK_TYPE, string(m.Type()))
+	h.Set(HEADER_X_WINLINK_MBO, m.Mbo())
+	for key, values := range m.Header {
+		if strings.HasPrefix(key, "X-") {
+			h[key] = values
+		}
+	}
+
+	textHeader := textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType("text/plain", map[string]string{"charset": CharsetUTF8})},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	}
+
+	bw := bufio.NewWriter(w)
+	if len(m.Files()) == 0 {
+		for key, values := range textHeader {
+			h[key] = values
+		}
+		writeMIMEHeader(bw, h)
+		if err := writeQuotedPrintable(bw, body); err != nil {
+			return err
+		}
+		return bw.Flush()
+	}
+
+	var parts bytes.Buffer
+	mw := multipart.NewWriter(&parts)
+	h.Set("Content-Type", mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()}))
+	writeMIMEHeader(bw, h)
+
+	pw, err := mw.CreatePart(textHeader)
+	if err != nil {
+		return err
+	}
+	if err := writeQuotedPrintable(pw, body); err != nil {
+		return err
+	}
+
+	for _, f := range m.Files() {
+		contentType := mime.TypeByExtension(path.Ext(f.Name()))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": f.Name()})},
+		})
+		if err != nil {
+			return err
+		}
+		if err := writeBase64(pw, f.data); err != nil {
+			return err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	bw.Write(parts.Bytes())
+	return bw.Flush()
+}
+
+// MIME returns the message as an Internet (RFC 5322) mail message. See WriteMIME.
+func (m *Message) MIME() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := m.WriteMIME(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func mimeAddressList(addrs []Address) string {
+	strs := make([]string, len(addrs))
+	for i, a := range addrs {
+		strs[i] = a.MIMEAddress()
+	}
+	return strings.Join(strs, ", ")
+}
+
+func writeMIMEHeader(w *bufio.Writer, h textproto.MIMEHeader) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			fmt.Fprintf(w, "%s: %s\r\n", k, v)
+		}
+	}
+	w.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, body); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := io.WriteString(w, encoded+"\r\n")
+	return err
+}
+
+// ReadMIME reads an Internet (RFC 5322) mail message from r and converts it to a Message.
+//
+// This is the inverse of WriteMIME. The MID is taken from the X-Winlink-Mid
+// header field if present. Otherwise it's derived from the Message-Id header
+// field, or from a hash of the mail if it has no Message-Id, so that
+// converting the same mail twice yields the same MID. The first
+// text/plain part is used as the body, all other parts are added as attachments.
+func ReadMIME(r io.Reader) (*Message, error) {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	mm, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	dec := mimeWordDecoder()
+	msg := &Message{Header: make(Header)}
+
+	mid := mm.Header.Get(HEADER_X_WINLINK_MID)
+	if mid == "" {
+		mid = midFromMessageID(mm.Header.Get("Message-Id"))
+	}
+	if mid == "" {
+		mid = midFromHash(raw)
+	}
+	msg.Header.Set(HEADER_MID, mid)
+
+	if date, err := mm.Header.Date(); err == nil {
+		msg.SetDate(date)
+	} else {
+		msg.SetDate(time.Now())
+	}
+
+	from, err := parseMIMEAddresses(mm.Header.Get("From"))
+	if err != nil || len(from) == 0 {
+		return nil, fmt.Errorf("invalid From header: %v", err)
+	}
+	msg.SetFrom(from[0])
+	for _, key := range []string{"To", "Cc"} {
+		addrs, err := parseMIMEAddresses(strings.Join(mm.Header[key], ", "))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", key, err)
+		}
+		for _, a := range addrs {
+			msg.Header.Add(key, AddressFromString(a).String())
+		}
+	}
+
+	subject, _ := dec.DecodeHeader(mm.Header.Get("Subject"))
+	msg.SetSubject(subject)
+
+	msgType := MsgType(mm.Header.Get(HEADER_X_WINLINK_TYPE))
+	if msgType == "" {
+		msgType = Private
+	}
+	msg.Header.Set(HEADER_TYPE, string(msgType))
+
+	mbo := mm.Header.Get(HEADER_X_WINLINK_MBO)
+	if mbo == "" {
+		mbo = msg.From().Addr
+	}
+	msg.Header.Set(HEADER_MBO, mbo)
+
+	for key, values := range mm.Header {
+		key = textproto.CanonicalMIMEHeaderKey(key)
+		switch {
+		case !strings.HasPrefix(key, "X-"):
+		case key == HEADER_X_WINLINK_MID, key == HEADER_X_WINLINK_TYPE, key == HEADER_X_WINLINK_MBO:
+		default:
+			msg.Header[key] = values
+		}
+	}
+	if parent := midFromMessageID(mm.Header.Get("In-Reply-To")); parent != "" && msg.InReplyTo() == "" {
+		msg.Header.Set(HEADER_X_IN_REPLY_TO, parent)
+	}
+
+	var body *string
+	err = walkMIMEParts(textproto.MIMEHeader(mm.Header), mm.Body, func(h textproto.MIMEHeader, data []byte) error {
+		mediaType, params, _ := mime.ParseMediaType(h.Get("Content-Type"))
+		_, dparams, _ := mime.ParseMediaType(h.Get("Content-Disposition"))
+
+		filename, _ := dec.DecodeHeader(dparams["filename"])
+		if filename == "" {
+			filename, _ = dec.DecodeHeader(params["name"])
+		}
+
+		if body == nil && filename == "" && (mediaType == "" || mediaType == "text/plain") {
+			str, err := BodyFromBytes(data, DetectCharset(data, defaultString(params["charset"], CharsetASCII)))
+			if err != nil {
+				return err
+			}
+			body = &str
+			return nil
+		}
+
+		if filename == "" {
+			ext, _ := mime.ExtensionsByType(mediaType)
+			filename = fmt.Sprintf("attachment-%d", len(msg.files)+1)
+			if len(ext) > 0 {
+				filename += ext[0]
+			}
+		}
+		msg.AddFile(NewFile(path.Base(filename), data))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if body == nil {
+		body = new(string)
+	}
+	if err := msg.SetBody(*body); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// walkMIMEParts calls fn with the decoded content of every leaf part of the given entity.
+func walkMIMEParts(h textproto.MIMEHeader, r io.Reader, fn func(textproto.MIMEHeader, []byte) error) error {
+	mediaType, params, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := walkMIMEParts(p.Header, p, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(h.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: r})
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return fn(h, data)
+}
+
+// newlineStripper removes CR and LF from the underlying reader (for base64 decoding).
+type newlineStripper struct{ r io.Reader }
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		c, err := n.r.Read(p)
+		j := 0
+		for _, b := range p[:c] {
+			if b != '\r' && b != '\n' {
+				p[j] = b
+				j++
+			}
+		}
+		if j > 0 || err != nil {
+			return j, err
+		}
+	}
+}
+
+// midFromMessageID returns the MID part of a Message-Id (as produced by WriteMIME).
+//
+// If the local part is not a valid MID, a MID is derived from the full
+// Message-Id. An empty string is returned if msgID is empty.
+func midFromMessageID(msgID string) string {
+	msgID = strings.Trim(strings.TrimSpace(msgID), "<>")
+	if msgID == "" {
+		return ""
+	}
+	if local, domain, ok := strings.Cut(msgID, "@"); ok && strings.EqualFold(domain, winlinkDomain) && isMID(local) {
+		return local
+	}
+	return midFromHash([]byte(msgID))
+}
+
+// isMID returns true if str is a non-empty string of at most MaxMIDLength letters, digits, '-' and '_'.
+func isMID(str string) bool {
+	if str == "" || len(str) > MaxMIDLength {
+		return false
+	}
+	for _, r := range str {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// midFromHash returns a MID derived from the SHA-256 hash of data.
+func midFromHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return base32.StdEncoding.EncodeToString(sum[:])[:MaxMIDLength]
+}
+
+func parseMIMEAddresses(str string) ([]string, error) {
+	if strings.TrimSpace(str) == "" {
+		return nil, nil
+	}
+	parser := mail.AddressParser{WordDecoder: mimeWordDecoder()}
+	list, err := parser.ParseList(str)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, len(list))
+	for i, a := range list {
+		addrs[i] = a.Address
+	}
+	return addrs, nil
+}
+
+func mimeWordDecoder() *mime.WordDecoder {
+	return &mime.WordDecoder{
+		CharsetReader: func(set string, input io.Reader) (io.Reader, error) {
+			return charset.NewReader(set, input)
+		},
+	}
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -0,0 +1,146 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package fbb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMIMERoundTrip(t *testing.T) {
+	msg := NewMessage(PositionReport, "LA5NTA")
+	msg.AddTo("N0CALL", "foo@example.com")
+	msg.AddCc("LA1B")
+	msg.SetSubject("Hilsen fra Bømlo")
+	msg.SetBody("Line one\r\nΚαλημέρα\r\n")
+	msg.AddFile(NewFile("report.txt", []byte("some data")))
+	msg.AddFile(NewFile("bilde.jpg", bytes.Repeat([]byte{0xff, 0x00}, 100)))
+	msg.Header.Set(HEADER_X_THREAD, "ABCDEFGHIJKL")
+	msg.SetDate(time.Date(2016, 12, 30, 1, 0, 0, 0, time.UTC))
+
+	data, err := msg.MIME()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []string{
+		"From: LA5NTA@winlink.org\r\n",
+		"To: N0CALL@winlink.org, foo@example.com\r\n",
+		"X-Winlink-Mid: " + msg.MID() + "\r\n",
+		"X-Winlink-Type: Position Report\r\n",
+		"X-Thread: ABCDEFGHIJKL\r\n",
+	} {
+		if !bytes.Contains(data, []byte(expect)) {
+			t.Errorf("Missing %q in MIME output", expect)
+		}
+	}
+
+	got, err := ReadMIME(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.MID() != msg.MID() || got.Type() != msg.Type() || !got.Date().Equal(msg.Date()) {
+		t.Errorf("MID, type or date not preserved: %s %s %s", got.MID(), got.Type(), got.Date())
+	}
+	if got.Subject() != msg.Subject() {
+		t.Errorf("Unexpected subject %q", got.Subject())
+	}
+	if got.Header.Get(HEADER_X_THREAD) != "ABCDEFGHIJKL" {
+		t.Errorf("X- header not preserved")
+	}
+	gotBody, _ := got.Body()
+	msgBody, _ := msg.Body()
+	if gotBody != msgBody {
+		t.Errorf("Body differs: %q != %q", gotBody, msgBody)
+	}
+	if len(got.Receivers()) != 3 || got.From() != msg.From() {
+		t.Errorf("Unexpected addresses: %v %v", got.From(), got.Receivers())
+	}
+	if len(got.Files()) != 2 {
+		t.Fatalf("Expected 2 attachments, got %d", len(got.Files()))
+	}
+	for i, f := range got.Files() {
+		if f.Name() != msg.Files()[i].Name() || !bytes.Equal(f.Data(), msg.Files()[i].Data()) {
+			t.Errorf("Attachment %d differs", i)
+		}
+	}
+}
+
+func TestReadMIMEFromMailClient(t *testing.T) {
+	raw := strings.Join([]string{
+		"From: Martin <la5nta@winlink.org>",
+		"To: n0call@winlink.org",
+		"Subject: =?ISO-8859-1?Q?bl=E5b=E6r?=",
+		"Date: Fri, 30 Dec 2016 01:00:00 +0000",
+		"Message-ID: <20161230010000.GA1234@laptop>",
+		"Content-Type: text/plain; charset=iso-8859-1",
+		"Content-Transfer-Encoding: 8bit",
+		"",
+		"Hei p\xe5 deg",
+		"",
+	}, "\r\n")
+
+	msg, err := ReadMIME(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.MID()) != MaxMIDLength {
+		t.Errorf("Unexpected MID %q", msg.MID())
+	}
+	if again, _ := ReadMIME(strings.NewReader(raw)); again.MID() != msg.MID() {
+		t.Errorf("MID is not stable")
+	}
+	if msg.From().Addr != "LA5NTA" || msg.To()[0].Addr != "N0CALL" {
+		t.Errorf("Unexpected addresses %v %v", msg.From(), msg.To())
+	}
+	if msg.Subject() != "blåbær" {
+		t.Errorf("Unexpected subject %q", msg.Subject())
+	}
+	if body, _ := msg.Body(); body != "Hei på deg\r\n" {
+		t.Errorf("Unexpected body %q", body)
+	}
+	if err := msg.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// Mail without a Message-Id gets a MID derived from its content
+	noID := strings.Replace(raw, "Message-ID: <20161230010000.GA1234@laptop>\r\n", "", 1)
+	a, err := ReadMIME(strings.NewReader(noID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ReadMIME(strings.NewReader(noID))
+	other, _ := ReadMIME(strings.NewReader(strings.Replace(noID, "Hei", "Hallo", 1)))
+	switch {
+	case len(a.MID()) != MaxMIDLength || a.MID() == msg.MID():
+		t.Errorf("Unexpected MID %q", a.MID())
+	case b.MID() != a.MID():
+		t.Errorf("MID is not stable")
+	case other.MID() == a.MID():
+		t.Errorf("Expected different MID for different content")
+	}
+}
+
+func TestMIDFromMessageID(t *testing.T) {
+	tests := map[string]string{
+		"<ABC123_X@winlink.org>": "ABC123_X",
+		"ABC123@WINLINK.ORG":     "ABC123",
+		"":                       "",
+	}
+	for msgID, expect := range tests {
+		if got := midFromMessageID(msgID); got != expect {
+			t.Errorf("%q: Expected %q, got %q", msgID, expect, got)
+		}
+	}
+
+	// Local parts that are not safe as MIDs are replaced by a hash of the Message-Id
+	for _, msgID := range []string{"<../../x@winlink.org>", "<a/b@winlink.org>", "<a.b@winlink.org>", "<@winlink.org>", "<TOOLONGMESSAGEID@winlink.org>"} {
+		mid := midFromMessageID(msgID)
+		if len(mid) != MaxMIDLength || strings.ContainsAny(mid, "./") {
+			t.Errorf("%q: Unexpected MID %q", msgID, mid)
+		}
+	}
+}
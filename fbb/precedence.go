@@ -0,0 +1,51 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package fbb
+
+import "strings"
+
+// Precedence is the priority level of a message, as encoded in the subject.
+//
+// Lower value is more important and should be handled sooner.
+//
+// See https://www.winlink.org/content/how_use_message_precedence_precedence.
+type Precedence int
+
+const (
+	PrecedenceFlash     Precedence = iota // //WL2K Z/
+	PrecedenceImmediate                   // //WL2K O/
+	PrecedencePriority                    // //WL2K P/
+	PrecedenceRoutine                     // //WL2K R/ or no precedence marker
+)
+
+func (p Precedence) String() string {
+	switch p {
+	case PrecedenceFlash:
+		return "Flash"
+	case PrecedenceImmediate:
+		return "Immediate"
+	case PrecedencePriority:
+		return "Priority"
+	default:
+		return "Routine"
+	}
+}
+
+// PrecedenceFromSubject returns the precedence encoded in the given message subject.
+func PrecedenceFromSubject(subject string) Precedence {
+	switch {
+	case strings.Contains(subject, "//WL2K Z/"):
+		return PrecedenceFlash
+	case strings.Contains(subject, "//WL2K O/"):
+		return PrecedenceImmediate
+	case strings.Contains(subject, "//WL2K P/"):
+		return PrecedencePriority
+	default:
+		return PrecedenceRoutine
+	}
+}
+
+// Precedence returns the precedence of this message.
+func (m *Message) Precedence() Precedence { return PrecedenceFromSubject(m.Subject()) }
@@ -108,6 +108,11 @@ func (p *Proposal) Title() string {
 	return p.title
 }
 
+// Size returns the size of the uncompressed message, as announced by the proposal.
+func (p *Proposal) Size() int {
+	return p.size
+}
+
 func (p *Proposal) Message() (*Message, error) {
 	buf := bytes.NewBuffer(p.Data())
 	m := new(Message)
@@ -198,23 +203,4 @@ func parseB2Proposal(line string, prop *Proposal) (err error) {
 
 // precedence returns the priority level of the message. Lower precedence value is more important
 // and should be handled sooner.
-//
-// See https://www.winlink.org/content/how_use_message_precedence_precedence.
-func (p *Proposal) precedence() int {
-	const (
-		Flash = iota
-		Immediate
-		Priority
-		Routine
-	)
-	switch {
-	case strings.Contains(p.title, "//WL2K Z/"):
-		return Flash
-	case strings.Contains(p.title, "//WL2K O/"):
-		return Immediate
-	case strings.Contains(p.title, "//WL2K P/"):
-		return Priority
-	default:
-		return Routine
-	}
-}
+func (p *Proposal) precedence() int { return int(PrecedenceFromSubject(p.title)) }
@@ -0,0 +1,288 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package fbb
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// HEADER_X_SIGNATURE holds a detached Ed25519 signature of the message.
+//
+// The value has the format "ed25519 <key id> <base64 signature>".
+//
+// Signing is not encryption: the message content is still sent in the clear
+// as required by the Winlink rules, the signature only proves who wrote it.
+const HEADER_X_SIGNATURE = `X-Signature`
+
+const signatureAlgorithm = "ed25519"
+
+// SignatureStatus is the result of a signature verification.
+type SignatureStatus int
+
+const (
+	SignatureMissing    SignatureStatus = iota // The message is not signed.
+	SignatureValid                             // The signature is valid and made by a key in the keyring.
+	SignatureInvalid                           // The signature does not match the message content.
+	SignatureUnknownKey                        // The signature is made by a key not found in the keyring.
+)
+
+func (s SignatureStatus) String() string {
+	switch s {
+	case SignatureMissing:
+		return "missing"
+	case SignatureValid:
+		return "valid"
+	case SignatureInvalid:
+		return "invalid"
+	case SignatureUnknownKey:
+		return "unknown key"
+	default:
+		return fmt.Sprintf("SignatureStatus(%d)", int(s))
+	}
+}
+
+// Verification holds the result of Message.VerifySignature.
+type Verification struct {
+	Status SignatureStatus
+	KeyID  string
+
+	// The callsign associated with the key in the keyring (if known).
+	//
+	// Note that this is not necessarily the same as the message's From
+	// address, it's up to the application to decide whether the signer
+	// is authorized to send on behalf of the sender.
+	Signer string
+}
+
+// KeyID returns the key id of the given public key.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return base32.StdEncoding.EncodeToString(sum[:10])
+}
+
+// Sign signs the message with the given private key.
+//
+// The signature covers the MID, Date, From, To, Cc, Subject and Type header
+// fields, the body and all attachments. Any change to these after signing
+// invalidates the signature.
+func (m *Message) Sign(priv ed25519.PrivateKey) error {
+	data, err := m.signedBytes()
+	if err != nil {
+		return err
+	}
+
+	pub, ok := priv.Public().(ed25519.PublicKey)
+	if !ok {
+		return errors.New("invalid private key")
+	}
+
+	sig := ed25519.Sign(priv, data)
+	m.Header.Set(HEADER_X_SIGNATURE, fmt.Sprintf("%s %s %s",
+		signatureAlgorithm, KeyID(pub), base64.StdEncoding.EncodeToString(sig),
+	))
+	return nil
+}
+
+// VerifySignature verifies the message signature against the keys in keyring.
+func (m *Message) VerifySignature(keyring *Keyring) (Verification, error) {
+	var v Verification
+
+	value := m.Header.Get(HEADER_X_SIGNATURE)
+	if value == "" {
+		return v, nil
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) != 3 || !strings.EqualFold(fields[0], signatureAlgorithm) {
+		v.Status = SignatureInvalid
+		return v, fmt.Errorf("malformed %s header", HEADER_X_SIGNATURE)
+	}
+	v.KeyID = fields[1]
+
+	sig, err := base64.StdEncoding.DecodeString(fields[2])
+	if err != nil {
+		v.Status = SignatureInvalid
+		return v, fmt.Errorf("malformed signature: %w", err)
+	}
+
+	key, ok := keyring.Lookup(v.KeyID)
+	if !ok {
+		v.Status = SignatureUnknownKey
+		return v, nil
+	}
+	v.Signer = key.Callsign
+
+	data, err := m.signedBytes()
+	if err != nil {
+		v.Status = SignatureInvalid
+		return v, err
+	}
+
+	if ed25519.Verify(key.Key, data, sig) {
+		v.Status = SignatureValid
+	} else {
+		v.Status = SignatureInvalid
+	}
+	return v, nil
+}
+
+// signedBytes returns the canonical representation of the message used for signing.
+//
+// The representation is designed to survive the reformatting done by the
+// Winlink system: Header names are case-insensitive, whitespace in header
+// values is collapsed, the subject is decoded, addresses are normalized and
+// sorted, the date is re-formatted and the body is compared as decoded text
+// with normalized line endings and trailing whitespace removed.
+func (m *Message) signedBytes() ([]byte, error) {
+	date, err := ParseDate(m.Header.Get(HEADER_DATE))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := m.Body()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeField := func(key, value string) {
+		fmt.Fprintf(&buf, "%s:%s\n", key, strings.Join(strings.Fields(value), " "))
+	}
+	writeAddrs := func(key string, addrs []Address) {
+		strs := make([]string, len(addrs))
+		for i, a := range addrs {
+			strs[i] = a.String()
+		}
+		sort.Strings(strs)
+		for _, s := range strs {
+			writeField(key, s)
+		}
+	}
+
+	writeField("mid", m.MID())
+	writeField("date", date.UTC().Format(DateLayout))
+	writeField("from", m.From().String())
+	writeAddrs("to", m.To())
+	writeAddrs("cc", m.Cc())
+	writeField("subject", m.Subject())
+	writeField("type", string(m.Type()))
+	writeField("body", sha256Hex([]byte(canonicalBody(body))))
+	for _, f := range m.Files() {
+		if f.err != nil {
+			return nil, f.err
+		}
+		writeField("file", fmt.Sprintf("%d %s %s", f.Size(), sha256Hex(f.data), f.Name()))
+	}
+
+	return buf.Bytes(), nil
+}
+
+func canonicalBody(body string) string {
+	lines := strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t\r")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+func sha256Hex(p []byte) string {
+	sum := sha256.Sum256(p)
+	return hex.EncodeToString(sum[:])
+}
+
+// PublicKey is a known station's public signing key.
+type PublicKey struct {
+	Callsign string
+	Key      ed25519.PublicKey
+}
+
+// Keyring is a set of trusted public keys, indexed by key id.
+type Keyring struct {
+	keys map[string]PublicKey
+}
+
+// NewKeyring returns a new empty keyring.
+func NewKeyring() *Keyring { return &Keyring{keys: make(map[string]PublicKey)} }
+
+// Add adds the given public key to the keyring, returning its key id.
+//
+// An error is returned if pub is not an ed25519 public key (ed25519.PublicKeySize bytes).
+func (k *Keyring) Add(callsign string, pub ed25519.PublicKey) (string, error) {
+	if len(pub) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("invalid public key length %d", len(pub))
+	}
+	pub = append(ed25519.PublicKey(nil), pub...) // The caller may re-use the slice
+	id := KeyID(pub)
+	k.keys[id] = PublicKey{Callsign: strings.ToUpper(callsign), Key: pub}
+	return id, nil
+}
+
+// Lookup returns the public key identified by the given key id.
+func (k *Keyring) Lookup(id string) (PublicKey, bool) {
+	if k == nil {
+		return PublicKey{}, false
+	}
+	key, ok := k.keys[id]
+	return key, ok
+}
+
+// ReadKeyring reads a keyring from r.
+//
+// The format is one key per line: "<callsign> <base64 public key>".
+// Empty lines and lines starting with # are ignored.
+func ReadKeyring(r io.Reader) (*Keyring, error) {
+	k := NewKeyring()
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected callsign and key", n)
+		}
+		pub, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid public key", n)
+		}
+		if _, err := k.Add(fields[0], ed25519.PublicKey(pub)); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	return k, scanner.Err()
+}
+
+// WriteTo writes the keyring to w in the format read by ReadKeyring.
+func (k *Keyring) WriteTo(w io.Writer) (int64, error) {
+	ids := make([]string, 0, len(k.keys))
+	for id := range k.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var n int64
+	for _, id := range ids {
+		key := k.keys[id]
+		m, err := fmt.Fprintf(w, "%s %s\n", key.Callsign, base64.StdEncoding.EncodeToString(key.Key))
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package fbb
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func signedTestMessage(t *testing.T) (*Message, *Keyring) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := NewKeyring()
+	if _, err := keyring.Add("la5nta", pub); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := NewMessage(Private, "LA5NTA")
+	msg.AddTo("N0CALL", "LA1B")
+	msg.SetSubject("Evacuation   directive æøå")
+	msg.SetBody("Move to shelter B.\nAcknowledge.")
+	msg.AddFile(NewFile("map.txt", []byte("map data")))
+	if err := msg.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+	return msg, keyring
+}
+
+func TestSignatureRoundTrip(t *testing.T) {
+	msg, keyring := signedTestMessage(t)
+
+	// Simulate CMS reformatting: lower-case header keys and extra whitespace.
+	var buf bytes.Buffer
+	if err := msg.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	raw := strings.Replace(buf.String(), "Subject: ", "subject:   ", 1)
+	raw = strings.Replace(raw, "To: N0CALL", "to: n0call@winlink.org", 1)
+
+	received := new(Message)
+	if err := received.ReadFrom(strings.NewReader(raw)); err != nil {
+		t.Fatal(err)
+	}
+	v, err := received.VerifySignature(keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Status != SignatureValid || v.Signer != "LA5NTA" {
+		t.Errorf("Unexpected verification result: %+v", v)
+	}
+}
+
+func TestSignatureTampered(t *testing.T) {
+	msg, keyring := signedTestMessage(t)
+	msg.SetBody("Stay where you are.")
+
+	if v, _ := msg.VerifySignature(keyring); v.Status != SignatureInvalid {
+		t.Errorf("Expected invalid signature, got %s", v.Status)
+	}
+}
+
+func TestSignatureUnknownKey(t *testing.T) {
+	msg, _ := signedTestMessage(t)
+
+	if v, _ := msg.VerifySignature(NewKeyring()); v.Status != SignatureUnknownKey {
+		t.Errorf("Expected unknown key, got %s", v.Status)
+	}
+	if v, _ := NewMessage(Private, "N0CALL").VerifySignature(nil); v.Status != SignatureMissing {
+		t.Errorf("Expected missing signature, got %s", v.Status)
+	}
+}
+
+func TestKeyringReadWrite(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	k := NewKeyring()
+	id, err := k.Add("N0CALL", pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := k.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("# comment\n\n")
+
+	got, err := ReadKeyring(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := got.Lookup(id); !ok || key.Callsign != "N0CALL" || !key.Key.Equal(pub) {
+		t.Errorf("Key not found after round trip")
+	}
+}
+
+func TestKeyringRejectsInvalidKeys(t *testing.T) {
+	k := NewKeyring()
+	for _, pub := range []ed25519.PublicKey{nil, make(ed25519.PublicKey, ed25519.PublicKeySize-1), make(ed25519.PublicKey, ed25519.PublicKeySize+1)} {
+		if _, err := k.Add("N0CALL", pub); err == nil {
+			t.Errorf("Expected error for key of length %d", len(pub))
+		}
+	}
+
+	short := base64.StdEncoding.EncodeToString(make([]byte, 16))
+	if _, err := ReadKeyring(strings.NewReader("N0CALL " + short + "\n")); err == nil {
+		t.Error("Expected error for short key in keyring file")
+	}
+}
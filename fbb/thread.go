@@ -0,0 +1,178 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package fbb
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Custom headers used to group messages into conversations.
+//
+// These headers are not part of the Winlink Message Structure, and may be
+// stripped by the Winlink system.
+const (
+	// The MID of the message this message is a reply to or a forward of.
+	HEADER_X_IN_REPLY_TO = `X-In-Reply-To`
+
+	// The MID of the first message in the conversation.
+	HEADER_X_THREAD = `X-Thread`
+)
+
+// ThreadID returns the MID of the first message in this message's conversation.
+//
+// If the message is not part of a conversation, the message's own MID is returned.
+func (m *Message) ThreadID() string {
+	if id := m.Header.Get(HEADER_X_THREAD); id != "" {
+		return id
+	}
+	if id := m.Header.Get(HEADER_X_IN_REPLY_TO); id != "" {
+		return id
+	}
+	return m.MID()
+}
+
+// InReplyTo returns the MID of the message this message is a reply to or a forward of.
+func (m *Message) InReplyTo() string { return m.Header.Get(HEADER_X_IN_REPLY_TO) }
+
+// Reply returns a new message replying to m.
+//
+// The subject is prefixed with "Re: " (unless already prefixed), and the
+// original body is quoted. The reply is addressed to the sender of m. If all
+// is true, the reply is also addressed to all other receivers of m except our
+// own addresses: mycall and the given aliases (e.g. tactical addresses or
+// other SSIDs we receive messages for).
+//
+// The reply references m by the X-In-Reply-To and X-Thread headers.
+func (m *Message) Reply(mycall string, all bool, aliases ...string) (*Message, error) {
+	reply := NewMessage(Private, mycall)
+	reply.SetSubject(prefixSubject("Re:", m.Subject()))
+	reply.setThreadHeaders(m)
+
+	seen := map[Address]bool{AddressFromString(mycall): true}
+	for _, alias := range aliases {
+		seen[AddressFromString(alias)] = true
+	}
+	add := func(fn func(...string), addrs ...Address) {
+		for _, a := range addrs {
+			if a.IsZero() || seen[a] {
+				continue
+			}
+			seen[a] = true
+			fn(a.String())
+		}
+	}
+
+	add(reply.AddTo, m.From())
+	if all {
+		add(reply.AddTo, m.To()...)
+		add(reply.AddCc, m.Cc()...)
+	}
+
+	body, _ := m.Body() // Quote whatever we're able to decode
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "\r\n\r\nOn %s, %s wrote:\r\n", m.Header.Get(HEADER_DATE), m.From())
+	for _, line := range splitLines(body) {
+		if strings.HasPrefix(line, ">") {
+			fmt.Fprintf(&buf, ">%s\r\n", line)
+		} else {
+			fmt.Fprintf(&buf, "> %s\r\n", line)
+		}
+	}
+
+	return reply, reply.SetBody(buf.String())
+}
+
+// Forward returns a new message forwarding m.
+//
+// The subject is prefixed with "Fwd: " (unless already prefixed), and the
+// original header summary and body is included in the new body. All attachments
+// are copied to the new message. The returned message has no receivers.
+//
+// The forward references m by the X-In-Reply-To and X-Thread headers.
+func (m *Message) Forward(mycall string) (*Message, error) {
+	fwd := NewMessage(Private, mycall)
+	fwd.SetSubject(prefixSubject("Fwd:", m.Subject()))
+	fwd.setThreadHeaders(m)
+
+	body, _ := m.Body() // Include whatever we're able to decode
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, "\r\n\r\n-------- Forwarded message --------\r\n")
+	fmt.Fprintf(&buf, "Mid: %s\r\n", m.MID())
+	fmt.Fprintf(&buf, "Date: %s\r\n", m.Header.Get(HEADER_DATE))
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From())
+	for _, to := range m.To() {
+		fmt.Fprintf(&buf, "To: %s\r\n", to)
+	}
+	for _, cc := range m.Cc() {
+		fmt.Fprintf(&buf, "Cc: %s\r\n", cc)
+	}
+	fmt.Fprintf(&buf, "Subject: %s\r\n\r\n", m.Subject())
+	buf.WriteString(body)
+
+	for _, f := range m.Files() {
+		fwd.AddFile(NewFile(f.Name(), f.Data()))
+	}
+
+	return fwd, fwd.SetBody(buf.String())
+}
+
+func (m *Message) setThreadHeaders(parent *Message) {
+	m.Header.Set(HEADER_X_IN_REPLY_TO, parent.MID())
+	m.Header.Set(HEADER_X_THREAD, parent.ThreadID())
+}
+
+// prefixSubject returns subject prefixed with prefix, unless it's already prefixed.
+func prefixSubject(prefix, subject string) string {
+	if len(subject) >= len(prefix) && strings.EqualFold(subject[:len(prefix)], prefix) {
+		return subject
+	}
+	return prefix + " " + subject
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimRight(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// Thread is a group of messages belonging to the same conversation.
+type Thread struct {
+	ID       string     // The MID of the first message in the conversation.
+	Messages []*Message // The messages, ordered by date.
+}
+
+// Latest returns the most recent message in the thread.
+func (t Thread) Latest() *Message { return t.Messages[len(t.Messages)-1] }
+
+// GroupThreads groups the given messages into conversations by their ThreadID.
+//
+// The threads are ordered by the date of their most recent message, oldest first.
+func GroupThreads(msgs []*Message) []Thread {
+	idx := make(map[string]int)
+	var threads []Thread
+	for _, m := range msgs {
+		id := m.ThreadID()
+		i, ok := idx[id]
+		if !ok {
+			i = len(threads)
+			idx[id] = i
+			threads = append(threads, Thread{ID: id})
+		}
+		threads[i].Messages = append(threads[i].Messages, m)
+	}
+
+	for _, t := range threads {
+		sort.Stable(ByDate(t.Messages))
+	}
+	sort.SliceStable(threads, func(i, j int) bool {
+		return threads[i].Latest().Date().Before(threads[j].Latest().Date())
+	})
+	return threads
+}
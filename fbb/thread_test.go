@@ -0,0 +1,114 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package fbb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReply(t *testing.T) {
+	orig := NewMessage(Private, "LA5NTA")
+	orig.AddTo("N0CALL", "LA1B")
+	orig.AddCc("foo@example.com")
+	orig.SetSubject("Net tonight")
+	orig.SetBody("Check-in at 1900\r\n> quoted")
+
+	reply, err := orig.Reply("n0call", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reply.Subject(); got != "Re: Net tonight" {
+		t.Errorf("Unexpected subject %q", got)
+	}
+	if got := reply.Receivers(); !reflect.DeepEqual(got, []Address{{Addr: "LA5NTA"}}) {
+		t.Errorf("Unexpected receivers %v", got)
+	}
+	if reply.InReplyTo() != orig.MID() || reply.ThreadID() != orig.MID() {
+		t.Errorf("Missing thread headers")
+	}
+	body, _ := reply.Body()
+	if !strings.Contains(body, "> Check-in at 1900\r\n>> quoted\r\n") {
+		t.Errorf("Body not quoted: %q", body)
+	}
+
+	replyAll, _ := orig.Reply("N0CALL", true)
+	to, cc := replyAll.To(), replyAll.Cc()
+	if !reflect.DeepEqual(to, []Address{{Addr: "LA5NTA"}, {Addr: "LA1B"}}) {
+		t.Errorf("Unexpected To %v", to)
+	}
+	if !reflect.DeepEqual(cc, []Address{{Proto: "SMTP", Addr: "foo@example.com"}}) {
+		t.Errorf("Unexpected Cc %v", cc)
+	}
+
+	// None of our own addresses are included
+	orig.AddTo("N0CALL-10", "EMCOMM1")
+	orig.AddCc("n0call@winlink.org")
+	replyAll, _ = orig.Reply("N0CALL", true, "N0CALL-10", "emcomm1")
+	if to := replyAll.To(); !reflect.DeepEqual(to, []Address{{Addr: "LA5NTA"}, {Addr: "LA1B"}}) {
+		t.Errorf("Unexpected To %v", to)
+	}
+
+	// Reply to the reply should keep the thread ID and not prefix again.
+	again, _ := reply.Reply("LA5NTA", false)
+	if again.Subject() != "Re: Net tonight" {
+		t.Errorf("Unexpected subject %q", again.Subject())
+	}
+	if again.ThreadID() != orig.MID() || again.InReplyTo() != reply.MID() {
+		t.Errorf("Unexpected thread headers")
+	}
+}
+
+func TestForward(t *testing.T) {
+	orig := NewMessage(Private, "LA5NTA")
+	orig.AddTo("N0CALL")
+	orig.SetSubject("Report")
+	orig.SetBody("See attached")
+	orig.AddFile(NewFile("report.txt", []byte("data")))
+
+	fwd, err := orig.Forward("N0CALL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fwd.Subject(); got != "Fwd: Report" {
+		t.Errorf("Unexpected subject %q", got)
+	}
+	if len(fwd.Receivers()) != 0 {
+		t.Errorf("Expected no receivers")
+	}
+	if len(fwd.Files()) != 1 || string(fwd.Files()[0].Data()) != "data" {
+		t.Errorf("Attachment not carried")
+	}
+	body, _ := fwd.Body()
+	if !strings.Contains(body, "Mid: "+orig.MID()) || !strings.Contains(body, "See attached") {
+		t.Errorf("Unexpected body %q", body)
+	}
+	if fwd.InReplyTo() != orig.MID() {
+		t.Errorf("Missing X-In-Reply-To")
+	}
+}
+
+func TestGroupThreads(t *testing.T) {
+	now := time.Now()
+	a := NewMessage(Private, "LA5NTA")
+	a.SetDate(now.Add(-3 * time.Hour))
+	b := NewMessage(Private, "N0CALL")
+	b.SetDate(now.Add(-2 * time.Hour))
+	a1, _ := a.Reply("N0CALL", false)
+	a1.SetDate(now.Add(-time.Hour))
+
+	threads := GroupThreads([]*Message{a1, b, a})
+	if len(threads) != 2 {
+		t.Fatalf("Expected 2 threads, got %d", len(threads))
+	}
+	if threads[0].ID != b.MID() || threads[1].ID != a.MID() {
+		t.Errorf("Unexpected thread order")
+	}
+	if msgs := threads[1].Messages; msgs[0] != a || msgs[1] != a1 {
+		t.Errorf("Unexpected message order in thread")
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pnousiai/wl2k-go/maidenhead"
 	"github.com/pnousiai/wl2k-go/transport"
 )
 
@@ -59,6 +60,45 @@ type OutboundHandler interface {
 	SetDeferred(MID string)
 }
 
+// An OutboundErrHandler is an OutboundHandler that is able to report failures
+// to persist the state of outbound messages.
+//
+// If the Session's handler implements this interface, SetSentErr and SetDeferredErr
+// are called instead of SetSent and SetDeferred. A returned error does not
+// abort the exchange, as the remote has already been informed of the message
+// state. The message is not proposed again in the same session, and the errors
+// are reported to the caller of Session.Exchange as a *PersistenceError.
+type OutboundErrHandler interface {
+	OutboundHandler
+
+	// SetSentErr is like SetSent, but returns an error if the state could not be persisted.
+	SetSentErr(MID string, rejected bool) error
+
+	// SetDeferredErr is like SetDeferred, but returns an error if the state could not be persisted.
+	SetDeferredErr(MID string) error
+}
+
+// PersistenceError is returned by Session.Exchange if the exchange completed,
+// but the mailbox handler failed to persist the state of one or more outbound messages.
+type PersistenceError struct {
+	Errors map[string]error // Errors keyed by MID.
+}
+
+func (e *PersistenceError) Error() string {
+	mids := make([]string, 0, len(e.Errors))
+	for mid := range e.Errors {
+		mids = append(mids, mid)
+	}
+	sort.Strings(mids)
+
+	var b strings.Builder
+	b.WriteString("unable to persist outbound message state:")
+	for _, mid := range mids {
+		fmt.Fprintf(&b, " %s: %s;", mid, e.Errors[mid])
+	}
+	return strings.TrimSuffix(b.String(), ";")
+}
+
 // An InboundHandler handles all messages that can/is sent from the remote node.
 type InboundHandler interface {
 	// ProcessInbound should persist/save/process all messages received (msgs) returning an error if the operation was unsuccessful.
@@ -96,6 +136,9 @@ type Session struct {
 
 	trafficStats TrafficStats
 
+	handledMIDs map[string]bool  // Outbound MIDs sent, rejected or deferred in this session.
+	persistErrs map[string]error // Errors returned by OutboundErrHandler.
+
 	quitReceived bool
 	quitSent     bool
 	remoteNoMsgs bool // True if last remote turn had no more messages
@@ -142,9 +185,14 @@ var StdUA = UserAgent{Name: "wl2kgo", Version: "0.1a"}
 //
 // The Handler can be nil (but no messages will be exchanged).
 //
-// Mycall and targetcall will be upper-cased.
+// Mycall and targetcall will be upper-cased. The locator should be a Maidenhead
+// locator (see package maidenhead). An invalid locator is logged, but used as is
+// for compatibility. See SetLocator.
 func NewSession(mycall, targetcall, locator string, h MBoxHandler) *Session {
 	mycall, targetcall = strings.ToUpper(mycall), strings.ToUpper(targetcall)
+	if locator != "" && !maidenhead.Valid(locator) {
+		StdLogger.Printf("Warning: invalid locator %q", locator)
+	}
 
 	return &Session{
 		mycall:     mycall,
@@ -159,6 +207,8 @@ func NewSession(mycall, targetcall, locator string, h MBoxHandler) *Session {
 			Received: make([]string, 0),
 			Sent:     make([]string, 0),
 		},
+		handledMIDs: make(map[string]bool),
+		persistErrs: make(map[string]error),
 	}
 }
 
@@ -181,6 +231,20 @@ func (s *Session) SetRobustMode(mode robustMode) {
 	//TODO: If NewSession took the net.Conn (not Exchange), we could return an error here to indicate that the operation was unsupported.
 }
 
+// SetLocator sets the Maidenhead locator sent to the remote during handshake.
+//
+// An error is returned if the locator is invalid.
+func (s *Session) SetLocator(locator string) error {
+	if _, err := maidenhead.Decode(locator); err != nil {
+		return err
+	}
+	s.locator = locator
+	return nil
+}
+
+// Locator returns the Maidenhead locator of this session.
+func (s *Session) Locator() string { return s.locator }
+
 // SetMOTD sets one or more lines to be sent before handshake.
 //
 // The MOTD is only sent if the local node is session master.
@@ -208,6 +272,9 @@ func (s *Session) RemoteSID() string { return string(s.remoteSID) }
 // The connection is closed at the end of the exchange. If the connection is closed before
 // the exchange is done, ErrConnLost is returned.
 //
+// If the exchange completed, but the mailbox handler failed to persist the state of one or
+// more outbound messages (see OutboundErrHandler), a *PersistenceError is returned.
+//
 // Subsequent Exchange calls on the same session is a noop.
 func (s *Session) Exchange(conn net.Conn) (stats TrafficStats, err error) {
 	if s.Done() {
@@ -225,10 +292,14 @@ func (s *Session) Exchange(conn net.Conn) (stats TrafficStats, err error) {
 	// If an error occurred, echo it to the remote.
 	defer func() {
 		defer conn.Close()
+		var persistErr *PersistenceError
 		switch {
 		case err == nil:
 			// Success :-)
 			return
+		case errors.As(err, &persistErr):
+			// Local error, the exchange itself was successful.
+			return
 		case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
 			// Connection closed prematurely by modem (link failure) or
 			// remote peer.
@@ -281,7 +352,13 @@ func (s *Session) Exchange(conn net.Conn) (stats TrafficStats, err error) {
 		}
 	}
 
-	return s.trafficStats, conn.Close()
+	if err = conn.Close(); err != nil {
+		return s.trafficStats, err
+	}
+	if len(s.persistErrs) > 0 {
+		return s.trafficStats, &PersistenceError{Errors: s.persistErrs}
+	}
+	return s.trafficStats, nil
 }
 
 // Done() returns true if either parties have existed from this session.
@@ -367,6 +444,12 @@ func (s *Session) outbound() []*Proposal {
 	props := make([]*Proposal, 0, len(msgs))
 
 	for _, m := range msgs {
+		// Never propose the same message twice in a session, even if
+		// the handler failed to persist its state.
+		if s.handledMIDs[m.MID()] {
+			continue
+		}
+
 		// It seems reasonable to ignore these with a warning
 		if err := m.Validate(); err != nil {
 			s.log.Printf("Ignoring invalid outbound message '%s': %s", m.MID(), err)
@@ -386,6 +469,34 @@ func (s *Session) outbound() []*Proposal {
 	return props
 }
 
+// setSent reports the outbound message identified by mid as sent to the handler.
+func (s *Session) setSent(mid string, rejected bool) {
+	s.handledMIDs[mid] = true
+	h, ok := s.h.(OutboundErrHandler)
+	if !ok {
+		s.h.SetSent(mid, rejected)
+		return
+	}
+	if err := h.SetSentErr(mid, rejected); err != nil {
+		s.log.Printf("Unable to mark %s as sent: %s", mid, err)
+		s.persistErrs[mid] = err
+	}
+}
+
+// setDeferred reports the outbound message identified by mid as deferred to the handler.
+func (s *Session) setDeferred(mid string) {
+	s.handledMIDs[mid] = true
+	h, ok := s.h.(OutboundErrHandler)
+	if !ok {
+		s.h.SetDeferred(mid)
+		return
+	}
+	if err := h.SetDeferredErr(mid); err != nil {
+		s.log.Printf("Unable to mark %s as deferred: %s", mid, err)
+		s.persistErrs[mid] = err
+	}
+}
+
 func sortProposals(props []*Proposal) {
 	// sort first by ascending size, then stable sort by descending precedence
 	sort.Sort(bySize(props))
@@ -273,3 +273,13 @@ func proposalWithSubject(subject string) (*Proposal, error) {
 	_ = msg.SetBody("Satisfies validation")
 	return msg.Proposal(BasicProposal)
 }
+
+func TestSessionSetLocator(t *testing.T) {
+	s := NewSession("LA5NTA", "N0CALL", "JO39EQ", nil)
+	if err := s.SetLocator("JP20"); err != nil || s.Locator() != "JP20" {
+		t.Errorf("Expected locator JP20, got %q (%v)", s.Locator(), err)
+	}
+	if err := s.SetLocator("JP2Q"); err == nil || s.Locator() != "JP20" {
+		t.Errorf("Expected invalid locator to be rejected")
+	}
+}
@@ -5,10 +5,10 @@ go 1.19
 require (
 	github.com/albenik/go-serial/v2 v2.6.0
 	github.com/paulrosania/go-charset v0.0.0-20190326053356-55c9d7a5834c
+	golang.org/x/sys v0.13.0
 )
 
 require (
 	github.com/creack/goselect v0.1.2 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
-	golang.org/x/sys v0.13.0 // indirect
 )
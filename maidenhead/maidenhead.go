@@ -0,0 +1,194 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+// Package maidenhead implements the Maidenhead Locator System (grid squares).
+//
+// Locators of 2, 4, 6, 8 and 10 characters are supported, e.g. "JP", "JP20",
+// "JP20qh", "JP20qh35" and "JP20qh35ba". Decoding is case insensitive, while
+// Encode returns the conventional form (upper case field, lower case subsquare).
+package maidenhead
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// EarthRadius is the mean radius of the earth in kilometers, used by Distance.
+const EarthRadius = 6371.0088
+
+// ErrInvalidLocator is returned for malformed locators.
+var ErrInvalidLocator = errors.New("invalid maidenhead locator")
+
+// The character range of each locator pair, and the number of divisions of the previous pair.
+var pairs = []struct {
+	first     byte
+	divisions int
+}{
+	{'A', 18}, // Field (20° longitude, 10° latitude)
+	{'0', 10}, // Square
+	{'A', 24}, // Subsquare
+	{'0', 10}, // Extended square
+	{'A', 24}, // Extended subsquare
+}
+
+// unitsTotal is the number of squares of the finest precision around the globe
+// (in longitude) and from pole to pole (in latitude).
+var unitsTotal = unitsPer(-1)
+
+// unitsPer returns the number of squares of the finest precision within a square of the i-th pair.
+func unitsPer(i int) int {
+	n := 1
+	for _, p := range pairs[i+1:] {
+		n *= p.divisions
+	}
+	return n
+}
+
+// Square is the area covered by a locator.
+type Square struct {
+	South, West float64 // The south west corner, in decimal degrees.
+	North, East float64 // The north east corner, in decimal degrees.
+}
+
+// Center returns the center of the square.
+func (s Square) Center() (lat, lon float64) {
+	return (s.South + s.North) / 2, (s.West + s.East) / 2
+}
+
+// Contains reports whether the given position is within the square.
+func (s Square) Contains(lat, lon float64) bool {
+	return lat >= s.South && lat < s.North && lon >= s.West && lon < s.East
+}
+
+// Encode returns the locator of the given position with the given number of characters (2, 4, 6, 8 or 10).
+func Encode(lat, lon float64, chars int) (string, error) {
+	if chars < 2 || chars > 2*len(pairs) || chars%2 != 0 {
+		return "", fmt.Errorf("Unsupported locator length %d", chars)
+	}
+	if math.IsNaN(lat) || math.IsNaN(lon) || math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+		return "", fmt.Errorf("Position out of bounds: %f,%f", lat, lon)
+	}
+
+	// The position in units of the finest precision. The north pole and the
+	// antimeridian are kept within the last field.
+	x := int(math.Floor((lon + 180) / 360 * float64(unitsTotal)))
+	y := int(math.Floor((lat + 90) / 180 * float64(unitsTotal)))
+	if x >= unitsTotal {
+		x = unitsTotal - 1
+	}
+	if y >= unitsTotal {
+		y = unitsTotal - 1
+	}
+
+	var b strings.Builder
+	for i := 0; i < chars/2; i++ {
+		p, n := pairs[i], unitsPer(i)
+		first := p.first
+		if i > 0 && first == 'A' {
+			first = 'a' // Subsquares are conventionally lower case
+		}
+		b.WriteByte(first + byte(x/n%p.divisions))
+		b.WriteByte(first + byte(y/n%p.divisions))
+	}
+	return b.String(), nil
+}
+
+// Decode returns the square covered by the given locator.
+func Decode(locator string) (Square, error) {
+	if len(locator) < 2 || len(locator) > 2*len(pairs) || len(locator)%2 != 0 {
+		return Square{}, fmt.Errorf("%q: %w", locator, ErrInvalidLocator)
+	}
+	upper := strings.ToUpper(locator)
+
+	var x, y, n int
+	for i := 0; i < len(upper)/2; i++ {
+		p := pairs[i]
+		xi, yi := int(upper[2*i])-int(p.first), int(upper[2*i+1])-int(p.first)
+		if xi < 0 || xi >= p.divisions || yi < 0 || yi >= p.divisions {
+			return Square{}, fmt.Errorf("%q: %w", locator, ErrInvalidLocator)
+		}
+		n = unitsPer(i)
+		x += xi * n
+		y += yi * n
+	}
+	lon := func(u int) float64 { return float64(u)*360/float64(unitsTotal) - 180 }
+	lat := func(u int) float64 { return float64(u)*180/float64(unitsTotal) - 90 }
+	return Square{South: lat(y), West: lon(x), North: lat(y + n), East: lon(x + n)}, nil
+}
+
+// Valid reports whether the given string is a valid locator.
+func Valid(locator string) bool {
+	_, err := Decode(locator)
+	return err == nil
+}
+
+// Normalize returns the given locator in the conventional form, e.g. "JP20qh" for "jp20QH".
+func Normalize(locator string) (string, error) {
+	if !Valid(locator) {
+		return "", fmt.Errorf("%q: %w", locator, ErrInvalidLocator)
+	}
+	b := []byte(strings.ToUpper(locator))
+	for i := 4; i < len(b); i++ {
+		if b[i] >= 'A' && b[i] <= 'X' {
+			b[i] += 'a' - 'A'
+		}
+	}
+	return string(b), nil
+}
+
+// Distance returns the great-circle distance (in kilometers) between the centers of the given locators.
+func Distance(from, to string) (float64, error) {
+	lat1, lon1, lat2, lon2, err := centers(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return GreatCircleDistance(lat1, lon1, lat2, lon2), nil
+}
+
+// Bearing returns the initial great-circle bearing (in degrees from true north) between the centers of the given locators.
+func Bearing(from, to string) (float64, error) {
+	lat1, lon1, lat2, lon2, err := centers(from, to)
+	if err != nil {
+		return 0, err
+	}
+	return GreatCircleBearing(lat1, lon1, lat2, lon2), nil
+}
+
+func centers(from, to string) (lat1, lon1, lat2, lon2 float64, err error) {
+	a, err := Decode(from)
+	if err != nil {
+		return
+	}
+	b, err := Decode(to)
+	if err != nil {
+		return
+	}
+	lat1, lon1 = a.Center()
+	lat2, lon2 = b.Center()
+	return
+}
+
+// GreatCircleDistance returns the distance (in kilometers) between two positions given in decimal degrees.
+func GreatCircleDistance(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := radians(lat1), radians(lat2)
+	dPhi, dLambda := phi2-phi1, radians(lon2-lon1)
+
+	// Haversine formula
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) + math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * EarthRadius * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// GreatCircleBearing returns the initial bearing (in degrees [0,360) from true north) from one position to another.
+func GreatCircleBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1, phi2 := radians(lat1), radians(lat2)
+	dLambda := radians(lon2 - lon1)
+
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
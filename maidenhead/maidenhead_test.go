@@ -0,0 +1,110 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package maidenhead
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		lat, lon float64
+		chars    int
+		expect   string
+	}{
+		{48.14666, 11.60833, 6, "JN58td"},
+		{41.714775, -72.727260, 6, "FN31pr"},
+		{41.714775, -72.727260, 4, "FN31"},
+		{41.714775, -72.727260, 2, "FN"},
+		{-34.91, -56.21166, 6, "GF15vc"},
+		{60.18, 5.3972, 10, "JP20qe73pe"},
+		{90, 180, 4, "RR99"},
+		{-90, -180, 4, "AA00"},
+	}
+	for _, tt := range tests {
+		got, err := Encode(tt.lat, tt.lon, tt.chars)
+		if err != nil {
+			t.Errorf("%f,%f: %s", tt.lat, tt.lon, err)
+			continue
+		}
+		if got != tt.expect {
+			t.Errorf("%f,%f: expected %s, got %s", tt.lat, tt.lon, tt.expect, got)
+		}
+	}
+
+	for _, chars := range []int{0, 3, 12} {
+		if _, err := Encode(0, 0, chars); err == nil {
+			t.Errorf("Expected error for %d characters", chars)
+		}
+	}
+	if _, err := Encode(91, 0, 6); err == nil {
+		t.Errorf("Expected error for latitude out of bounds")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	sq, err := Decode("jn58TD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lat, lon := sq.Center()
+	if math.Abs(lat-48.1458) > 1e-3 || math.Abs(lon-11.625) > 1e-3 {
+		t.Errorf("Unexpected center %f,%f", lat, lon)
+	}
+	if math.Abs(sq.North-sq.South-2.5/60) > 1e-9 || math.Abs(sq.East-sq.West-5.0/60) > 1e-9 {
+		t.Errorf("Unexpected size of %+v", sq)
+	}
+
+	for _, loc := range []string{"", "J", "JN5", "SN58", "JN5A", "JN58ty", "JN58td3", "JN58td3a", "JN58td35ya"} {
+		if Valid(loc) {
+			t.Errorf("Expected %q to be invalid", loc)
+		}
+	}
+	if got, _ := Normalize("jp20QH35ba"); got != "JP20qh35ba" {
+		t.Errorf("Unexpected normalized locator %s", got)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for lat := -89.5123; lat < 90; lat += 7.3711 {
+		for lon := -179.5371; lon < 180; lon += 11.1317 {
+			for chars := 2; chars <= 10; chars += 2 {
+				loc, err := Encode(lat, lon, chars)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sq, err := Decode(loc)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !sq.Contains(lat, lon) {
+					t.Errorf("%s (%+v) does not contain %f,%f", loc, sq, lat, lon)
+				}
+			}
+		}
+	}
+}
+
+func TestDistanceBearing(t *testing.T) {
+	// London to Paris
+	if d := GreatCircleDistance(51.5074, -0.1278, 48.8566, 2.3522); math.Abs(d-343.6) > 1 {
+		t.Errorf("Expected ~343.6 km, got %f", d)
+	}
+	if b := GreatCircleBearing(51.5074, -0.1278, 48.8566, 2.3522); math.Abs(b-148.1) > 0.5 {
+		t.Errorf("Expected ~148.1°, got %f", b)
+	}
+
+	d, err := Distance("JN58td", "JN58td")
+	if err != nil || d != 0 {
+		t.Errorf("Expected zero distance, got %f (%v)", d, err)
+	}
+	if b, _ := Bearing("JO59", "JO69"); math.Abs(b-90) > 1 {
+		t.Errorf("Expected ~90°, got %f", b)
+	}
+	if _, err := Distance("JN58td", "XX"); err == nil {
+		t.Errorf("Expected error for invalid locator")
+	}
+}
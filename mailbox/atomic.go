@@ -0,0 +1,82 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeFileAtomic writes data to a temporary file in the same directory as
+// filename, and renames it to filename once the data is safely on disk.
+//
+// Readers will either see the old or the new file, never a truncated one.
+// The temporary file name starts with a dot, so it's ignored by LoadMessageDir.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(filename)
+	f, err := ioutil.TempFile(dir, "."+base+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmpName, perm)
+	}
+	if err == nil {
+		err = os.Rename(tmpName, filename)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+
+	syncDir(dir)
+	return nil
+}
+
+// syncDir flushes the directory entry changes (e.g. a rename) to disk.
+//
+// This is best effort, not all platforms support syncing a directory.
+func syncDir(dir string) {
+	if dir == "" {
+		dir = "."
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+const lockFileName = ".lock"
+
+// lockMailbox acquires an exclusive advisory lock on the mailbox rooted at mboxPath.
+//
+// The lock is shared with other processes (and other handlers in this process)
+// using the same mailbox directory. It blocks until the lock is acquired.
+func lockMailbox(mboxPath string) (unlock func(), err error) {
+	f, err := os.OpenFile(filepath.Join(mboxPath, lockFileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,424 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// conformanceHandler is the API shared by the DIR_* folder based handlers.
+type conformanceHandler interface {
+	fbb.MBoxHandler
+	fbb.OutboundErrHandler
+
+	AddOut(msg *fbb.Message) error
+	Move(MID, from, to string) error
+	Inbox() ([]*fbb.Message, error)
+	Outbox() ([]*fbb.Message, error)
+	Sent() ([]*fbb.Message, error)
+	Failed() ([]*fbb.Message, error)
+	InboxCount() int
+	OutboxCount() int
+	SentCount() int
+	FailedCount() int
+}
+
+// folderHandler is implemented by the handlers supporting user created folders.
+type folderHandler interface {
+	conformanceHandler
+
+	Folders() ([]string, error)
+	CreateFolder(name string) error
+	DeleteFolder(name string) error
+	Copy(MID, from, to string) error
+}
+
+var conformanceHandlers = map[string]func(t *testing.T, sendOnly bool) conformanceHandler{
+	"DirHandler": func(t *testing.T, sendOnly bool) conformanceHandler {
+		return NewDirHandler(t.TempDir(), sendOnly)
+	},
+	"MemHandler": func(t *testing.T, sendOnly bool) conformanceHandler {
+		return NewMemHandler(sendOnly)
+	},
+	"MaildirHandler": func(t *testing.T, sendOnly bool) conformanceHandler {
+		return NewMaildirHandler(t.TempDir(), sendOnly)
+	},
+}
+
+var conformanceTests = []struct {
+	name string
+	fn   func(t *testing.T, newHandler func(sendOnly bool) conformanceHandler)
+}{
+	{"Inbound", testConformanceInbound},
+	{"SendOnly", testConformanceSendOnly},
+	{"Outbound", testConformanceOutbound},
+	{"Forwarders", testConformanceForwarders},
+	{"History", testConformanceHistory},
+	{"Move", testConformanceMove},
+	{"Folders", testConformanceFolders},
+	{"Deferred", testConformanceDeferred},
+	{"Unanswered", testConformanceUnanswered},
+	{"Expiry", testConformanceExpiry},
+	{"Concurrent", testConformanceConcurrent},
+}
+
+func TestHandlerConformance(t *testing.T) {
+	for name, newHandler := range conformanceHandlers {
+		newHandler := newHandler
+		t.Run(name, func(t *testing.T) {
+			for _, test := range conformanceTests {
+				t.Run(test.name, func(t *testing.T) {
+					test.fn(t, func(sendOnly bool) conformanceHandler {
+						h := newHandler(t, sendOnly)
+						if err := h.Prepare(); err != nil {
+							t.Fatal(err)
+						}
+						return h
+					})
+				})
+			}
+		})
+	}
+}
+
+func testConformanceInbound(t *testing.T, newHandler func(bool) conformanceHandler) {
+	h := newHandler(false)
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	p, err := msg.Proposal(fbb.BasicProposal)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if answer := h.GetInboundAnswer(*p); answer != fbb.Accept {
+		t.Errorf("Expected new message to be accepted, got %c", answer)
+	}
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	if answer := h.GetInboundAnswer(*p); answer != fbb.Reject {
+		t.Errorf("Expected received message to be rejected, got %c", answer)
+	}
+
+	// Receiving the same message twice does not duplicate it
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	inbox, err := h.Inbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inbox) != 1 || h.InboxCount() != 1 {
+		t.Fatalf("Expected 1 message in inbox, got %d", len(inbox))
+	}
+	if got := inbox[0]; got.MID() != msg.MID() || got.Subject() != msg.Subject() || !IsUnread(got) {
+		t.Errorf("Unexpected inbox message: %s", got)
+	}
+}
+
+func testConformanceSendOnly(t *testing.T, newHandler func(bool) conformanceHandler) {
+	h := newHandler(true)
+	p, err := newTestMessage("N0CALL", "LA5NTA").Proposal(fbb.BasicProposal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer := h.GetInboundAnswer(*p); answer != fbb.Defer {
+		t.Errorf("Expected send-only handler to defer, got %c", answer)
+	}
+}
+
+func testConformanceOutbound(t *testing.T, newHandler func(bool) conformanceHandler) {
+	h := newHandler(false)
+	msg := newTestMessage("LA5NTA", "N0CALL")
+	msg.Header.Set("X-Unread", "true") // Private header
+	if err := h.AddOut(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	out := h.GetOutbound()
+	if len(out) != 1 || out[0].MID() != msg.MID() {
+		t.Fatalf("Expected the outbound message, got %v", out)
+	}
+	for _, key := range privateHeaders {
+		if v := out[0].Header.Get(key); v != "" {
+			t.Errorf("Private header %s not removed: %q", key, v)
+		}
+	}
+
+	// Modifying the returned message must not affect the handler
+	out[0].SetSubject("Modified")
+	outbox, _ := h.Outbox()
+	if len(outbox) != 1 || outbox[0].Subject() != msg.Subject() {
+		t.Errorf("Outbox modified through returned message")
+	}
+
+	if err := h.SetSentErr(msg.MID(), false); err != nil {
+		t.Fatal(err)
+	}
+	if h.OutboxCount() != 0 || h.SentCount() != 1 {
+		t.Errorf("Expected message moved to sent, got %d in outbox and %d in sent", h.OutboxCount(), h.SentCount())
+	}
+	if err := h.SetSentErr(msg.MID(), false); err == nil {
+		t.Errorf("Expected error when setting unknown message as sent")
+	}
+	if out := h.GetOutbound(); len(out) != 0 {
+		t.Errorf("Sent message offered again")
+	}
+}
+
+func testConformanceForwarders(t *testing.T, newHandler func(bool) conformanceHandler) {
+	h := newHandler(false)
+	p2p := newTestMessage("LA5NTA", "N0CALL")
+	p2p.Header.Set("X-P2POnly", "true")
+	cms := newTestMessage("LA5NTA", "N0CALL", "LA1B")
+	for _, m := range []*fbb.Message{p2p, cms} {
+		if err := h.AddOut(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if out := h.GetOutbound(fbb.AddressFromString("N0CALL")); len(out) != 1 || out[0].MID() != p2p.MID() {
+		t.Errorf("Expected only the message to the forwarder, got %v", out)
+	}
+	if out := h.GetOutbound(); len(out) != 1 || out[0].MID() != cms.MID() {
+		t.Errorf("Expected only the non-P2P message, got %v", out)
+	}
+}
+
+func testConformanceHistory(t *testing.T, newHandler func(bool) conformanceHandler) {
+	h := newHandler(false)
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Move(msg.MID(), DIR_INBOX, DIR_ARCHIVE); err != nil {
+		t.Fatal(err)
+	}
+	if h.InboxCount() != 0 {
+		t.Fatalf("Expected empty inbox, got %d", h.InboxCount())
+	}
+
+	p, err := msg.Proposal(fbb.BasicProposal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer := h.GetInboundAnswer(*p); answer != fbb.Reject {
+		t.Errorf("Expected archived message to be rejected, got %c", answer)
+	}
+}
+
+func testConformanceMove(t *testing.T, newHandler func(bool) conformanceHandler) {
+	h := newHandler(false)
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Move(msg.MID(), DIR_INBOX, "/nonexistent/"); !errors.Is(err, ErrFolderNotFound) {
+		t.Errorf("Expected ErrFolderNotFound, got %v", err)
+	}
+	if err := h.Move(msg.MID(), DIR_INBOX, "../outside"); !errors.Is(err, ErrInvalidFolder) {
+		t.Errorf("Expected ErrInvalidFolder, got %v", err)
+	}
+	if err := h.Move("../outside", DIR_INBOX, DIR_ARCHIVE); !errors.Is(err, ErrInvalidMID) {
+		t.Errorf("Expected ErrInvalidMID, got %v", err)
+	}
+	if err := h.Move(msg.MID(), DIR_INBOX, DIR_ARCHIVE); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Move(msg.MID(), DIR_INBOX, DIR_ARCHIVE); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// A message is never overwritten by a move
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Move(msg.MID(), DIR_INBOX, DIR_ARCHIVE); !errors.Is(err, ErrMessageExists) {
+		t.Errorf("Expected ErrMessageExists, got %v", err)
+	}
+	if h.InboxCount() != 1 {
+		t.Errorf("Expected 1 message in inbox, got %d", h.InboxCount())
+	}
+}
+
+func testConformanceFolders(t *testing.T, newHandler func(bool) conformanceHandler) {
+	h, ok := newHandler(false).(folderHandler)
+	if !ok {
+		t.Skip("User created folders not supported")
+	}
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.CreateFolder("projects"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"projects", DIR_INBOX} {
+		if err := h.CreateFolder(name); !errors.Is(err, ErrFolderExists) {
+			t.Errorf("%s: Expected ErrFolderExists, got %v", name, err)
+		}
+	}
+	if err := h.CreateFolder("../outside"); !errors.Is(err, ErrInvalidFolder) {
+		t.Errorf("Expected ErrInvalidFolder, got %v", err)
+	}
+	folders, err := h.Folders()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(folders, "/projects/") || !containsString(folders, DIR_INBOX) {
+		t.Errorf("Unexpected folders %v", folders)
+	}
+
+	if err := h.Copy(msg.MID(), DIR_INBOX, "projects"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Copy(msg.MID(), DIR_INBOX, "projects"); !errors.Is(err, ErrMessageExists) {
+		t.Errorf("Expected ErrMessageExists, got %v", err)
+	}
+	if err := h.Move(msg.MID(), "projects", DIR_ARCHIVE); err != nil {
+		t.Fatal(err)
+	}
+	if h.InboxCount() != 1 {
+		t.Errorf("Expected copied message to remain in inbox, got %d", h.InboxCount())
+	}
+
+	if err := h.DeleteFolder(DIR_INBOX); !errors.Is(err, ErrFolderReserved) {
+		t.Errorf("Expected ErrFolderReserved, got %v", err)
+	}
+	if err := h.DeleteFolder("projects"); err != nil {
+		t.Fatal(err)
+	}
+	if folders, _ := h.Folders(); containsString(folders, "/projects/") {
+		t.Errorf("Deleted folder still listed: %v", folders)
+	}
+}
+
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+func testConformanceDeferred(t *testing.T, newHandler func(bool) conformanceHandler) {
+	h := newHandler(false)
+	msg := newTestMessage("LA5NTA", "N0CALL")
+	if err := h.AddOut(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if out := h.GetOutbound(); len(out) != 1 {
+		t.Fatalf("Expected 1 outbound message, got %d", len(out))
+	}
+	if err := h.SetDeferredErr(msg.MID()); err != nil {
+		t.Fatal(err)
+	}
+	if out := h.GetOutbound(); len(out) != 0 {
+		t.Errorf("Deferred message offered again in the same session")
+	}
+
+	// The backoff applies to the next session
+	if err := h.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if out := h.GetOutbound(); len(out) != 0 {
+		t.Errorf("Deferred message offered before backoff elapsed")
+	}
+
+	outbox, _ := h.Outbox()
+	if state := Delivery(outbox[0]); state.Attempts != 1 || state.LastAnswer != AnswerDeferred {
+		t.Errorf("Unexpected delivery state: %+v", state)
+	}
+}
+
+func testConformanceUnanswered(t *testing.T, newHandler func(bool) conformanceHandler) {
+	h := newHandler(false)
+	msg := newTestMessage("LA5NTA", "N0CALL")
+	if err := h.AddOut(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Offered, but the session ends before the remote answers
+	if out := h.GetOutbound(); len(out) != 1 {
+		t.Fatalf("Expected 1 outbound message, got %d", len(out))
+	}
+	if out := h.GetOutbound(); len(out) != 1 {
+		t.Errorf("Expected message to be offered again in the same session, got %d", len(out))
+	}
+
+	// A dropped link does not hold the message back in the next session
+	if err := h.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if out := h.GetOutbound(); len(out) != 1 {
+		t.Errorf("Expected unanswered message to be offered in the next session, got %d", len(out))
+	}
+
+	outbox, _ := h.Outbox()
+	if state := Delivery(outbox[0]); state.Attempts != 2 || state.LastAnswer != "" {
+		t.Errorf("Unexpected delivery state: %+v", state)
+	}
+}
+
+func testConformanceExpiry(t *testing.T, newHandler func(bool) conformanceHandler) {
+	h := newHandler(false)
+	expired := newTestMessage("LA5NTA", "N0CALL")
+	SetExpiresAt(expired, time.Now().Add(-time.Minute))
+	later := newTestMessage("LA5NTA", "N0CALL")
+	SetNotBefore(later, time.Now().Add(time.Hour))
+	for _, m := range []*fbb.Message{expired, later} {
+		if err := h.AddOut(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if out := h.GetOutbound(); len(out) != 0 {
+		t.Errorf("Expected no outbound messages, got %d", len(out))
+	}
+	failed, err := h.Failed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].MID() != expired.MID() || Delivery(failed[0]).FailureReason == "" {
+		t.Errorf("Expected expired message in failed folder with reason, got %v", failed)
+	}
+	if h.OutboxCount() != 1 {
+		t.Errorf("Expected 1 message left in outbox, got %d", h.OutboxCount())
+	}
+}
+
+func testConformanceConcurrent(t *testing.T, newHandler func(bool) conformanceHandler) {
+	h := newHandler(false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := h.AddOut(newTestMessage("LA5NTA", "N0CALL")); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := h.ProcessInbound(newTestMessage("N0CALL", "LA5NTA")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if h.OutboxCount() != 10 || h.InboxCount() != 10 {
+		t.Errorf("Expected 10 messages in outbox and inbox, got %d and %d", h.OutboxCount(), h.InboxCount())
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// Private headers holding the delivery state of outbound messages.
+//
+// The headers are persisted in the outbox message file, and removed by
+// GetOutbound before the message is delivered.
+const (
+	HEADER_X_NOT_BEFORE        = `X-Not-Before`        // The message should not be delivered before this time.
+	HEADER_X_EXPIRES_AT        = `X-Expires-At`        // The message should be discarded if not delivered by this time.
+	HEADER_X_DELIVERY_ATTEMPTS = `X-Delivery-Attempts` // Number of sessions the message has been offered to.
+	HEADER_X_LAST_ATTEMPT      = `X-Last-Attempt`      // Time of the last delivery attempt.
+	HEADER_X_LAST_ANSWER       = `X-Last-Answer`       // The remote's answer to the last proposal (if any).
+	HEADER_X_FAILURE_REASON    = `X-Failure-Reason`    // Why the message was moved to the failed folder.
+)
+
+// privateHeaders are removed from outbound messages before delivery.
+var privateHeaders = []string{
+	"X-P2POnly",
+	"X-FilePath",
+	"X-Unread",
+	HEADER_X_NOT_BEFORE,
+	HEADER_X_EXPIRES_AT,
+	HEADER_X_DELIVERY_ATTEMPTS,
+	HEADER_X_LAST_ATTEMPT,
+	HEADER_X_LAST_ANSWER,
+	HEADER_X_FAILURE_REASON,
+}
+
+// Answers recorded in HEADER_X_LAST_ANSWER.
+const (
+	AnswerDeferred = "deferred"
+)
+
+// RetryPolicy controls when outbound messages are offered for delivery.
+type RetryPolicy struct {
+	// Backoff is the delay before a message deferred by the remote is offered
+	// again in a new session. The delay is doubled for every delivery attempt, up to MaxBackoff.
+	//
+	// Messages left unanswered (e.g. because the link dropped) are offered
+	// again in the next session without delay.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// MaxAttempts is the number of delivery attempts before the message is
+	// moved to the failed folder. Zero means no limit.
+	//
+	// Every session the message is offered in counts as an attempt, whether
+	// it was answered or not.
+	MaxAttempts int
+
+	// MaxAge is the maximum age (by the Date header) of an undelivered
+	// message before it's moved to the failed folder. Zero means no limit.
+	//
+	// HEADER_X_EXPIRES_AT takes precedence if set.
+	MaxAge time.Duration
+}
+
+// DefaultRetryPolicy is the RetryPolicy used by NewDirHandler.
+var DefaultRetryPolicy = RetryPolicy{
+	Backoff:    5 * time.Minute,
+	MaxBackoff: 6 * time.Hour,
+}
+
+// backoff returns the delay after the given number of delivery attempts.
+func (p RetryPolicy) backoff(attempts int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// DeliveryState holds the delivery metadata of an outbound message.
+type DeliveryState struct {
+	NotBefore     time.Time
+	ExpiresAt     time.Time
+	Attempts      int
+	LastAttempt   time.Time
+	LastAnswer    string
+	FailureReason string
+}
+
+// Delivery returns the delivery metadata of the given outbound message.
+func Delivery(msg *fbb.Message) DeliveryState {
+	attempts, _ := strconv.Atoi(msg.Header.Get(HEADER_X_DELIVERY_ATTEMPTS))
+	return DeliveryState{
+		NotBefore:     parseHeaderTime(msg, HEADER_X_NOT_BEFORE),
+		ExpiresAt:     parseHeaderTime(msg, HEADER_X_EXPIRES_AT),
+		Attempts:      attempts,
+		LastAttempt:   parseHeaderTime(msg, HEADER_X_LAST_ATTEMPT),
+		LastAnswer:    msg.Header.Get(HEADER_X_LAST_ANSWER),
+		FailureReason: msg.Header.Get(HEADER_X_FAILURE_REASON),
+	}
+}
+
+// SetNotBefore sets the earliest time the message should be delivered.
+//
+// It must be called before the message is added to the outbox. A zero time clears the value.
+func SetNotBefore(msg *fbb.Message, t time.Time) { setHeaderTime(msg, HEADER_X_NOT_BEFORE, t) }
+
+// SetExpiresAt sets the time after which an undelivered message is discarded.
+//
+// It must be called before the message is added to the outbox. A zero time clears the value.
+func SetExpiresAt(msg *fbb.Message, t time.Time) { setHeaderTime(msg, HEADER_X_EXPIRES_AT, t) }
+
+func parseHeaderTime(msg *fbb.Message, key string) time.Time {
+	t, _ := time.Parse(time.RFC3339, msg.Header.Get(key))
+	return t
+}
+
+func setHeaderTime(msg *fbb.Message, key string, t time.Time) {
+	if t.IsZero() {
+		msg.Header.Del(key)
+		return
+	}
+	msg.Header.Set(key, t.UTC().Format(time.RFC3339))
+}
+
+// expiryReason returns a non-empty reason if the message should no longer be offered for delivery.
+func (p RetryPolicy) expiryReason(msg *fbb.Message, now time.Time) string {
+	state := Delivery(msg)
+	switch {
+	case !state.ExpiresAt.IsZero() && now.After(state.ExpiresAt):
+		return fmt.Sprintf("expired at %s", state.ExpiresAt.Format(time.RFC3339))
+	case state.ExpiresAt.IsZero() && p.MaxAge > 0 && !msg.Date().IsZero() && now.Sub(msg.Date()) > p.MaxAge:
+		return fmt.Sprintf("not delivered within %s", p.MaxAge)
+	case p.MaxAttempts > 0 && state.Attempts >= p.MaxAttempts:
+		return fmt.Sprintf("not delivered after %d attempts", state.Attempts)
+	default:
+		return ""
+	}
+}
+
+// ready reports whether the message may be offered for delivery now.
+//
+// The backoff only applies if the last delivery attempt was deferred by the
+// remote. A session ending before the message was answered (e.g. a dropped
+// link) does not hold the message back. Messages already offered in the
+// current session (offered) are not held back.
+func (p RetryPolicy) ready(msg *fbb.Message, now time.Time, offered bool) bool {
+	state := Delivery(msg)
+	if now.Before(state.NotBefore) {
+		return false
+	}
+	if !offered && state.LastAnswer == AnswerDeferred && now.Before(state.LastAttempt.Add(p.backoff(state.Attempts))) {
+		return false
+	}
+	return true
+}
+
+// updateMessage re-writes the message file at filePath after applying fn to the message.
+//
+// The caller must hold the mailbox lock.
+func updateMessage(filePath string, fn func(msg *fbb.Message)) error {
+	msg, err := OpenMessage(filePath)
+	if err != nil {
+		return err
+	}
+	msg.Header.Del("X-FilePath")
+	fn(msg)
+
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filePath, data, 0644)
+}
+
+// outboundSession is the per-session delivery state of a mailbox handler, used by selectOutbound.
+type outboundSession interface {
+	// sessionState reports whether the message identified by MID has been deferred
+	// or offered to the remote in this session.
+	sessionState(MID string) (deferred, offered bool)
+
+	// attempt marks the message identified by MID as offered in this session,
+	// recording a delivery attempt the first time.
+	attempt(MID string, now time.Time) error
+
+	// fail moves the outbound message identified by MID to the failed folder with the given reason.
+	fail(MID, reason string) error
+}
+
+// selectOutbound returns the messages of the outbox (all) that should be offered to the remote.
+//
+// Expired messages are moved to the failed folder, and the delivery attempt of
+// each returned message is recorded. The private headers are removed from the
+// returned messages.
+func selectOutbound(s outboundSession, retry RetryPolicy, all []*fbb.Message, now time.Time, fws []fbb.Address) []*fbb.Message {
+	deliver := make([]*fbb.Message, 0, len(all))
+	for _, m := range all {
+		deferred, offered := s.sessionState(m.MID())
+		if deferred {
+			continue
+		}
+
+		if reason := retry.expiryReason(m, now); reason != "" {
+			if err := s.fail(m.MID(), reason); err != nil {
+				log.Printf("Unable to move expired message %s to failed: %s", m.MID(), err)
+			}
+			continue
+		}
+
+		if !retry.ready(m, now, offered) {
+			continue
+		}
+
+		// Check unsent messages that are addressed to one of the
+		// forwarder addresses of the remote.
+		if len(fws) > 0 && !isOnlyReceiverOf(m, fws) {
+			continue
+		}
+
+		if len(fws) == 0 && m.Header.Get("X-P2POnly") == "true" {
+			continue // The message is P2POnly and remote is CMS
+		}
+
+		// Count each session the message is offered to as a delivery attempt.
+		if !offered {
+			if err := s.attempt(m.MID(), now); err != nil {
+				log.Printf("Unable to record delivery attempt of %s: %s", m.MID(), err)
+			}
+		}
+
+		// Remove private headers
+		for _, key := range privateHeaders {
+			m.Header.Del(key)
+		}
+
+		deliver = append(deliver, m)
+	}
+	return deliver
+}
+
+// recordAttempt increments the delivery attempt counter of msg.
+func recordAttempt(msg *fbb.Message, now time.Time) {
+	msg.Header.Set(HEADER_X_DELIVERY_ATTEMPTS, strconv.Itoa(Delivery(msg).Attempts+1))
+	setHeaderTime(msg, HEADER_X_LAST_ATTEMPT, now)
+	msg.Header.Del(HEADER_X_LAST_ANSWER)
+}
+
+func (h *DirHandler) sessionState(MID string) (deferred, offered bool) {
+	return h.deferred[MID], h.attempted[MID]
+}
+
+func (h *DirHandler) attempt(MID string, now time.Time) error {
+	if h.attempted == nil || h.attempted[MID] {
+		return nil // Not prepared, or already offered
+	}
+	h.attempted[MID] = true
+	return h.updateOutbound(MID, func(msg *fbb.Message) { recordAttempt(msg, now) })
+}
+
+// recordAnswer records the remote's answer to the last proposal of the outbound message identified by MID.
+func (h *DirHandler) recordAnswer(MID, answer string) error {
+	return h.updateOutbound(MID, func(msg *fbb.Message) {
+		msg.Header.Set(HEADER_X_LAST_ANSWER, answer)
+	})
+}
+
+// updateOutbound re-writes the outbound message identified by MID after applying fn to it.
+func (h *DirHandler) updateOutbound(MID string, fn func(msg *fbb.Message)) error {
+	if err := validMID(MID); err != nil {
+		return err
+	}
+	rel := path.Join(DIR_OUTBOX, MID+Ext)
+	return h.locked(func() error {
+		return updateMessage(path.Join(h.MBoxPath, rel), fn)
+	}, rel)
+}
+
+// fail moves the outbound message identified by MID to the failed folder with the given reason.
+func (h *DirHandler) fail(MID, reason string) error {
+	err := h.updateOutbound(MID, func(msg *fbb.Message) {
+		msg.Header.Set(HEADER_X_FAILURE_REASON, reason)
+	})
+	if err != nil {
+		return err
+	}
+	return h.move(MID, DIR_OUTBOX, DIR_FAILED)
+}
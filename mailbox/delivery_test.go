@@ -0,0 +1,131 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+func TestDeferralBackoffIsPersisted(t *testing.T) {
+	h := newTestDirHandler(t)
+	msg := newTestMessage("LA5NTA", "N0CALL")
+	if err := h.AddOut(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(h.GetOutbound()); n != 1 {
+		t.Fatalf("Expected 1 outbound message, got %d", n)
+	}
+	if err := h.SetDeferredErr(msg.MID()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new handler (e.g. after restart) should honour the backoff.
+	h = NewDirHandler(h.MBoxPath, false)
+	h.Prepare()
+	if n := len(h.GetOutbound()); n != 0 {
+		t.Errorf("Deferred message offered again before backoff elapsed")
+	}
+
+	outbox, _ := h.Outbox()
+	state := Delivery(outbox[0])
+	if state.Attempts != 1 || state.LastAnswer != AnswerDeferred || state.LastAttempt.IsZero() {
+		t.Errorf("Unexpected delivery state: %+v", state)
+	}
+
+	h.Retry.Backoff = 0
+	out := h.GetOutbound()
+	if len(out) != 1 {
+		t.Fatalf("Deferred message not offered after backoff elapsed")
+	}
+	if out[0].Header.Get(HEADER_X_DELIVERY_ATTEMPTS) != "" {
+		t.Errorf("Private delivery headers not removed from outbound message")
+	}
+}
+
+func TestUnansweredNoBackoff(t *testing.T) {
+	h := newTestDirHandler(t)
+	msg := newTestMessage("LA5NTA", "N0CALL")
+	if err := h.AddOut(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Proposed, but the link dropped before the remote answered
+	if n := len(h.GetOutbound()); n != 1 {
+		t.Fatalf("Expected 1 outbound message, got %d", n)
+	}
+	if n := len(h.GetOutbound()); n != 1 {
+		t.Errorf("Message not offered again within the same session")
+	}
+
+	// Reconnecting after a dropped link
+	h.Prepare()
+	if n := len(h.GetOutbound()); n != 1 {
+		t.Errorf("Unanswered message held back by backoff")
+	}
+	outbox, _ := h.Outbox()
+	if state := Delivery(outbox[0]); state.Attempts != 2 || state.LastAnswer != "" {
+		t.Errorf("Unexpected delivery state: %+v", state)
+	}
+
+	// A deferral in the new session does hold it back
+	if err := h.SetDeferredErr(msg.MID()); err != nil {
+		t.Fatal(err)
+	}
+	h.Prepare()
+	if n := len(h.GetOutbound()); n != 0 {
+		t.Errorf("Deferred message offered again before backoff elapsed")
+	}
+}
+
+func TestNotBeforeAndExpiry(t *testing.T) {
+	h := newTestDirHandler(t)
+
+	later := newTestMessage("LA5NTA", "N0CALL")
+	SetNotBefore(later, time.Now().Add(time.Hour))
+	expired := newTestMessage("LA5NTA", "N0CALL")
+	SetExpiresAt(expired, time.Now().Add(-time.Minute))
+	for _, msg := range []*fbb.Message{later, expired} {
+		if err := h.AddOut(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := len(h.GetOutbound()); n != 0 {
+		t.Errorf("Expected no outbound messages, got %d", n)
+	}
+	if n := h.OutboxCount(); n != 1 {
+		t.Errorf("Expected 1 message left in outbox, got %d", n)
+	}
+
+	failed, err := OpenMessage(path.Join(h.MBoxPath, DIR_FAILED, expired.MID()+Ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Delivery(failed).FailureReason == "" {
+		t.Errorf("Missing failure reason")
+	}
+}
+
+func TestMaxAttempts(t *testing.T) {
+	h := newTestDirHandler(t)
+	h.Retry = RetryPolicy{MaxAttempts: 2}
+	h.AddOut(newTestMessage("LA5NTA", "N0CALL"))
+
+	for i := 0; i < 2; i++ {
+		h.Prepare()
+		if n := len(h.GetOutbound()); n != 1 {
+			t.Fatalf("Attempt %d: expected 1 outbound message, got %d", i+1, n)
+		}
+	}
+	h.Prepare()
+	if n := len(h.GetOutbound()); n != 0 || h.FailedCount() != 1 {
+		t.Errorf("Message not failed after max attempts")
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// EMLExt is the file extension used by ExportEML.
+const EMLExt = ".eml"
+
+// The asctime(3) date format used in mbox "From " lines.
+const mboxDateLayout = "Mon Jan _2 15:04:05 2006"
+
+// fromQuoted matches lines that must be quoted in a (mboxrd) mbox file.
+var fromQuoted = regexp.MustCompile(`^>*From `)
+
+// ExportMbox writes the given messages to w in mbox format (RFC 4155).
+//
+// Each message is converted to an Internet mail message by fbb.Message.WriteMIME,
+// keeping the Winlink MID and type as X- headers and the attachments as MIME
+// parts. Lines starting with "From " are quoted (mboxrd) and line endings are
+// converted to LF.
+func ExportMbox(w io.Writer, msgs ...*fbb.Message) error {
+	bw := bufio.NewWriter(w)
+	for _, m := range msgs {
+		data, err := exportable(m).MIME()
+		if err != nil {
+			return fmt.Errorf("Unable to convert %s: %w", m.MID(), err)
+		}
+
+		sender := m.From().Addr
+		if sender == "" || strings.ContainsAny(sender, " \t") {
+			sender = "MAILER-DAEMON"
+		}
+		fmt.Fprintf(bw, "From %s %s\n", sender, m.Date().UTC().Format(mboxDateLayout))
+
+		s := bufio.NewScanner(bytes.NewReader(data))
+		s.Buffer(nil, len(data)+1)
+		for s.Scan() {
+			line := strings.TrimSuffix(s.Text(), "\r")
+			if fromQuoted.MatchString(line) {
+				bw.WriteByte('>')
+			}
+			bw.WriteString(line)
+			bw.WriteByte('\n')
+		}
+		if err := s.Err(); err != nil {
+			return err
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// exportable returns a shallow copy of m without the headers only meaningful to this mailbox.
+func exportable(m *fbb.Message) *fbb.Message {
+	c := *m
+	c.Header = make(fbb.Header, len(m.Header))
+	for k, v := range m.Header {
+		c.Header[k] = v
+	}
+	c.Header.Del("X-FilePath")
+	return &c
+}
+
+// ImportMbox reads the messages of an mbox file (as written by ExportMbox or common mail clients).
+//
+// Messages are converted by fbb.ReadMIME, preserving the Winlink MID and date.
+func ImportMbox(r io.Reader) ([]*fbb.Message, error) {
+	var (
+		msgs    []*fbb.Message
+		current *bytes.Buffer
+		n       int
+	)
+	flush := func() error {
+		if current == nil {
+			return nil
+		}
+		// Drop the blank line separating messages
+		data := bytes.TrimSuffix(current.Bytes(), []byte("\r\n"))
+		msg, err := fbb.ReadMIME(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("Unable to parse message %d: %w", n, err)
+		}
+		msgs = append(msgs, msg)
+		return nil
+	}
+
+	br := bufio.NewReader(r)
+	prevBlank := true
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return msgs, err
+		}
+		if line == "" && err == io.EOF {
+			break
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		switch {
+		case prevBlank && strings.HasPrefix(line, "From "):
+			if err := flush(); err != nil {
+				return msgs, err
+			}
+			n++
+			current = new(bytes.Buffer)
+		case current == nil:
+			return nil, fmt.Errorf("Not an mbox file: missing From line")
+		default:
+			if strings.HasPrefix(line, ">") && fromQuoted.MatchString(line[1:]) {
+				line = line[1:]
+			}
+			current.WriteString(line)
+			current.WriteString("\r\n")
+		}
+		prevBlank = line == ""
+
+		if err == io.EOF {
+			break
+		}
+	}
+	return msgs, flush()
+}
+
+// ExportEML writes each of the given messages to a separate <MID>.eml file in dir.
+//
+// See ExportMbox for details on the conversion.
+func ExportEML(dir string, msgs ...*fbb.Message) error {
+	if err := os.MkdirAll(dir, os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if err := validMID(m.MID()); err != nil {
+			return err
+		}
+		data, err := exportable(m).MIME()
+		if err != nil {
+			return fmt.Errorf("Unable to convert %s: %w", m.MID(), err)
+		}
+		if err := writeFileAtomic(filepath.Join(dir, m.MID()+EMLExt), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportEML reads all .eml files in dir.
+func ImportEML(dir string) ([]*fbb.Message, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*fbb.Message
+	for _, fi := range infos {
+		if fi.IsDir() || !strings.EqualFold(filepath.Ext(fi.Name()), EMLExt) {
+			continue
+		}
+		msg, err := readEML(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func readEML(filename string) (*fbb.Message, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	msg, err := fbb.ReadMIME(f)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %w", filename, err)
+	}
+	return msg, nil
+}
+
+// Messages opens the messages of the given index entries, e.g. a search result.
+func (h *DirHandler) Messages(entries ...IndexEntry) ([]*fbb.Message, error) {
+	msgs := make([]*fbb.Message, 0, len(entries))
+	for _, e := range entries {
+		msg, err := h.Message(e.Folder, e.MID)
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// Import adds the given messages (e.g. from ImportMbox) to a folder, preserving their MIDs.
+//
+// Messages already present in the folder are skipped. The number of imported messages is returned.
+func (h *DirHandler) Import(folder string, msgs ...*fbb.Message) (int, error) {
+	folder, err := validFolder(folder)
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range msgs {
+		if err := validMID(m.MID()); err != nil {
+			return 0, err
+		}
+	}
+	if !h.folderExists(folder) {
+		return 0, fmt.Errorf("%s: %w", folder, ErrFolderNotFound)
+	}
+
+	var changed []string
+	err = h.locked(func() error {
+		for _, m := range msgs {
+			filePath := h.messagePath(folder, m.MID())
+			if _, err := os.Stat(filePath); err == nil {
+				continue
+			}
+			m.Header.Del("X-FilePath")
+			data, err := m.Bytes()
+			if err != nil {
+				return fmt.Errorf("Unable to encode %s: %w", m.MID(), err)
+			}
+			if err := writeFileAtomic(filePath, data, 0644); err != nil {
+				return err
+			}
+			changed = append(changed, h.messageRel(folder, m.MID()))
+		}
+		return nil
+	})
+	h.reindex(changed...)
+	h.notifyWatchers(changed...)
+	return len(changed), err
+}
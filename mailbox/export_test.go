@@ -0,0 +1,118 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+func newExportTestMessages() []*fbb.Message {
+	plain := newTestMessage("N0CALL", "LA5NTA")
+	plain.SetBody("Hello\r\nFrom the boat\r\n>From quoted\r\n")
+	plain.SetDate(time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC))
+
+	attached := newTestMessage("LA1B", "LA5NTA", "N0CALL")
+	attached.SetSubject("Position report")
+	attached.AddFile(fbb.NewFile("pos.bin", []byte{0, 1, 2, '\r', '\n', 255}))
+	return []*fbb.Message{plain, attached}
+}
+
+func assertImported(t *testing.T, expect, got []*fbb.Message) {
+	t.Helper()
+	if len(got) != len(expect) {
+		t.Fatalf("Expected %d messages, got %d", len(expect), len(got))
+	}
+	for i, want := range expect {
+		m := got[i]
+		wantBody, _ := want.Body()
+		gotBody, _ := m.Body()
+		switch {
+		case m.MID() != want.MID():
+			t.Errorf("MID: expected %s, got %s", want.MID(), m.MID())
+		case !m.Date().Equal(want.Date()):
+			t.Errorf("%s: date: expected %s, got %s", want.MID(), want.Date(), m.Date())
+		case m.Subject() != want.Subject():
+			t.Errorf("%s: subject: expected %q, got %q", want.MID(), want.Subject(), m.Subject())
+		case gotBody != wantBody:
+			t.Errorf("%s: body: expected %q, got %q", want.MID(), wantBody, gotBody)
+		case len(m.Receivers()) != len(want.Receivers()):
+			t.Errorf("%s: expected %d receivers, got %d", want.MID(), len(want.Receivers()), len(m.Receivers()))
+		case len(m.Files()) != len(want.Files()):
+			t.Errorf("%s: expected %d files, got %d", want.MID(), len(want.Files()), len(m.Files()))
+		}
+		for j, f := range want.Files() {
+			if j < len(m.Files()) && !bytes.Equal(m.Files()[j].Data(), f.Data()) {
+				t.Errorf("%s: attachment %s corrupted", want.MID(), f.Name())
+			}
+		}
+		if m.Header.Get("X-FilePath") != "" {
+			t.Errorf("%s: X-FilePath exported", want.MID())
+		}
+	}
+}
+
+func TestMboxRoundTrip(t *testing.T) {
+	h := newTestDirHandler(t)
+	msgs := newExportTestMessages()
+	if _, err := h.Import(DIR_ARCHIVE, msgs...); err != nil {
+		t.Fatal(err)
+	}
+
+	// Export a search result
+	idx, err := h.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := idx.Search(Query{Folder: DIR_ARCHIVE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	archived, err := h.Messages(res.Entries...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportMbox(&buf, archived...); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\nFrom "); n != 1 || !strings.HasPrefix(buf.String(), "From ") {
+		t.Errorf("Expected 2 unquoted From lines, got %d:\n%s", n+1, buf.String())
+	}
+
+	imported, err := ImportMbox(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertImported(t, archived, imported)
+
+	// Importing into a mailbox skips existing messages
+	if n, err := h.Import(DIR_ARCHIVE, imported...); err != nil || n != 0 {
+		t.Errorf("Expected 0 imported messages, got %d (%v)", n, err)
+	}
+}
+
+func TestEMLRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	msgs := newExportTestMessages()
+	if err := ExportEML(dir, msgs...); err != nil {
+		t.Fatal(err)
+	}
+	imported, err := ImportEML(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ImportEML returns the messages ordered by file name (MID)
+	if imported[0].MID() != msgs[0].MID() {
+		msgs[0], msgs[1] = msgs[1], msgs[0]
+	}
+	assertImported(t, msgs, imported)
+}
@@ -0,0 +1,175 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+const flagsFileName = ".flags.json"
+
+// Flags holds the user state of a message.
+type Flags uint8
+
+const (
+	FlagRead    Flags = 1 << iota // The message has been read.
+	FlagReplied                   // The message has been replied to.
+	FlagFlagged                   // The message is flagged for attention.
+)
+
+// Has reports whether all the given flags are set.
+func (f Flags) Has(flags Flags) bool { return f&flags == flags }
+
+func (f Flags) String() string {
+	var names []string
+	for _, v := range []struct {
+		flag Flags
+		name string
+	}{{FlagRead, "read"}, {FlagReplied, "replied"}, {FlagFlagged, "flagged"}} {
+		if f.Has(v.flag) {
+			names = append(names, v.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// flagRecord is the metadata of a message stored outside the message file.
+type flagRecord struct {
+	Flags   Flags
+	Trashed string `json:",omitempty"` // The folder the message was trashed from.
+}
+
+// flagStore holds the flag records of a mailbox, keyed by MID.
+//
+// The store is saved as a hidden file in the mailbox root. Messages
+// without a record fall back to the X-Unread header.
+type flagStore map[string]flagRecord
+
+func flagsPath(mboxPath string) string { return filepath.Join(mboxPath, flagsFileName) }
+
+// readFlags reads the flag store of the mailbox rooted at mboxPath.
+func readFlags(mboxPath string) (flagStore, error) {
+	store := make(flagStore)
+	data, err := ioutil.ReadFile(flagsPath(mboxPath))
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store); err != nil {
+		return nil, fmt.Errorf("Corrupt flag store: %w", err)
+	}
+	return store, nil
+}
+
+// write saves the flag store. The caller must hold the mailbox lock.
+func (s flagStore) write(mboxPath string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(flagsPath(mboxPath), data, 0644)
+}
+
+// flags returns the flags of the given message.
+func (s flagStore) flags(msg *fbb.Message) Flags {
+	if r, ok := s[msg.MID()]; ok {
+		return r.Flags
+	}
+	if IsUnread(msg) {
+		return 0
+	}
+	return FlagRead
+}
+
+// apply updates the X-Unread header of msg (in memory) to reflect the stored flags.
+func (s flagStore) apply(msg *fbb.Message) {
+	r, ok := s[msg.MID()]
+	switch {
+	case !ok:
+	case r.Flags.Has(FlagRead):
+		msg.Header.Del("X-Unread")
+	default:
+		msg.Header.Set("X-Unread", "true")
+	}
+}
+
+// Flags returns the flags of the message identified by MID.
+func (h *DirHandler) Flags(MID string) (Flags, error) {
+	if err := validMID(MID); err != nil {
+		return 0, err
+	}
+	store, err := readFlags(h.MBoxPath)
+	if err != nil {
+		return 0, err
+	}
+	if r, ok := store[MID]; ok {
+		return r.Flags, nil
+	}
+
+	folders, err := h.Locate(MID)
+	if err != nil {
+		return 0, err
+	}
+	if len(folders) == 0 {
+		return 0, fmt.Errorf("Message %s not found", MID)
+	}
+	msg, err := OpenMessage(h.messagePath(folders[0], MID))
+	if err != nil {
+		return 0, err
+	}
+	return store.flags(msg), nil
+}
+
+// SetFlags sets and clears flags of the message identified by MID.
+//
+// The flags are stored outside the message file, which is left untouched.
+func (h *DirHandler) SetFlags(MID string, set, clear Flags) error {
+	folders, err := h.Locate(MID)
+	if err != nil {
+		return err
+	}
+	if len(folders) == 0 {
+		return fmt.Errorf("Message %s not found", MID)
+	}
+
+	changed := make([]string, len(folders))
+	for i, folder := range folders {
+		changed[i] = h.messageRel(folder, MID)
+	}
+
+	return h.locked(func() error {
+		store, err := readFlags(h.MBoxPath)
+		if err != nil {
+			return err
+		}
+		r, ok := store[MID]
+		if !ok {
+			msg, err := OpenMessage(h.messagePath(folders[0], MID))
+			if err != nil {
+				return err
+			}
+			r.Flags = store.flags(msg)
+		}
+		r.Flags = (r.Flags | set) &^ clear
+		store[MID] = r
+		return store.write(h.MBoxPath)
+	}, changed...)
+}
+
+// MarkRead marks the message identified by MID as read or unread.
+func (h *DirHandler) MarkRead(MID string, read bool) error {
+	if read {
+		return h.SetFlags(MID, FlagRead, 0)
+	}
+	return h.SetFlags(MID, 0, FlagRead)
+}
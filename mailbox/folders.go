@@ -0,0 +1,446 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// Deleted messages are moved here, and can be restored to the folder they were deleted from.
+const DIR_TRASH = "/trash/"
+
+var (
+	ErrFolderExists   = errors.New("folder already exists")
+	ErrFolderNotFound = errors.New("folder not found")
+	ErrFolderReserved = errors.New("folder is reserved")
+	ErrInvalidFolder  = errors.New("invalid folder name")
+	ErrInvalidMID     = errors.New("invalid MID")
+	ErrInvalidMessage = errors.New("invalid message file")
+	ErrMessageExists  = errors.New("message already exists in destination folder")
+	ErrNotFound       = errors.New("message not found")
+)
+
+// systemFolders are the folders managed by DirHandler. They can't be renamed or deleted.
+var systemFolders = []string{DIR_INBOX, DIR_OUTBOX, DIR_SENT, DIR_ARCHIVE, DIR_FAILED, DIR_TRASH, DIR_QUARANTINE}
+
+// IsSystemFolder reports whether the given folder is managed by DirHandler (e.g. DIR_INBOX).
+func IsSystemFolder(folder string) bool {
+	folder = normFolder(folder)
+	for _, f := range systemFolders {
+		if f == folder {
+			return true
+		}
+	}
+	return false
+}
+
+// validFolder returns the normalized folder name, or ErrInvalidFolder.
+func validFolder(name string) (string, error) {
+	trimmed := strings.Trim(name, "/")
+	if trimmed == "" || strings.ContainsAny(trimmed, `/\:`) || strings.HasPrefix(trimmed, ".") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidFolder, name)
+	}
+	return normFolder(trimmed), nil
+}
+
+// validMID returns ErrInvalidMID if MID is not safe to use as a file name.
+//
+// Only letters, digits, '-' and '_' are allowed, so a MID can't contain path separators or "..".
+func validMID(MID string) error {
+	if MID == "" {
+		return fmt.Errorf("%w: empty", ErrInvalidMID)
+	}
+	for _, r := range MID {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return fmt.Errorf("%w: %q", ErrInvalidMID, MID)
+		}
+	}
+	return nil
+}
+
+// validMessage returns the normalized folder name if both the folder name and MID are valid.
+func validMessage(folder, MID string) (string, error) {
+	if err := validMID(MID); err != nil {
+		return "", err
+	}
+	return validFolder(folder)
+}
+
+func (h *DirHandler) folderPath(folder string) string { return path.Join(h.MBoxPath, folder) }
+
+func (h *DirHandler) messageRel(folder, MID string) string { return path.Join(folder, MID+Ext) }
+
+func (h *DirHandler) messagePath(folder, MID string) string {
+	return path.Join(h.MBoxPath, h.messageRel(folder, MID))
+}
+
+func (h *DirHandler) folderExists(folder string) bool {
+	fi, err := os.Stat(h.folderPath(folder))
+	return err == nil && fi.IsDir()
+}
+
+// Folders returns the message folders of this mailbox, both system and user created.
+//
+// The quarantine folder is not included.
+func (h *DirHandler) Folders() ([]string, error) { return listFolders(h.MBoxPath) }
+
+// CreateFolder creates a new user folder.
+func (h *DirHandler) CreateFolder(name string) error {
+	folder, err := validFolder(name)
+	if err != nil {
+		return err
+	}
+	return h.locked(func() error {
+		if h.folderExists(folder) {
+			return fmt.Errorf("%s: %w", folder, ErrFolderExists)
+		}
+		return os.Mkdir(h.folderPath(folder), os.ModeDir|os.ModePerm)
+	})
+}
+
+// RenameFolder renames a user folder.
+func (h *DirHandler) RenameFolder(oldName, newName string) error {
+	from, err := validFolder(oldName)
+	if err != nil {
+		return err
+	}
+	to, err := validFolder(newName)
+	if err != nil {
+		return err
+	}
+	if IsSystemFolder(from) || IsSystemFolder(to) {
+		return ErrFolderReserved
+	}
+
+	var moved []string
+	err = h.locked(func() error {
+		switch {
+		case !h.folderExists(from):
+			return fmt.Errorf("%s: %w", from, ErrFolderNotFound)
+		case h.folderExists(to):
+			return fmt.Errorf("%s: %w", to, ErrFolderExists)
+		}
+		MIDs, err := h.folderMIDs(from)
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(h.folderPath(from), h.folderPath(to)); err != nil {
+			return err
+		}
+		for _, MID := range MIDs {
+			moved = append(moved, h.messageRel(from, MID), h.messageRel(to, MID))
+		}
+
+		// Messages trashed from this folder should be restored to the new name.
+		store, err := readFlags(h.MBoxPath)
+		if err != nil {
+			return err
+		}
+		var changed bool
+		for MID, r := range store {
+			if r.Trashed == from {
+				r.Trashed = to
+				store[MID] = r
+				changed = true
+			}
+		}
+		if !changed {
+			return nil
+		}
+		return store.write(h.MBoxPath)
+	})
+	h.reindex(moved...)
+	h.notifyWatchers(moved...)
+	return err
+}
+
+// DeleteFolder deletes a user folder. Any messages in the folder are moved to the trash.
+func (h *DirHandler) DeleteFolder(name string) error {
+	folder, err := validFolder(name)
+	if err != nil {
+		return err
+	}
+	if IsSystemFolder(folder) {
+		return ErrFolderReserved
+	}
+	if !h.folderExists(folder) {
+		return fmt.Errorf("%s: %w", folder, ErrFolderNotFound)
+	}
+
+	MIDs, err := h.folderMIDs(folder)
+	if err != nil {
+		return err
+	}
+	for _, MID := range MIDs {
+		if err := h.Trash(MID, folder); err != nil {
+			return err
+		}
+	}
+	return h.locked(func() error { return os.Remove(h.folderPath(folder)) })
+}
+
+// List returns the messages in the given folder.
+//
+// The X-Unread header of the returned messages reflects the read flag.
+func (h *DirHandler) List(folder string) ([]*fbb.Message, error) {
+	folder, err := validFolder(folder)
+	if err != nil {
+		return nil, err
+	}
+	if !h.folderExists(folder) {
+		return nil, fmt.Errorf("%s: %w", folder, ErrFolderNotFound)
+	}
+	return h.loadDir(folder)
+}
+
+// Message opens the message identified by MID in the given folder.
+func (h *DirHandler) Message(folder, MID string) (*fbb.Message, error) {
+	folder, err := validMessage(folder, MID)
+	if err != nil {
+		return nil, err
+	}
+	filePath := h.messagePath(folder, MID)
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s in %s: %w", MID, folder, ErrNotFound)
+	}
+	msg, err := OpenMessage(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if store, err := readFlags(h.MBoxPath); err == nil {
+		store.apply(msg)
+	}
+	return msg, nil
+}
+
+// Locate returns the folders containing the message identified by MID.
+func (h *DirHandler) Locate(MID string) ([]string, error) {
+	if err := validMID(MID); err != nil {
+		return nil, err
+	}
+	folders, err := listFolders(h.MBoxPath)
+	if err != nil {
+		return nil, err
+	}
+	var found []string
+	for _, folder := range folders {
+		if _, err := os.Stat(h.messagePath(folder, MID)); err == nil {
+			found = append(found, folder)
+		}
+	}
+	return found, nil
+}
+
+// Move moves the message identified by MID from one folder to another.
+func (h *DirHandler) Move(MID, from, to string) error {
+	from, to, err := validTransfer(MID, from, to)
+	if err != nil {
+		return err
+	}
+	if err := h.checkTransfer(MID, from, to); err != nil {
+		return err
+	}
+	return h.move(MID, from, to)
+}
+
+// Copy copies the message identified by MID from one folder to another.
+//
+// The copy keeps the MID (and flags) of the original.
+func (h *DirHandler) Copy(MID, from, to string) error {
+	from, to, err := validTransfer(MID, from, to)
+	if err != nil {
+		return err
+	}
+	if err := h.checkTransfer(MID, from, to); err != nil {
+		return err
+	}
+	return h.locked(func() error {
+		data, err := ioutil.ReadFile(h.messagePath(from, MID))
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(h.messagePath(to, MID), data, 0644)
+	}, h.messageRel(to, MID))
+}
+
+// validTransfer returns the normalized folder names if the MID and both folder names are valid.
+func validTransfer(MID, from, to string) (string, string, error) {
+	from, err := validMessage(from, MID)
+	if err != nil {
+		return "", "", err
+	}
+	to, err = validFolder(to)
+	return from, to, err
+}
+
+func (h *DirHandler) checkTransfer(MID, from, to string) error {
+	switch {
+	case from == to:
+		return fmt.Errorf("%s: %w", to, ErrMessageExists)
+	case !h.folderExists(to):
+		return fmt.Errorf("%s: %w", to, ErrFolderNotFound)
+	}
+	if _, err := os.Stat(h.messagePath(from, MID)); os.IsNotExist(err) {
+		return fmt.Errorf("%s in %s: %w", MID, from, ErrNotFound)
+	}
+	if _, err := os.Stat(h.messagePath(to, MID)); err == nil {
+		return fmt.Errorf("%s in %s: %w", MID, to, ErrMessageExists)
+	}
+	return nil
+}
+
+// Delete permanently deletes the message identified by MID from the given folder.
+//
+// See Trash for a recoverable delete.
+func (h *DirHandler) Delete(MID, folder string) error {
+	folder, err := validMessage(folder, MID)
+	if err != nil {
+		return err
+	}
+	rel := h.messageRel(folder, MID)
+	return h.locked(func() error {
+		if err := os.Remove(h.messagePath(folder, MID)); os.IsNotExist(err) {
+			return fmt.Errorf("%s in %s: %w", MID, folder, ErrNotFound)
+		} else if err != nil {
+			return err
+		}
+		return h.dropFlags(MID)
+	}, rel)
+}
+
+// dropFlags removes the flag record of MID if no copies of the message remain. The caller must hold the mailbox lock.
+func (h *DirHandler) dropFlags(MID string) error {
+	if folders, err := h.Locate(MID); err != nil || len(folders) > 0 {
+		return err
+	}
+	store, err := readFlags(h.MBoxPath)
+	if err != nil {
+		return err
+	}
+	if _, ok := store[MID]; !ok {
+		return nil
+	}
+	delete(store, MID)
+	return store.write(h.MBoxPath)
+}
+
+// Trash moves the message identified by MID from the given folder to the trash.
+//
+// The message can be restored to the folder by Restore.
+func (h *DirHandler) Trash(MID, folder string) error {
+	folder, err := validMessage(folder, MID)
+	if err != nil {
+		return err
+	}
+	if folder == DIR_TRASH {
+		return h.Delete(MID, folder)
+	}
+	if err := h.checkTransfer(MID, folder, DIR_TRASH); err != nil {
+		return err
+	}
+
+	oldRel, newRel := h.messageRel(folder, MID), h.messageRel(DIR_TRASH, MID)
+	return h.locked(func() error {
+		store, err := readFlags(h.MBoxPath)
+		if err != nil {
+			return err
+		}
+		r, ok := store[MID]
+		if !ok {
+			msg, err := OpenMessage(h.messagePath(folder, MID))
+			if err != nil {
+				return err
+			}
+			r.Flags = store.flags(msg)
+		}
+		r.Trashed = folder
+		store[MID] = r
+		if err := store.write(h.MBoxPath); err != nil {
+			return err
+		}
+		return os.Rename(h.messagePath(folder, MID), h.messagePath(DIR_TRASH, MID))
+	}, oldRel, newRel)
+}
+
+// Restore moves the message identified by MID from the trash back to the folder it was trashed from.
+//
+// The folder is re-created if it has been deleted. Messages with unknown origin are restored to the inbox.
+func (h *DirHandler) Restore(MID string) error {
+	if err := validMID(MID); err != nil {
+		return err
+	}
+	store, err := readFlags(h.MBoxPath)
+	if err != nil {
+		return err
+	}
+	folder := store[MID].Trashed
+	if folder == "" {
+		folder = DIR_INBOX
+	}
+	if folder, err = validFolder(folder); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(h.folderPath(folder), os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+	if err := h.checkTransfer(MID, DIR_TRASH, folder); err != nil {
+		return err
+	}
+
+	oldRel, newRel := h.messageRel(DIR_TRASH, MID), h.messageRel(folder, MID)
+	return h.locked(func() error {
+		if err := os.Rename(h.messagePath(DIR_TRASH, MID), h.messagePath(folder, MID)); err != nil {
+			return err
+		}
+		store, err := readFlags(h.MBoxPath)
+		if err != nil {
+			return err
+		}
+		if r, ok := store[MID]; ok {
+			r.Trashed = ""
+			store[MID] = r
+			return store.write(h.MBoxPath)
+		}
+		return nil
+	}, oldRel, newRel)
+}
+
+// EmptyTrash permanently deletes all messages in the trash.
+func (h *DirHandler) EmptyTrash() error {
+	MIDs, err := h.folderMIDs(DIR_TRASH)
+	if err != nil {
+		return err
+	}
+	for _, MID := range MIDs {
+		if err := h.Delete(MID, DIR_TRASH); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// folderMIDs returns the MIDs of the message files in the given folder.
+func (h *DirHandler) folderMIDs(folder string) ([]string, error) {
+	infos, err := ioutil.ReadDir(h.folderPath(folder))
+	if err != nil {
+		return nil, err
+	}
+	var MIDs []string
+	for _, fi := range infos {
+		if isMessageFile(fi) {
+			MIDs = append(MIDs, strings.TrimSuffix(fi.Name(), Ext))
+		}
+	}
+	return MIDs, nil
+}
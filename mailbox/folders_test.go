@@ -0,0 +1,261 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+func TestFolders(t *testing.T) {
+	h := newTestDirHandler(t)
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.CreateFolder("Projects"); err != nil {
+		t.Fatal(err)
+	}
+	for name, expect := range map[string]error{
+		"Projects":  ErrFolderExists,
+		"../escape": ErrInvalidFolder,
+		".hidden":   ErrInvalidFolder,
+	} {
+		if err := h.CreateFolder(name); !errors.Is(err, expect) {
+			t.Errorf("CreateFolder(%q): expected %v, got %v", name, expect, err)
+		}
+	}
+	if err := h.RenameFolder(DIR_INBOX, "Mail"); !errors.Is(err, ErrFolderReserved) {
+		t.Errorf("Expected system folder rename to fail, got %v", err)
+	}
+
+	if err := h.Copy(msg.MID(), DIR_INBOX, "Projects"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Move(msg.MID(), DIR_INBOX, DIR_ARCHIVE); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Move(msg.MID(), DIR_ARCHIVE, "Projects"); !errors.Is(err, ErrMessageExists) {
+		t.Errorf("Expected move to existing message to fail, got %v", err)
+	}
+	folders, err := h.Locate(msg.MID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []string{"/Projects/", DIR_ARCHIVE}; !reflect.DeepEqual(folders, expect) {
+		t.Errorf("Expected message in %v, got %v", expect, folders)
+	}
+
+	if err := h.RenameFolder("Projects", "Done"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Message("Done", msg.MID()); err != nil {
+		t.Errorf("Message not found in renamed folder: %s", err)
+	}
+
+	// Deleting a folder trashes its content, and restoring re-creates the folder
+	if err := h.DeleteFolder("Done"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Restore(msg.MID()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.Message("Done", msg.MID()); err != nil {
+		t.Errorf("Message not restored: %s", err)
+	}
+
+	if err := h.Delete(msg.MID(), "Done"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Delete(msg.MID(), "Done"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestPathTraversal(t *testing.T) {
+	h := newTestDirHandler(t)
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	outside := path.Join(path.Dir(h.MBoxPath), "outside")
+
+	for _, mid := range []string{"../../foo", "a/b", "..", ".hidden", "a\\b", ""} {
+		if _, err := h.Message(DIR_INBOX, mid); !errors.Is(err, ErrInvalidMID) {
+			t.Errorf("Message(%q): expected ErrInvalidMID, got %v", mid, err)
+		}
+		if err := h.Delete(mid, DIR_INBOX); !errors.Is(err, ErrInvalidMID) {
+			t.Errorf("Delete(%q): expected ErrInvalidMID, got %v", mid, err)
+		}
+		if err := h.Restore(mid); !errors.Is(err, ErrInvalidMID) {
+			t.Errorf("Restore(%q): expected ErrInvalidMID, got %v", mid, err)
+		}
+	}
+	for _, folder := range []string{"../../outside", "../", "/inbox/../..", ".index"} {
+		if _, err := h.Message(folder, msg.MID()); !errors.Is(err, ErrInvalidFolder) {
+			t.Errorf("Message(%q): expected ErrInvalidFolder, got %v", folder, err)
+		}
+		if err := h.Move(msg.MID(), DIR_INBOX, folder); !errors.Is(err, ErrInvalidFolder) {
+			t.Errorf("Move to %q: expected ErrInvalidFolder, got %v", folder, err)
+		}
+		if err := h.Copy(msg.MID(), DIR_INBOX, folder); !errors.Is(err, ErrInvalidFolder) {
+			t.Errorf("Copy to %q: expected ErrInvalidFolder, got %v", folder, err)
+		}
+		if err := h.Trash(msg.MID(), folder); !errors.Is(err, ErrInvalidFolder) {
+			t.Errorf("Trash from %q: expected ErrInvalidFolder, got %v", folder, err)
+		}
+		if _, err := h.List(folder); !errors.Is(err, ErrInvalidFolder) {
+			t.Errorf("List(%q): expected ErrInvalidFolder, got %v", folder, err)
+		}
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("Path outside the mailbox was created")
+	}
+	if h.InboxCount() != 1 {
+		t.Errorf("Message was moved out of the inbox")
+	}
+}
+
+func TestPathTraversalMIDs(t *testing.T) {
+	h := newTestDirHandler(t)
+	outside := path.Join(path.Dir(h.MBoxPath), "outside")
+
+	for _, mid := range []string{"../../outside", "a/b", "..", ""} {
+		msg := newTestMessage("N0CALL", "LA5NTA")
+		msg.Header.Set(fbb.HEADER_MID, mid)
+
+		if err := h.AddOut(msg); !errors.Is(err, ErrInvalidMID) {
+			t.Errorf("AddOut(%q): expected ErrInvalidMID, got %v", mid, err)
+		}
+		if err := h.ProcessInbound(msg); !errors.Is(err, ErrInvalidMID) {
+			t.Errorf("ProcessInbound(%q): expected ErrInvalidMID, got %v", mid, err)
+		}
+		p := fbb.NewProposal(mid, "Test", fbb.BasicProposal, []byte("data"))
+		if answer := h.GetInboundAnswer(*p); answer != fbb.Reject {
+			t.Errorf("GetInboundAnswer(%q): expected reject, got %c", mid, answer)
+		}
+		if err := h.SetSentErr(mid, false); !errors.Is(err, ErrInvalidMID) {
+			t.Errorf("SetSentErr(%q): expected ErrInvalidMID, got %v", mid, err)
+		}
+		if err := h.SetDeferredErr(mid); !errors.Is(err, ErrInvalidMID) {
+			t.Errorf("SetDeferredErr(%q): expected ErrInvalidMID, got %v", mid, err)
+		}
+		if err := ExportEML(path.Join(h.MBoxPath, "export"), msg); !errors.Is(err, ErrInvalidMID) {
+			t.Errorf("ExportEML(%q): expected ErrInvalidMID, got %v", mid, err)
+		}
+	}
+	if _, err := os.Stat(outside + Ext); !os.IsNotExist(err) {
+		t.Errorf("Message written outside the mailbox")
+	}
+	if _, err := os.Stat(outside + EMLExt); !os.IsNotExist(err) {
+		t.Errorf("EML written outside the export directory")
+	}
+}
+
+func TestTrash(t *testing.T) {
+	h := newTestDirHandler(t)
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetFlags(msg.MID(), FlagFlagged, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := h.Trash(msg.MID(), DIR_INBOX); err != nil {
+		t.Fatal(err)
+	}
+	if h.InboxCount() != 0 {
+		t.Errorf("Trashed message still in inbox")
+	}
+	if err := h.Restore(msg.MID()); err != nil {
+		t.Fatal(err)
+	}
+	if h.InboxCount() != 1 {
+		t.Errorf("Message not restored to inbox")
+	}
+	if flags, _ := h.Flags(msg.MID()); !flags.Has(FlagFlagged) {
+		t.Errorf("Flags lost in trash: %s", flags)
+	}
+
+	if err := h.Trash(msg.MID(), DIR_INBOX); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.EmptyTrash(); err != nil {
+		t.Fatal(err)
+	}
+	if folders, _ := h.Locate(msg.MID()); len(folders) != 0 {
+		t.Errorf("Message not deleted: %v", folders)
+	}
+	if store, _ := readFlags(h.MBoxPath); len(store) != 0 {
+		t.Errorf("Flags of deleted message not removed: %v", store)
+	}
+}
+
+func TestFlagsDoNotModifyMessage(t *testing.T) {
+	h := newTestDirHandler(t)
+	idx, err := h.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	filePath := path.Join(h.MBoxPath, DIR_INBOX, msg.MID()+Ext)
+	before, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if flags, err := h.Flags(msg.MID()); err != nil || flags != 0 {
+		t.Errorf("Expected no flags on new message, got %s (%v)", flags, err)
+	}
+	if err := h.MarkRead(msg.MID(), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetFlags(msg.MID(), FlagReplied, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Errorf("Message file modified by flag change")
+	}
+
+	inbox, err := h.Inbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsUnread(inbox[0]) {
+		t.Errorf("Read message reported as unread")
+	}
+	if e, _ := idx.Get(DIR_INBOX, msg.MID()); e.Unread || !e.Flags.Has(FlagRead|FlagReplied) {
+		t.Errorf("Index not updated with flags: %+v", e)
+	}
+
+	// Flag changes made by others are picked up by the index
+	other := NewDirHandler(h.MBoxPath, false)
+	if err := other.MarkRead(msg.MID(), false); err != nil {
+		t.Fatal(err)
+	}
+	res, err := idx.Search(Query{UnreadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 1 {
+		t.Errorf("Expected 1 unread message, got %d", res.Total)
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const historyFileName = ".mids"
+
+// DefaultHistoryRetention is the retention of the received-MID history used by NewDirHandler.
+const DefaultHistoryRetention = 180 * 24 * time.Hour
+
+// History is a persistent record of received MIDs.
+//
+// It's used to reject messages that have already been received, even if the
+// message has since been archived or deleted. MIDs are forgotten once they
+// are older than the retention window.
+//
+// The history is stored as a hidden file in the mailbox root, one MID and
+// (unix) receive time per line. New MIDs are appended, and expired MIDs are
+// removed when the history is opened or pruned.
+//
+// History implements fbb.MIDHistory. It is safe for concurrent use.
+type History struct {
+	// Retention is how long a MID is remembered. Zero means forever.
+	Retention time.Duration
+
+	path   string
+	mu     sync.Mutex
+	mids   map[string]time.Time
+	loaded os.FileInfo // The history file as of the last load
+}
+
+// OpenHistory opens the received-MID history of the mailbox rooted at mboxPath.
+//
+// If the history does not exist, it's seeded from the message folders of the
+// mailbox (see Import).
+func OpenHistory(mboxPath string, retention time.Duration) (*History, error) {
+	h := &History{
+		Retention: retention,
+		path:      filepath.Join(mboxPath, historyFileName),
+		mids:      make(map[string]time.Time),
+	}
+
+	switch _, err := os.Stat(h.path); {
+	case os.IsNotExist(err):
+		return h, h.Import(mboxPath, DIR_INBOX, DIR_ARCHIVE, DIR_SENT)
+	case err != nil:
+		return nil, err
+	}
+	return h, h.Prune()
+}
+
+// load merges the MIDs of the history file into h.mids. The caller must hold h.mu.
+func (h *History) load() error {
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	h.loaded = fi
+
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 {
+			continue // Ignore garbage (e.g. a partially written line)
+		}
+		sec, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if t := time.Unix(sec, 0); t.After(h.mids[fields[0]]) {
+			h.mids[fields[0]] = t
+		}
+	}
+	return s.Err()
+}
+
+// HasMID reports whether the given MID has been received within the retention window.
+//
+// If the MID is unknown, MIDs added by other processes sharing the mailbox
+// since the history was last read are loaded before answering. Errors are
+// logged, and the MID is then reported as unknown.
+//
+// HasMID does not take the mailbox lock, so unlike Add and Prune it may be
+// called while the mailbox is locked by the calling goroutine.
+func (h *History) HasMID(MID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.has(MID) {
+		return true
+	}
+	if err := h.reload(); err != nil {
+		log.Printf("Unable to read MID history: %s", err)
+		return false
+	}
+	return h.has(MID)
+}
+
+// has reports whether MID is known and not expired. The caller must hold h.mu.
+func (h *History) has(MID string) bool {
+	t, ok := h.mids[MID]
+	return ok && !h.expired(t, time.Now())
+}
+
+// reload loads the history file if it has changed since it was last read.
+// The caller must hold h.mu.
+//
+// The mailbox lock is not needed: the file is only appended to, or replaced
+// atomically, and a partially written last line is ignored by load.
+func (h *History) reload() error {
+	fi, err := os.Stat(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if h.loaded != nil && os.SameFile(fi, h.loaded) && fi.Size() == h.loaded.Size() && fi.ModTime().Equal(h.loaded.ModTime()) {
+		return nil
+	}
+	return h.load()
+}
+
+// Len returns the number of MIDs in the history.
+func (h *History) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.mids)
+}
+
+// Add records the given MIDs as received now.
+func (h *History) Add(MIDs ...string) error {
+	now := time.Now()
+	received := make(map[string]time.Time, len(MIDs))
+	for _, MID := range MIDs {
+		received[MID] = now
+	}
+	return h.add(received)
+}
+
+// add records the given MIDs with their receive time, and appends them to the history file.
+func (h *History) add(received map[string]time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	MIDs := make([]string, 0, len(received))
+	for MID := range received {
+		MIDs = append(MIDs, MID)
+	}
+	sort.Strings(MIDs)
+
+	var buf bytes.Buffer
+	now := time.Now()
+	for _, MID := range MIDs {
+		t := received[MID]
+		if MID == "" || h.expired(t, now) {
+			continue
+		}
+		if prev, ok := h.mids[MID]; ok && !t.After(prev) {
+			continue
+		}
+		h.mids[MID] = t
+		fmt.Fprintf(&buf, "%s %d\n", MID, t.Unix())
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	unlock, err := lockMailbox(filepath.Dir(h.path))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("Unable to open MID history: %w", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("Unable to write MID history: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Prune removes expired MIDs, and re-writes the history file.
+//
+// MIDs added by other processes sharing the mailbox are loaded in the process.
+func (h *History) Prune() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	unlock, err := lockMailbox(filepath.Dir(h.path))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := h.load(); err != nil {
+		return fmt.Errorf("Unable to read MID history: %w", err)
+	}
+
+	now := time.Now()
+	MIDs := make([]string, 0, len(h.mids))
+	for MID, t := range h.mids {
+		if h.expired(t, now) {
+			delete(h.mids, MID)
+			continue
+		}
+		MIDs = append(MIDs, MID)
+	}
+	sort.Strings(MIDs)
+
+	var buf bytes.Buffer
+	for _, MID := range MIDs {
+		fmt.Fprintf(&buf, "%s %d\n", MID, h.mids[MID].Unix())
+	}
+	return writeFileAtomic(h.path, buf.Bytes(), 0644)
+}
+
+// Import seeds the history with the messages found in the given folders (e.g. DIR_ARCHIVE)
+// of the mailbox rooted at mboxPath.
+//
+// The receive time of each message is taken from the message's date, or the
+// modification time of the message file if the date is missing.
+func (h *History) Import(mboxPath string, folders ...string) error {
+	received := make(map[string]time.Time)
+	for _, folder := range folders {
+		dir := path.Join(mboxPath, folder)
+		infos, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		for _, fi := range infos {
+			if !isMessageFile(fi) {
+				continue
+			}
+			msg, err := OpenMessage(path.Join(dir, fi.Name()))
+			if err != nil {
+				continue // Unreadable files are handled (quarantined) by DirHandler
+			}
+			t := msg.Date()
+			if t.IsZero() {
+				t = fi.ModTime()
+			}
+			if t.After(received[msg.MID()]) {
+				received[msg.MID()] = t
+			}
+		}
+	}
+	if err := h.add(received); err != nil {
+		return err
+	}
+
+	// Make sure the file exists, so that we don't import again on next open.
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (h *History) expired(t, now time.Time) bool {
+	return h.Retention > 0 && now.Sub(t) > h.Retention
+}
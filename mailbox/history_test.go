@@ -0,0 +1,180 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+func TestHistoryRejectsArchivedMessages(t *testing.T) {
+	h := newTestDirHandler(t)
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// The user archives the message
+	if err := os.Rename(
+		path.Join(h.MBoxPath, DIR_INBOX, msg.MID()+Ext),
+		path.Join(h.MBoxPath, DIR_ARCHIVE, msg.MID()+Ext),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := msg.Proposal(fbb.BasicProposal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer := h.GetInboundAnswer(*p); answer != fbb.Reject {
+		t.Errorf("Expected archived message to be rejected, got %c", answer)
+	}
+
+	// The history is persisted
+	other := NewDirHandler(h.MBoxPath, false)
+	if err := other.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if answer := other.GetInboundAnswer(*p); answer != fbb.Reject {
+		t.Errorf("Expected archived message to be rejected by new handler, got %c", answer)
+	}
+}
+
+func TestHistoryImport(t *testing.T) {
+	dir := t.TempDir()
+	if err := ensureDirStructure(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	recent := newTestMessage("N0CALL", "LA5NTA")
+	old := newTestMessage("N0CALL", "LA5NTA")
+	old.SetDate(time.Now().Add(-48 * time.Hour))
+	for folder, msg := range map[string]*fbb.Message{DIR_ARCHIVE: recent, DIR_SENT: old} {
+		data, err := msg.Bytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(dir, folder, msg.MID()+Ext), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := OpenHistory(dir, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !history.HasMID(recent.MID()) {
+		t.Errorf("Archived message not imported")
+	}
+	if history.HasMID(old.MID()) {
+		t.Errorf("Message older than retention imported")
+	}
+
+	// MIDs added by another handle are kept when pruning
+	other, err := OpenHistory(dir, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Add("NEWMID"); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if !history.HasMID("NEWMID") || history.Len() != 2 {
+		t.Errorf("Expected 2 MIDs after prune, got %d", history.Len())
+	}
+}
+
+func TestHistorySharedMailbox(t *testing.T) {
+	dir := t.TempDir()
+	if err := ensureDirStructure(dir); err != nil {
+		t.Fatal(err)
+	}
+	a, err := OpenHistory(dir, DefaultHistoryRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := OpenHistory(dir, DefaultHistoryRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A MID received by another process is seen without re-opening the history
+	if b.HasMID("ABCDEF123456") {
+		t.Fatal("Unexpected MID in empty history")
+	}
+	if err := a.Add("ABCDEF123456"); err != nil {
+		t.Fatal(err)
+	}
+	if !b.HasMID("ABCDEF123456") {
+		t.Error("MID added by another process not found")
+	}
+
+	// Also after the other process has re-written the file
+	if err := a.Add("123456ABCDEF"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Prune(); err != nil {
+		t.Fatal(err)
+	}
+	if !b.HasMID("123456ABCDEF") {
+		t.Error("MID added by another process not found after prune")
+	}
+}
+
+func TestHistoryHasMIDWithLockHeld(t *testing.T) {
+	dir := t.TempDir()
+	h, err := OpenHistory(dir, DefaultHistoryRetention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Add("ABCDEF123456"); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := lockMailbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	done := make(chan bool)
+	go func() { done <- h.HasMID("123456ABCDEF") }()
+	select {
+	case found := <-done:
+		if found {
+			t.Error("Unexpected MID in history")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("HasMID blocked on the mailbox lock")
+	}
+}
+
+func TestMemHandlerHistoryRetention(t *testing.T) {
+	h := NewMemHandler(false)
+	h.HistoryRetention = time.Millisecond
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Move(msg.MID(), DIR_INBOX, DIR_ARCHIVE); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := msg.Proposal(fbb.BasicProposal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if answer := h.GetInboundAnswer(*p); answer != fbb.Accept {
+		t.Errorf("Expected message received before the retention period to be accepted, got %c", answer)
+	}
+}
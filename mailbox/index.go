@@ -0,0 +1,594 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+const (
+	indexFileName       = ".index.jsonl"
+	legacyIndexFileName = ".index.json" // Replaced by the journal, removed when the index is opened.
+
+	// The journal is compacted when it holds more than twice the number of
+	// live entries, plus this slack.
+	indexCompactSlack = 100
+)
+
+// indexRecord is a line in the index journal. Later records replace earlier ones with the same key.
+type indexRecord struct {
+	Entry   *IndexEntry `json:",omitempty"`
+	Removed string      `json:",omitempty"` // The key of a removed entry.
+}
+
+// IndexEntry holds the indexed fields of a message.
+type IndexEntry struct {
+	MID        string
+	Folder     string // The mailbox folder, e.g. DIR_INBOX.
+	File       string // The file name within Folder.
+	From       string
+	To         []string
+	Cc         []string
+	Subject    string
+	Date       time.Time
+	Type       fbb.MsgType
+	Precedence fbb.Precedence
+	Size       int64 // Size of the message file in bytes.
+	Files      int   // Number of attachments.
+	Flags      Flags
+	Unread     bool // Equal to !Flags.Has(FlagRead).
+
+	ModTime time.Time // Modification time of the message file when it was indexed.
+	Tokens  []string  // Free text tokens (subject, addresses, body and attachment names).
+}
+
+// Path returns the path of the message file relative to the mailbox root.
+func (e IndexEntry) Path() string { return path.Join(e.Folder, e.File) }
+
+func (e IndexEntry) key() string { return e.Path() }
+
+// Index is a persistent index of the messages in a DirHandler mailbox.
+//
+// The index allows listing and searching the mailbox without parsing the
+// message files. It's kept up to date by the DirHandler it was opened by,
+// and changes made by others (other processes, or direct file system access)
+// are detected by Refresh. The index is stored as an append-only journal in a
+// hidden file in the mailbox root, so that an update costs the size of the
+// changed entries only. The journal is compacted when it has grown to twice
+// the size of the index. It can be deleted or rebuilt at any time.
+//
+// An Index is safe for concurrent use.
+type Index struct {
+	root string
+
+	mu      sync.Mutex
+	entries map[string]*IndexEntry // Keyed by IndexEntry.key()
+	tokens  map[string]map[string]struct{}
+	journal int  // Number of records in the journal file.
+	rewrite bool // The journal must be compacted on the next save (e.g. after it was found corrupt).
+}
+
+// OpenIndex opens the index of the mailbox rooted at mboxPath.
+//
+// The index is created if it does not exist, and refreshed to reflect the current state of the mailbox.
+func OpenIndex(mboxPath string) (*Index, error) {
+	idx := &Index{root: mboxPath}
+	idx.reset()
+	os.Remove(filepath.Join(mboxPath, legacyIndexFileName))
+
+	f, err := os.Open(filepath.Join(mboxPath, indexFileName))
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		err := idx.load(f)
+		f.Close()
+		if err != nil {
+			// Refresh re-indexes whatever is missing, and the journal is rewritten on the next save.
+			log.Printf("Corrupt mailbox index, rebuilding: %s", err)
+			idx.rewrite = true
+		}
+	}
+
+	return idx, idx.Refresh()
+}
+
+// load replays the journal read from r.
+func (idx *Index) load(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 16*1024*1024)
+	for s.Scan() {
+		var rec indexRecord
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			return err
+		}
+		switch {
+		case rec.Entry != nil:
+			idx.remove(rec.Entry.key())
+			idx.add(rec.Entry)
+		case rec.Removed != "":
+			idx.remove(rec.Removed)
+		}
+		idx.journal++
+	}
+	return s.Err()
+}
+
+func (idx *Index) reset() {
+	idx.entries = make(map[string]*IndexEntry)
+	idx.tokens = make(map[string]map[string]struct{})
+}
+
+// Rebuild discards the index and re-indexes every message in the mailbox.
+func (idx *Index) Rebuild() error {
+	idx.mu.Lock()
+	idx.reset()
+	idx.rewrite = true
+	idx.mu.Unlock()
+	return idx.Refresh()
+}
+
+// Refresh brings the index up to date with the mailbox on disk.
+//
+// Only new or modified message files are parsed.
+func (idx *Index) Refresh() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	folders, err := listFolders(idx.root)
+	if err != nil {
+		return err
+	}
+
+	store, err := readFlags(idx.root)
+	if err != nil {
+		return err
+	}
+
+	var changed []string
+	seen := make(map[string]bool, len(idx.entries))
+	for _, folder := range folders {
+		files, err := ioutil.ReadDir(path.Join(idx.root, folder))
+		if err != nil {
+			return err
+		}
+		for _, fi := range files {
+			if !isMessageFile(fi) {
+				continue
+			}
+			key := path.Join(folder, fi.Name())
+			seen[key] = true
+			if e, ok := idx.entries[key]; ok && e.ModTime.Equal(fi.ModTime()) && e.Size == fi.Size() {
+				// Flags are stored outside the message file
+				if r, ok := store[e.MID]; ok && r.Flags != e.Flags {
+					e.setFlags(r.Flags)
+					changed = append(changed, key)
+				}
+				continue
+			}
+			if err := idx.update(store, folder, fi.Name()); err != nil {
+				log.Println(err)
+				continue
+			}
+			changed = append(changed, key)
+		}
+	}
+	for key := range idx.entries {
+		if !seen[key] {
+			idx.remove(key)
+			changed = append(changed, key)
+		}
+	}
+	return idx.save(changed)
+}
+
+// Update (re-)indexes the given message files (relative to the mailbox root), and saves the index.
+//
+// Files that no longer exist are removed from the index.
+func (idx *Index) Update(relPaths ...string) error {
+	if len(relPaths) == 0 {
+		return nil
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	store, err := readFlags(idx.root)
+	if err != nil {
+		return err
+	}
+	changed := make([]string, 0, len(relPaths))
+	for _, p := range relPaths {
+		folder, file := path.Split(path.Clean("/" + p))
+		if err := idx.update(store, folder, file); os.IsNotExist(err) {
+			idx.remove(path.Join(folder, file))
+		} else if err != nil {
+			return err
+		}
+		changed = append(changed, path.Join(folder, file))
+	}
+	return idx.save(changed)
+}
+
+// Get returns the index entry of the message identified by MID in the given folder.
+func (idx *Index) Get(folder, MID string) (IndexEntry, bool) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	e, ok := idx.entries[path.Join(normFolder(folder), MID+Ext)]
+	if !ok {
+		return IndexEntry{}, false
+	}
+	return *e, true
+}
+
+func (e *IndexEntry) setFlags(flags Flags) {
+	e.Flags = flags
+	e.Unread = !flags.Has(FlagRead)
+}
+
+func (idx *Index) update(store flagStore, folder, file string) error {
+	filePath := path.Join(idx.root, folder, file)
+	fi, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	msg, err := OpenMessage(filePath)
+	if err != nil {
+		return err
+	}
+
+	e := &IndexEntry{
+		MID:        msg.MID(),
+		Folder:     normFolder(folder),
+		File:       file,
+		From:       msg.From().String(),
+		To:         addrStrings(msg.To()),
+		Cc:         addrStrings(msg.Cc()),
+		Subject:    msg.Subject(),
+		Date:       msg.Date().UTC(),
+		Type:       msg.Type(),
+		Precedence: msg.Precedence(),
+		Size:       fi.Size(),
+		Files:      len(msg.Files()),
+		ModTime:    fi.ModTime(),
+	}
+	e.setFlags(store.flags(msg))
+
+	body, _ := msg.Body()
+	text := []string{e.From, e.Subject, body}
+	text = append(text, e.To...)
+	text = append(text, e.Cc...)
+	for _, f := range msg.Files() {
+		text = append(text, f.Name())
+	}
+	e.Tokens = tokenize(strings.Join(text, " "))
+
+	idx.remove(e.key())
+	idx.add(e)
+	return nil
+}
+
+func (idx *Index) add(e *IndexEntry) {
+	key := e.key()
+	idx.entries[key] = e
+	for _, t := range e.Tokens {
+		set, ok := idx.tokens[t]
+		if !ok {
+			set = make(map[string]struct{})
+			idx.tokens[t] = set
+		}
+		set[key] = struct{}{}
+	}
+}
+
+func (idx *Index) remove(key string) {
+	e, ok := idx.entries[key]
+	if !ok {
+		return
+	}
+	delete(idx.entries, key)
+	for _, t := range e.Tokens {
+		delete(idx.tokens[t], key)
+		if len(idx.tokens[t]) == 0 {
+			delete(idx.tokens, t)
+		}
+	}
+}
+
+// save appends the current state of the entries with the given keys to the journal.
+//
+// The journal is rewritten with only the live entries if it has grown too large.
+func (idx *Index) save(keys []string) error {
+	if len(keys) == 0 && !idx.rewrite {
+		return nil
+	}
+	if idx.rewrite || idx.journal+len(keys) > 2*len(idx.entries)+indexCompactSlack {
+		return idx.compact()
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, key := range keys {
+		rec := indexRecord{Removed: key}
+		if e, ok := idx.entries[key]; ok {
+			rec = indexRecord{Entry: e}
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+
+	unlock, err := lockMailbox(idx.root)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	f, err := os.OpenFile(filepath.Join(idx.root, indexFileName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	idx.journal += len(keys)
+	return f.Close()
+}
+
+// compact rewrites the journal with one record per live entry.
+func (idx *Index) compact() error {
+	keys := make([]string, 0, len(idx.entries))
+	for key := range idx.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, key := range keys {
+		if err := enc.Encode(indexRecord{Entry: idx.entries[key]}); err != nil {
+			return err
+		}
+	}
+
+	unlock, err := lockMailbox(idx.root)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := writeFileAtomic(filepath.Join(idx.root, indexFileName), buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	idx.journal, idx.rewrite = len(keys), false
+	return nil
+}
+
+// Query describes a search in the index. Zero value fields are ignored.
+type Query struct {
+	Folder string // Only messages in this folder (e.g. DIR_INBOX).
+
+	From    string // Case-insensitive substring of the sender address.
+	To      string // Case-insensitive substring of any receiver address (To or Cc).
+	Subject string // Case-insensitive substring of the subject.
+
+	Since, Until time.Time // Date range [Since, Until).
+
+	Precedence []fbb.Precedence // Only messages with one of these precedences.
+	UnreadOnly bool
+	Flags      Flags // Only messages with all of these flags set.
+
+	// Free text. All words must be found in the subject, addresses, body or attachment names.
+	//
+	// Only words of two or more letters or digits are searched for, so a text
+	// without such words (e.g. only punctuation) matches no messages.
+	Text string
+
+	Offset, Limit int // Paging. Zero Limit means no limit.
+}
+
+// SearchResult holds a page of search results.
+type SearchResult struct {
+	Total   int          // Total number of matches.
+	Entries []IndexEntry // The requested page, ordered by date (most recent first).
+}
+
+// Search returns the index entries matching the given query.
+//
+// The index is refreshed before the search.
+func (idx *Index) Search(q Query) (SearchResult, error) {
+	if err := idx.Refresh(); err != nil {
+		return SearchResult{}, err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	tokens := tokenize(q.Text)
+	if len(tokens) == 0 && strings.TrimSpace(q.Text) != "" {
+		return SearchResult{}, nil // Nothing searchable
+	}
+
+	var candidates map[string]struct{}
+	for _, t := range tokens {
+		set := idx.tokens[t]
+		if candidates == nil {
+			candidates = make(map[string]struct{}, len(set))
+			for k := range set {
+				candidates[k] = struct{}{}
+			}
+			continue
+		}
+		for k := range candidates {
+			if _, ok := set[k]; !ok {
+				delete(candidates, k)
+			}
+		}
+	}
+
+	var matches []IndexEntry
+	for key, e := range idx.entries {
+		if candidates != nil {
+			if _, ok := candidates[key]; !ok {
+				continue
+			}
+		}
+		if q.match(e) {
+			matches = append(matches, *e)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if !matches[i].Date.Equal(matches[j].Date) {
+			return matches[i].Date.After(matches[j].Date)
+		}
+		return matches[i].key() < matches[j].key()
+	})
+
+	res := SearchResult{Total: len(matches)}
+	if q.Offset < len(matches) {
+		matches = matches[q.Offset:]
+		if q.Limit > 0 && q.Limit < len(matches) {
+			matches = matches[:q.Limit]
+		}
+		res.Entries = matches
+	}
+	return res, nil
+}
+
+func (q Query) match(e *IndexEntry) bool {
+	switch {
+	case q.Folder != "" && normFolder(q.Folder) != e.Folder:
+		return false
+	case q.From != "" && !containsFold(e.From, q.From):
+		return false
+	case q.Subject != "" && !containsFold(e.Subject, q.Subject):
+		return false
+	case !q.Since.IsZero() && e.Date.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !e.Date.Before(q.Until):
+		return false
+	case q.UnreadOnly && !e.Unread:
+		return false
+	case !e.Flags.Has(q.Flags):
+		return false
+	}
+
+	if q.To != "" {
+		var found bool
+		for _, a := range append(append([]string{}, e.To...), e.Cc...) {
+			if containsFold(a, q.To) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(q.Precedence) > 0 {
+		var found bool
+		for _, p := range q.Precedence {
+			found = found || p == e.Precedence
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Index returns the index of this mailbox, opening it on first use.
+//
+// Once opened, the index is kept up to date by the handler.
+func (h *DirHandler) Index() (*Index, error) {
+	h.indexMu.Lock()
+	defer h.indexMu.Unlock()
+	if h.index != nil {
+		return h.index, nil
+	}
+	idx, err := OpenIndex(h.MBoxPath)
+	if err != nil {
+		return nil, err
+	}
+	h.index = idx
+	return idx, nil
+}
+
+// reindex updates the index (if opened) with the given message files (relative to the mailbox root).
+func (h *DirHandler) reindex(relPaths ...string) {
+	h.indexMu.Lock()
+	idx := h.index
+	h.indexMu.Unlock()
+	if idx == nil || len(relPaths) == 0 {
+		return
+	}
+	if err := idx.Update(relPaths...); err != nil {
+		log.Printf("Unable to update mailbox index: %s", err)
+	}
+}
+
+// listFolders returns the message folders of the mailbox rooted at mboxPath (e.g. DIR_INBOX).
+func listFolders(mboxPath string) ([]string, error) {
+	infos, err := ioutil.ReadDir(mboxPath)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read dir (%s): %w", mboxPath, err)
+	}
+	var folders []string
+	for _, fi := range infos {
+		if !fi.IsDir() || fi.Name()[0] == '.' || normFolder(fi.Name()) == DIR_QUARANTINE {
+			continue
+		}
+		folders = append(folders, normFolder(fi.Name()))
+	}
+	return folders, nil
+}
+
+// normFolder returns the folder name in the same form as the DIR_* constants (e.g. "/in/").
+func normFolder(name string) string { return "/" + strings.Trim(name, "/") + "/" }
+
+func addrStrings(addrs []fbb.Address) []string {
+	strs := make([]string, len(addrs))
+	for i, a := range addrs {
+		strs[i] = a.String()
+	}
+	return strs
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// tokenize splits text into unique lower case words of two or more characters.
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	seen := make(map[string]bool, len(words))
+	tokens := make([]string, 0, len(words))
+	for _, w := range words {
+		if len([]rune(w)) < 2 || seen[w] {
+			continue
+		}
+		seen[w] = true
+		tokens = append(tokens, w)
+	}
+	return tokens
+}
@@ -0,0 +1,216 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+func TestIndexSearch(t *testing.T) {
+	h := newTestDirHandler(t)
+	idx, err := h.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weather := newTestMessage("N0CALL", "LA5NTA")
+	weather.SetSubject("//WL2K P/ Weather report")
+	weather.SetBody("Gale warning for the coast")
+
+	status := newTestMessage("LA1B", "LA5NTA")
+	status.SetSubject("Status")
+	status.SetBody("All good on board")
+
+	if err := h.ProcessInbound(weather, status); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddOut(newTestMessage("LA5NTA", "N0CALL")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		query  Query
+		expect []string
+	}{
+		{"folder", Query{Folder: DIR_INBOX}, []string{weather.MID(), status.MID()}},
+		{"from", Query{From: "la1b"}, []string{status.MID()}},
+		{"subject", Query{Subject: "weather"}, []string{weather.MID()}},
+		{"text", Query{Text: "GALE coast"}, []string{weather.MID()}},
+		{"text no match", Query{Text: "gale board"}, nil},
+		{"text without words", Query{Text: "a ! - ?"}, nil},
+		{"precedence", Query{Precedence: []fbb.Precedence{fbb.PrecedencePriority}}, []string{weather.MID()}},
+		{"unread", Query{UnreadOnly: true, To: "la5nta"}, []string{weather.MID(), status.MID()}},
+	}
+	for _, tt := range tests {
+		res, err := idx.Search(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameMIDs(res.Entries, tt.expect) {
+			t.Errorf("%s: got %v, expected %v", tt.name, res.Entries, tt.expect)
+		}
+	}
+
+	res, err := idx.Search(Query{Limit: 2, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 3 || len(res.Entries) != 2 {
+		t.Errorf("Unexpected page: total %d, %d entries", res.Total, len(res.Entries))
+	}
+
+	// Sent messages are moved by the handler
+	outbound := h.GetOutbound()
+	h.SetSent(outbound[0].MID(), false)
+	if e, ok := idx.Get(DIR_SENT, outbound[0].MID()); !ok || e.Folder != DIR_SENT {
+		t.Errorf("Sent message not found in index: %+v", e)
+	}
+	if _, ok := idx.Get(DIR_OUTBOX, outbound[0].MID()); ok {
+		t.Errorf("Sent message still indexed in outbox")
+	}
+}
+
+func TestIndexRefresh(t *testing.T) {
+	h := newTestDirHandler(t)
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := OpenIndex(h.MBoxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := idx.Get(DIR_INBOX, msg.MID()); !ok || !e.Unread {
+		t.Fatalf("Expected unread message in index, got %+v", e)
+	}
+
+	// Changes made without the handler are picked up on refresh
+	opened, err := OpenMessage(path.Join(h.MBoxPath, DIR_INBOX, msg.MID()+Ext))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetUnread(opened, false); err != nil {
+		t.Fatal(err)
+	}
+	res, err := idx.Search(Query{UnreadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 0 {
+		t.Errorf("Expected no unread messages, got %d", res.Total)
+	}
+
+	if err := os.Remove(path.Join(h.MBoxPath, DIR_INBOX, msg.MID()+Ext)); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := idx.Get(DIR_INBOX, msg.MID()); ok {
+		t.Errorf("Removed message still indexed")
+	}
+
+	// The index is persisted
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.Rebuild(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenIndex(h.MBoxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reopened.Get(DIR_INBOX, msg.MID()); !ok {
+		t.Errorf("Message missing from reopened index")
+	}
+}
+
+func sameMIDs(entries []IndexEntry, MIDs []string) bool {
+	if len(entries) != len(MIDs) {
+		return false
+	}
+	want := make(map[string]bool, len(MIDs))
+	for _, MID := range MIDs {
+		want[MID] = true
+	}
+	for _, e := range entries {
+		if !want[e.MID] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIndexJournal(t *testing.T) {
+	h := newTestDirHandler(t)
+	idx, err := h.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	journalLines := func() int {
+		t.Helper()
+		data, err := ioutil.ReadFile(path.Join(h.MBoxPath, indexFileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes.Count(data, []byte("\n"))
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := h.ProcessInbound(newTestMessage("N0CALL", "LA5NTA")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := journalLines(); n != 3 {
+		t.Errorf("Expected one journal record per message, got %d", n)
+	}
+
+	// Read-only operations and changes without message files don't write the index
+	if _, err := idx.Search(Query{Text: "hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.CreateFolder("Projects"); err != nil {
+		t.Fatal(err)
+	}
+	if n := journalLines(); n != 3 {
+		t.Errorf("Index written on read-only path, %d records", n)
+	}
+
+	// Only the changed entry is appended
+	msgs, _ := h.List(DIR_INBOX)
+	if err := h.MarkRead(msgs[0].MID(), true); err != nil {
+		t.Fatal(err)
+	}
+	if n := journalLines(); n != 4 {
+		t.Errorf("Expected 4 journal records, got %d", n)
+	}
+
+	// The journal is compacted when it has grown too large
+	for i := 0; i < indexCompactSlack+10; i++ {
+		if err := h.MarkRead(msgs[0].MID(), i%2 == 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := journalLines(); n >= 4+indexCompactSlack {
+		t.Errorf("Journal not compacted, %d records", n)
+	}
+
+	reopened, err := OpenIndex(h.MBoxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := reopened.Get(DIR_INBOX, msgs[0].MID()); !ok || e.Unread {
+		t.Errorf("Unexpected entry in reopened index: %+v", e)
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly || windows)
+
+package mailbox
+
+import (
+	"os"
+	"sync"
+)
+
+// Advisory file locking is not supported on this platform. Access is only serialized within the process.
+var fallbackLock sync.Mutex
+
+func lockFile(f *os.File) error   { fallbackLock.Lock(); return nil }
+func unlockFile(f *os.File) error { fallbackLock.Unlock(); return nil }
@@ -0,0 +1,722 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// Maildir++ folders used by MaildirHandler. The inbox is the Maildir root.
+const (
+	MaildirInbox   = ""
+	MaildirOutbox  = ".Outbox"
+	MaildirSent    = ".Sent"
+	MaildirArchive = ".Archive"
+	MaildirFailed  = ".Failed"
+)
+
+// Maildir message flags (see https://cr.yp.to/proto/maildir.html).
+const (
+	MaildirFlagReplied = 'R'
+	MaildirFlagSeen    = 'S'
+	MaildirFlagFlagged = 'F'
+)
+
+// MaildirHandler is a mailbox handler storing messages in Maildir++ format,
+// so that they can be read by standard mail tools (mutt, notmuch, dovecot, ...).
+//
+// Messages are stored as Internet (MIME) mail messages, see fbb.Message.WriteMIME.
+// Received messages are delivered to the inbox (the Maildir root). Outbound
+// messages are picked up from the OutboxFolder, which may also contain
+// messages composed by other mail clients. Sent messages are moved to the
+// .Sent folder, and expired messages to the .Failed folder.
+//
+// Like DirHandler, outbound messages are offered according to the Retry policy,
+// and the delivery state is persisted in the outbox message files. Received
+// MIDs are remembered by a History stored in the Maildir root.
+//
+// MaildirHandler is interchangeable with DirHandler. Note that Maildir file
+// names contain colons, and are therefore not supported on Windows.
+type MaildirHandler struct {
+	Path string
+
+	// OutboxFolder is the Maildir++ folder outbound messages are picked up from.
+	// Defaults to MaildirOutbox. Set to e.g. ".Drafts" to deliver drafts.
+	OutboxFolder string
+
+	// Retry controls when outbound messages are offered for delivery.
+	Retry RetryPolicy
+
+	// HistoryRetention is how long received MIDs are remembered (see History).
+	// It must be set before the first call to Prepare.
+	HistoryRetention time.Duration
+
+	sendOnly bool
+
+	mu        sync.Mutex
+	deferred  map[string]bool
+	attempted map[string]bool              // Outbound MIDs offered in this session.
+	outbound  map[string]string            // MID to file path, as of the last GetOutbound.
+	mids      map[string]map[string]string // MID by unique file name, per folder.
+
+	historyMu sync.Mutex
+	history   *History // Opened by History()
+}
+
+// NewMaildirHandler wraps the Maildir given by path as a MaildirHandler.
+//
+// If sendOnly is true, all inbound messages will be deferred.
+func NewMaildirHandler(path string, sendOnly bool) *MaildirHandler {
+	return &MaildirHandler{
+		Path:             path,
+		OutboxFolder:     MaildirOutbox,
+		Retry:            DefaultRetryPolicy,
+		HistoryRetention: DefaultHistoryRetention,
+		sendOnly:         sendOnly,
+	}
+}
+
+func (h *MaildirHandler) Prepare() error {
+	h.mu.Lock()
+	h.deferred = make(map[string]bool)
+	h.attempted = make(map[string]bool)
+	h.outbound = make(map[string]string)
+	h.mu.Unlock()
+
+	for _, folder := range []string{MaildirInbox, h.outboxFolder(), MaildirSent, MaildirArchive, MaildirFailed} {
+		for _, sub := range []string{"tmp", "new", "cur"} {
+			if err := os.MkdirAll(filepath.Join(h.Path, folder, sub), 0700); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := h.History()
+	return err
+}
+
+// History returns the received-MID history of this Maildir, opening it on first use.
+//
+// Once opened, the history is kept up to date by ProcessInbound and consulted by GetInboundAnswer.
+func (h *MaildirHandler) History() (*History, error) {
+	h.historyMu.Lock()
+	defer h.historyMu.Unlock()
+	if h.history != nil {
+		return h.history, nil
+	}
+	history, err := OpenHistory(h.Path, h.HistoryRetention)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open MID history: %w", err)
+	}
+	h.history = history
+	return history, nil
+}
+
+func (h *MaildirHandler) outboxFolder() string {
+	if h.OutboxFolder == "" {
+		return MaildirOutbox
+	}
+	return h.OutboxFolder
+}
+
+func (h *MaildirHandler) Inbox() ([]*fbb.Message, error)   { return h.load(MaildirInbox) }
+func (h *MaildirHandler) Outbox() ([]*fbb.Message, error)  { return h.load(h.outboxFolder()) }
+func (h *MaildirHandler) Sent() ([]*fbb.Message, error)    { return h.load(MaildirSent) }
+func (h *MaildirHandler) Archive() ([]*fbb.Message, error) { return h.load(MaildirArchive) }
+func (h *MaildirHandler) Failed() ([]*fbb.Message, error)  { return h.load(MaildirFailed) }
+
+// InboxCount returns the number of messages in the inbox. -1 on error.
+func (h *MaildirHandler) InboxCount() int   { return h.count(MaildirInbox) }
+func (h *MaildirHandler) OutboxCount() int  { return h.count(h.outboxFolder()) }
+func (h *MaildirHandler) SentCount() int    { return h.count(MaildirSent) }
+func (h *MaildirHandler) ArchiveCount() int { return h.count(MaildirArchive) }
+func (h *MaildirHandler) FailedCount() int  { return h.count(MaildirFailed) }
+
+// AddOut adds the given message to the outbox.
+func (h *MaildirHandler) AddOut(msg *fbb.Message) error {
+	_, err := h.deliver(h.outboxFolder(), msg)
+	return err
+}
+
+func (h *MaildirHandler) ProcessInbound(msgs ...*fbb.Message) error {
+	history, err := h.History()
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if err := h.deliverInbound(m); err != nil {
+			return fmt.Errorf("Unable to write received message (%s): %w", m.MID(), err)
+		}
+		if err := history.Add(m.MID()); err != nil {
+			log.Printf("Unable to record %s in MID history: %s", m.MID(), err)
+		}
+	}
+	return nil
+}
+
+// deliverInbound delivers msg to the inbox, unless it's already there.
+func (h *MaildirHandler) deliverInbound(msg *fbb.Message) error {
+	if err := validMID(msg.MID()); err != nil {
+		return err
+	}
+	unlock, err := lockMailbox(h.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, ok, err := h.find(MaildirInbox, msg.MID()); err != nil || ok {
+		return err
+	}
+	_, err = h.deliver(MaildirInbox, msg)
+	return err
+}
+
+func (h *MaildirHandler) GetInboundAnswer(p fbb.Proposal) fbb.ProposalAnswer {
+	if h.sendOnly {
+		return fbb.Defer
+	}
+	if err := validMID(p.MID()); err != nil {
+		log.Printf("Rejecting proposal: %s", err)
+		return fbb.Reject
+	}
+
+	if _, ok, err := h.find(MaildirInbox, p.MID()); err != nil {
+		log.Printf("Unable to determine if %s has been received: %s", p.MID(), err)
+	} else if ok {
+		return fbb.Reject
+	}
+
+	// The message might have been received and moved or deleted since.
+	if history, err := h.History(); err != nil {
+		log.Println(err)
+	} else if history.HasMID(p.MID()) {
+		return fbb.Reject
+	}
+	return fbb.Accept
+}
+
+func (h *MaildirHandler) GetOutbound(fws ...fbb.Address) []*fbb.Message {
+	files, err := h.files(h.outboxFolder())
+	if err != nil {
+		log.Println(err)
+	}
+
+	all := make([]*fbb.Message, 0, len(files))
+	for _, file := range files {
+		m, err := h.open(file)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		h.mu.Lock()
+		h.outbound[m.MID()] = file
+		h.mu.Unlock()
+		all = append(all, m)
+	}
+	return selectOutbound(h, h.Retry, all, time.Now(), fws)
+}
+
+func (h *MaildirHandler) sessionState(MID string) (deferred, offered bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.deferred[MID], h.attempted[MID]
+}
+
+func (h *MaildirHandler) attempt(MID string, now time.Time) error {
+	h.mu.Lock()
+	if h.attempted == nil || h.attempted[MID] {
+		h.mu.Unlock()
+		return nil // Not prepared, or already offered
+	}
+	h.attempted[MID] = true
+	h.mu.Unlock()
+	return h.updateOutbound(MID, func(msg *fbb.Message) { recordAttempt(msg, now) })
+}
+
+// fail moves the outbound message identified by MID to the .Failed folder with the given reason.
+func (h *MaildirHandler) fail(MID, reason string) error {
+	err := h.updateOutbound(MID, func(msg *fbb.Message) {
+		msg.Header.Set(HEADER_X_FAILURE_REASON, reason)
+	})
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	delete(h.outbound, MID)
+	h.mu.Unlock()
+	return h.move(MID, h.outboxFolder(), MaildirFailed)
+}
+
+// updateOutbound re-writes the outbound message identified by MID after applying fn to it.
+//
+// The file keeps its name, so that the change is not mistaken for a new message by mail clients.
+func (h *MaildirHandler) updateOutbound(MID string, fn func(msg *fbb.Message)) error {
+	if err := validMID(MID); err != nil {
+		return err
+	}
+	unlock, err := lockMailbox(h.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	file, err := h.outboundPath(MID)
+	if err != nil {
+		return err
+	}
+	msg, err := h.open(file)
+	if err != nil {
+		return err
+	}
+	fn(msg)
+	data, err := h.marshal(msg)
+	if err != nil {
+		return err
+	}
+	tmpPath := filepath.Join(h.Path, h.outboxFolder(), "tmp", maildirUnique(file))
+	return writeMaildirFile(tmpPath, file, data)
+}
+
+// outboundPath returns the path of the outbound message identified by MID.
+//
+// The MUA might have renamed the file (e.g. changed its flags) since GetOutbound.
+func (h *MaildirHandler) outboundPath(MID string) (string, error) {
+	h.mu.Lock()
+	file, ok := h.outbound[MID]
+	h.mu.Unlock()
+	if ok {
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+	file, ok, err := h.find(h.outboxFolder(), MID)
+	switch {
+	case err != nil:
+		return "", err
+	case !ok:
+		return "", fmt.Errorf("%s in %s: %w", MID, h.outboxFolder(), ErrNotFound)
+	}
+	h.mu.Lock()
+	h.outbound[MID] = file
+	h.mu.Unlock()
+	return file, nil
+}
+
+// SetSent moves the message identified by MID from the outbox to the .Sent folder.
+//
+// Errors are logged. See SetSentErr.
+func (h *MaildirHandler) SetSent(MID string, rejected bool) {
+	if err := h.SetSentErr(MID, rejected); err != nil {
+		log.Println(err)
+	}
+}
+
+// SetSentErr is like SetSent, but returns any error.
+//
+// It implements fbb.OutboundErrHandler.
+func (h *MaildirHandler) SetSentErr(MID string, rejected bool) error {
+	if err := validMID(MID); err != nil {
+		return err
+	}
+	unlock, err := lockMailbox(h.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	oldPath, err := h.outboundPath(MID)
+	if err != nil {
+		return fmt.Errorf("Unable to mark %s as sent: %w", MID, err)
+	}
+	h.mu.Lock()
+	delete(h.outbound, MID)
+	h.mu.Unlock()
+
+	newPath := filepath.Join(h.Path, MaildirSent, "cur", withFlags(maildirUnique(oldPath), flagsAdd(maildirFlags(oldPath), MaildirFlagSeen)))
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("Unable to move %s to %s: %w", oldPath, newPath, err)
+	}
+	h.remember(newPath, MID)
+	return nil
+}
+
+func (h *MaildirHandler) SetDeferred(MID string) {
+	if err := h.SetDeferredErr(MID); err != nil {
+		log.Println(err)
+	}
+}
+
+// SetDeferredErr is like SetDeferred, but returns any error.
+//
+// It implements fbb.OutboundErrHandler.
+func (h *MaildirHandler) SetDeferredErr(MID string) error {
+	h.mu.Lock()
+	h.deferred[MID] = true
+	h.mu.Unlock()
+	return h.updateOutbound(MID, func(msg *fbb.Message) {
+		msg.Header.Set(HEADER_X_LAST_ANSWER, AnswerDeferred)
+	})
+}
+
+// Move moves the message identified by MID from one folder to another.
+//
+// The folders are given either as DIR_* names (see DirHandler) or as Maildir++
+// folder names (e.g. ".Drafts"). The file keeps its name and flags.
+func (h *MaildirHandler) Move(MID, from, to string) error {
+	if err := validMID(MID); err != nil {
+		return err
+	}
+	from, err := h.maildirFolder(from)
+	if err != nil {
+		return err
+	}
+	if to, err = h.maildirFolder(to); err != nil {
+		return err
+	}
+	if from == to {
+		return fmt.Errorf("%s: %w", to, ErrMessageExists)
+	}
+	if fi, err := os.Stat(filepath.Join(h.Path, to, "cur")); err != nil || !fi.IsDir() {
+		return fmt.Errorf("%s: %w", to, ErrFolderNotFound)
+	}
+	return h.move(MID, from, to)
+}
+
+// move moves the message identified by MID between the given Maildir++ folders.
+func (h *MaildirHandler) move(MID, from, to string) error {
+	unlock, err := lockMailbox(h.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	oldPath, ok, err := h.find(from, MID)
+	if err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("%s in %s: %w", MID, from, ErrNotFound)
+	}
+	if _, ok, err := h.find(to, MID); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("%s in %s: %w", MID, to, ErrMessageExists)
+	}
+
+	// Keep the file in new/ or cur/, as the flags are unchanged.
+	sub := filepath.Base(filepath.Dir(oldPath))
+	newPath := filepath.Join(h.Path, to, sub, filepath.Base(oldPath))
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("Unable to move %s to %s: %w", oldPath, newPath, err)
+	}
+	h.remember(newPath, MID)
+	return nil
+}
+
+// maildirFolder returns the Maildir++ folder corresponding to the given folder name.
+func (h *MaildirHandler) maildirFolder(name string) (string, error) {
+	if strings.HasPrefix(name, ".") && len(name) > 1 && !strings.Contains(name, "..") && !strings.ContainsAny(name, `/\:`) {
+		return name, nil
+	}
+	folder, err := validFolder(name)
+	if err != nil {
+		return "", err
+	}
+	switch folder {
+	case DIR_INBOX:
+		return MaildirInbox, nil
+	case DIR_OUTBOX:
+		return h.outboxFolder(), nil
+	case DIR_SENT:
+		return MaildirSent, nil
+	case DIR_ARCHIVE:
+		return MaildirArchive, nil
+	case DIR_FAILED:
+		return MaildirFailed, nil
+	}
+	return "", fmt.Errorf("%s: %w", name, ErrFolderNotFound)
+}
+
+// SetUnread marks the given message (as loaded by this handler) as read/unread by changing its Maildir flags.
+func (h *MaildirHandler) SetUnread(msg *fbb.Message, unread bool) error {
+	if err := h.setFlag(msg, MaildirFlagSeen, !unread); err != nil {
+		return err
+	}
+	if unread {
+		msg.Header.Set("X-Unread", "true")
+	} else {
+		msg.Header.Del("X-Unread")
+	}
+	return nil
+}
+
+// SetReplied marks the given message (as loaded by this handler) as replied/not replied by changing its Maildir flags.
+func (h *MaildirHandler) SetReplied(msg *fbb.Message, replied bool) error {
+	return h.setFlag(msg, MaildirFlagReplied, replied)
+}
+
+func (h *MaildirHandler) setFlag(msg *fbb.Message, flag rune, on bool) error {
+	oldPath := msg.Header.Get("X-FilePath")
+	if oldPath == "" {
+		return fmt.Errorf("Missing X-FilePath header")
+	}
+
+	flags := maildirFlags(oldPath)
+	if on {
+		flags = flagsAdd(flags, flag)
+	} else {
+		flags = strings.Replace(flags, string(flag), "", -1)
+	}
+
+	// Messages with flags belong in cur/
+	folder := filepath.Dir(filepath.Dir(oldPath))
+	newPath := filepath.Join(folder, "cur", withFlags(maildirUnique(oldPath), flags))
+	if newPath == oldPath {
+		return nil
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	msg.Header.Set("X-FilePath", newPath)
+	return nil
+}
+
+// deliver writes msg to the given folder as described by the Maildir specification (tmp/ then new/).
+func (h *MaildirHandler) deliver(folder string, msg *fbb.Message) (string, error) {
+	if err := validMID(msg.MID()); err != nil {
+		return "", err
+	}
+	data, err := h.marshal(msg)
+	if err != nil {
+		return "", err
+	}
+
+	name := fmt.Sprintf("%d.%s.%s", time.Now().UnixNano(), msg.MID(), maildirHostname())
+	tmpPath := filepath.Join(h.Path, folder, "tmp", name)
+	newPath := filepath.Join(h.Path, folder, "new", name)
+	if err := writeMaildirFile(tmpPath, newPath, data); err != nil {
+		return "", err
+	}
+	h.remember(newPath, msg.MID())
+	return newPath, nil
+}
+
+// marshal returns the MIME encoding of msg, without the headers that are implicit in a Maildir.
+func (h *MaildirHandler) marshal(msg *fbb.Message) ([]byte, error) {
+	// The read state is stored as Maildir flags, and the file path is implicit.
+	cpy := *msg
+	cpy.Header = make(fbb.Header, len(msg.Header))
+	for k, v := range msg.Header {
+		cpy.Header[k] = v
+	}
+	cpy.Header.Del("X-FilePath")
+	cpy.Header.Del("X-Unread")
+
+	var buf bytes.Buffer
+	if err := cpy.WriteMIME(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeMaildirFile writes data to tmpPath, and renames it to path once it's synced to disk.
+func writeMaildirFile(tmpPath, path string, data []byte) error {
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// files returns the paths of all messages in the given folder (new/ and cur/).
+func (h *MaildirHandler) files(folder string) ([]string, error) {
+	var paths []string
+	for _, sub := range []string{"new", "cur"} {
+		dir := filepath.Join(h.Path, folder, sub)
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read dir (%s): %w", dir, err)
+		}
+		for _, fi := range infos {
+			if fi.IsDir() || fi.Name()[0] == '.' {
+				continue
+			}
+			paths = append(paths, filepath.Join(dir, fi.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+func (h *MaildirHandler) count(folder string) int {
+	files, err := h.files(folder)
+	if err != nil {
+		return -1
+	}
+	return len(files)
+}
+
+func (h *MaildirHandler) load(folder string) ([]*fbb.Message, error) {
+	files, err := h.files(folder)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]*fbb.Message, 0, len(files))
+	for _, file := range files {
+		m, err := h.open(file)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		h.remember(file, m.MID())
+		msgs = append(msgs, m)
+	}
+	return msgs, nil
+}
+
+// open reads the message file, setting the private X-FilePath and X-Unread headers.
+func (h *MaildirHandler) open(path string) (*fbb.Message, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open file (%s): %w", path, err)
+	}
+	defer f.Close()
+
+	msg, err := fbb.ReadMIME(f)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse message (%s): %w", path, err)
+	}
+	msg.Header.Set("X-FilePath", path)
+	if !strings.ContainsRune(maildirFlags(path), MaildirFlagSeen) {
+		msg.Header.Set("X-Unread", "true")
+	}
+	return msg, nil
+}
+
+// find returns the path of the message identified by MID in the given folder.
+//
+// The MID of each file is cached by its unique name (which is kept when the
+// flags change or the file is moved), so that each file is parsed only once.
+func (h *MaildirHandler) find(folder, MID string) (string, bool, error) {
+	files, err := h.files(folder)
+	if err != nil {
+		return "", false, err
+	}
+
+	h.mu.Lock()
+	known := h.mids[folder]
+	h.mu.Unlock()
+
+	var found string
+	mids := make(map[string]string, len(files))
+	for _, file := range files {
+		unique := maildirUnique(file)
+		mid, ok := known[unique]
+		if !ok {
+			m, err := h.open(file)
+			if err != nil {
+				continue // Not cached, so that it's retried
+			}
+			mid = m.MID()
+		}
+		mids[unique] = mid
+		if mid == MID && found == "" {
+			found = file
+		}
+	}
+
+	// Replace the cache of this folder, dropping files that are gone.
+	h.mu.Lock()
+	if h.mids == nil {
+		h.mids = make(map[string]map[string]string)
+	}
+	h.mids[folder] = mids
+	h.mu.Unlock()
+	return found, found != "", nil
+}
+
+// remember caches the MID of the message file given by path. See find.
+func (h *MaildirHandler) remember(path, MID string) {
+	folder, err := filepath.Rel(h.Path, filepath.Dir(filepath.Dir(path)))
+	if err != nil {
+		return
+	}
+	if folder == "." {
+		folder = MaildirInbox
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.mids == nil {
+		h.mids = make(map[string]map[string]string)
+	}
+	if h.mids[folder] == nil {
+		h.mids[folder] = make(map[string]string)
+	}
+	h.mids[folder][maildirUnique(path)] = MID
+}
+
+// maildirUnique returns the unique part of the Maildir file name (without info/flags).
+func maildirUnique(path string) string {
+	name := filepath.Base(path)
+	if i := strings.Index(name, ":"); i >= 0 {
+		return name[:i]
+	}
+	return name
+}
+
+// maildirFlags returns the flags of the Maildir file name.
+func maildirFlags(path string) string {
+	name := filepath.Base(path)
+	if i := strings.Index(name, ":2,"); i >= 0 {
+		return name[i+3:]
+	}
+	return ""
+}
+
+func withFlags(unique, flags string) string { return unique + ":2," + flags }
+
+// flagsAdd adds flag to flags, keeping them in ASCII order as required by the specification.
+func flagsAdd(flags string, flag rune) string {
+	if strings.ContainsRune(flags, flag) {
+		return flags
+	}
+	b := []byte(flags + string(flag))
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	return string(b)
+}
+
+func maildirHostname() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "localhost"
+	}
+	return strings.NewReplacer("/", `\057`, ":", `\072`, ".", "_").Replace(host)
+}
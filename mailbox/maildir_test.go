@@ -0,0 +1,203 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+var (
+	_ fbb.MBoxHandler        = &MaildirHandler{}
+	_ fbb.OutboundErrHandler = &MaildirHandler{}
+)
+
+func newTestMaildirHandler(t *testing.T) *MaildirHandler {
+	h := NewMaildirHandler(t.TempDir(), false)
+	if err := h.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestMaildirInbound(t *testing.T) {
+	h := newTestMaildirHandler(t)
+	msg := newTestMessage("N0CALL", "LA5NTA")
+
+	prop, _ := msg.Proposal(fbb.Wl2kProposal)
+	if answer := h.GetInboundAnswer(*prop); answer != fbb.Accept {
+		t.Errorf("Expected Accept, got %v", answer)
+	}
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	if answer := h.GetInboundAnswer(*prop); answer != fbb.Reject {
+		t.Errorf("Expected Reject for already received message, got %v", answer)
+	}
+
+	files, _ := ioutil.ReadDir(filepath.Join(h.Path, "new"))
+	if len(files) != 1 {
+		t.Fatalf("Expected 1 file in new/, got %d", len(files))
+	}
+
+	inbox, err := h.Inbox()
+	if err != nil || len(inbox) != 1 {
+		t.Fatalf("Expected 1 message in inbox, got %d (%v)", len(inbox), err)
+	}
+	if inbox[0].MID() != msg.MID() || !IsUnread(inbox[0]) {
+		t.Errorf("Unexpected message in inbox")
+	}
+
+	if err := h.SetUnread(inbox[0], false); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetReplied(inbox[0], true); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(inbox[0].Header.Get("X-FilePath"), ":2,RS") {
+		t.Errorf("Unexpected file name %s", inbox[0].Header.Get("X-FilePath"))
+	}
+	if inbox, _ = h.Inbox(); IsUnread(inbox[0]) {
+		t.Errorf("Message still unread")
+	}
+}
+
+func TestMaildirOutbound(t *testing.T) {
+	h := newTestMaildirHandler(t)
+	msg := newTestMessage("LA5NTA", "N0CALL")
+	if err := h.AddOut(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// A message composed by a mail client
+	composed := strings.Join([]string{
+		"From: LA5NTA@winlink.org",
+		"To: N0CALL@winlink.org",
+		"Subject: Composed in mutt",
+		"Date: Fri, 30 Dec 2016 01:00:00 +0000",
+		"Message-ID: <20161230010000.GA1234@laptop>",
+		"",
+		"Hello",
+		"",
+	}, "\r\n")
+	if err := ioutil.WriteFile(filepath.Join(h.Path, MaildirOutbox, "cur", "1483059600.M1P1.laptop:2,S"), []byte(composed), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := h.GetOutbound()
+	if len(out) != 2 {
+		t.Fatalf("Expected 2 outbound messages, got %d", len(out))
+	}
+	for _, m := range out {
+		if err := m.Validate(); err != nil {
+			t.Errorf("Invalid outbound message: %s", err)
+		}
+		if m.Header.Get("X-FilePath") != "" {
+			t.Errorf("Private header not removed")
+		}
+		if err := h.SetSentErr(m.MID(), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if h.OutboxCount() != 0 || h.SentCount() != 2 {
+		t.Errorf("Expected 0 in outbox and 2 in sent, got %d and %d", h.OutboxCount(), h.SentCount())
+	}
+	if len(h.GetOutbound()) != 0 {
+		t.Errorf("Sent messages offered again")
+	}
+}
+
+func TestMaildirSentAfterRename(t *testing.T) {
+	h := newTestMaildirHandler(t)
+	composed := "From: LA5NTA@winlink.org\r\nTo: N0CALL@winlink.org\r\nSubject: Hi\r\nMessage-ID: <1@laptop>\r\n\r\nHello\r\n"
+	oldPath := filepath.Join(h.Path, MaildirOutbox, "new", "1483059600.M1P1.laptop")
+	if err := ioutil.WriteFile(oldPath, []byte(composed), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := h.GetOutbound()
+	if len(out) != 1 {
+		t.Fatalf("Expected 1 outbound message, got %d", len(out))
+	}
+
+	// The mail client marks the message as seen while it's being sent
+	if err := os.Rename(oldPath, filepath.Join(h.Path, MaildirOutbox, "cur", "1483059600.M1P1.laptop:2,S")); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetSentErr(out[0].MID(), false); err != nil {
+		t.Fatal(err)
+	}
+	if h.OutboxCount() != 0 || h.SentCount() != 1 {
+		t.Errorf("Expected 0 in outbox and 1 in sent, got %d and %d", h.OutboxCount(), h.SentCount())
+	}
+}
+
+func TestMaildirFindCachesMIDs(t *testing.T) {
+	h := newTestMaildirHandler(t)
+	composed := "From: LA5NTA@winlink.org\r\nTo: N0CALL@winlink.org\r\nSubject: Hi\r\nMessage-ID: <ABC123@winlink.org>\r\n\r\nHello\r\n"
+	file := filepath.Join(h.Path, "cur", "1483059600.M1P1.laptop:2,S")
+	if err := ioutil.WriteFile(file, []byte(composed), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := h.find(MaildirInbox, "ABC123"); err != nil || !ok {
+		t.Fatalf("Expected ABC123 to be found (%v)", err)
+	}
+
+	// The file is not parsed again once its MID is known, even if it's renamed
+	if err := ioutil.WriteFile(file, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(file, filepath.Join(h.Path, "cur", "1483059600.M1P1.laptop:2,RS")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := h.find(MaildirInbox, "ABC123"); !ok {
+		t.Errorf("Expected ABC123 to be found by its cached MID")
+	}
+
+	// A received message is written with its MID in the file name
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	if path, ok, _ := h.find(MaildirInbox, msg.MID()); !ok || !strings.Contains(filepath.Base(path), msg.MID()) {
+		t.Errorf("Unexpected path %q of received message", path)
+	}
+}
+
+func TestMaildirMove(t *testing.T) {
+	h := newTestMaildirHandler(t)
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Move(msg.MID(), DIR_INBOX, ".Drafts"); !errors.Is(err, ErrFolderNotFound) {
+		t.Errorf("Expected ErrFolderNotFound, got %v", err)
+	}
+	if err := h.Move(msg.MID(), DIR_INBOX, "../x"); !errors.Is(err, ErrInvalidFolder) {
+		t.Errorf("Expected ErrInvalidFolder, got %v", err)
+	}
+	if err := h.Move(msg.MID(), DIR_INBOX, DIR_ARCHIVE); err != nil {
+		t.Fatal(err)
+	}
+	if h.InboxCount() != 0 || h.ArchiveCount() != 1 {
+		t.Errorf("Expected 0 in inbox and 1 in archive, got %d and %d", h.InboxCount(), h.ArchiveCount())
+	}
+	if err := h.Move(msg.MID(), DIR_INBOX, DIR_ARCHIVE); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	// The message is still known as received
+	p, _ := msg.Proposal(fbb.BasicProposal)
+	if answer := h.GetInboundAnswer(*p); answer != fbb.Reject {
+		t.Errorf("Expected archived message to be rejected, got %c", answer)
+	}
+}
@@ -0,0 +1,428 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// MemHandler is an in-memory mailbox handler.
+//
+// It's semantically equivalent to DirHandler (using the same DIR_* folder names,
+// including user created folders), but nothing is persisted. Received MIDs are
+// remembered for HistoryRetention (see History), so messages that have been
+// moved out of the inbox are still rejected. It's useful for tests, and for
+// programs embedding a session that should not touch the disk (e.g. bridges
+// and relays).
+//
+// Unlike DirHandler, there is no trash or quarantine folder, and the
+// read/replied flags are only kept in the X-Unread header.
+//
+// Messages are stored in their serialized form, so messages passed to and
+// returned from the handler are never shared.
+//
+// A MemHandler is safe for concurrent use.
+type MemHandler struct {
+	// Retry controls when outbound messages are offered for delivery.
+	Retry RetryPolicy
+
+	// HistoryRetention is how long received MIDs are remembered. Zero means forever.
+	HistoryRetention time.Duration
+
+	// OnChange is called (if set) whenever the content of a folder changes,
+	// with the folder (e.g. DIR_INBOX) and the MID of the changed message.
+	//
+	// It's called without holding any locks, and may call back into the handler.
+	OnChange func(folder, MID string)
+
+	mu        sync.Mutex
+	folders   map[string]map[string][]byte // Serialized messages by MID, by folder.
+	deferred  map[string]bool
+	attempted map[string]bool      // Outbound MIDs offered in this session.
+	received  map[string]time.Time // Received MIDs, with the time of reception.
+	sendOnly  bool
+}
+
+// NewMemHandler returns a new, empty, in-memory mailbox handler.
+//
+// If sendOnly is true, all inbound messages will be deferred.
+func NewMemHandler(sendOnly bool) *MemHandler {
+	h := &MemHandler{
+		Retry:            DefaultRetryPolicy,
+		HistoryRetention: DefaultHistoryRetention,
+		sendOnly:         sendOnly,
+		folders:          make(map[string]map[string][]byte),
+		deferred:         make(map[string]bool),
+		received:         make(map[string]time.Time),
+	}
+	for _, folder := range []string{DIR_INBOX, DIR_OUTBOX, DIR_SENT, DIR_ARCHIVE, DIR_FAILED} {
+		h.folders[folder] = make(map[string][]byte)
+	}
+	return h
+}
+
+func (h *MemHandler) Prepare() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.deferred = make(map[string]bool)
+	h.attempted = make(map[string]bool)
+	return nil
+}
+
+func (h *MemHandler) Inbox() ([]*fbb.Message, error)   { return h.Snapshot(DIR_INBOX) }
+func (h *MemHandler) Outbox() ([]*fbb.Message, error)  { return h.Snapshot(DIR_OUTBOX) }
+func (h *MemHandler) Sent() ([]*fbb.Message, error)    { return h.Snapshot(DIR_SENT) }
+func (h *MemHandler) Archive() ([]*fbb.Message, error) { return h.Snapshot(DIR_ARCHIVE) }
+func (h *MemHandler) Failed() ([]*fbb.Message, error)  { return h.Snapshot(DIR_FAILED) }
+
+func (h *MemHandler) InboxCount() int   { return h.Count(DIR_INBOX) }
+func (h *MemHandler) OutboxCount() int  { return h.Count(DIR_OUTBOX) }
+func (h *MemHandler) SentCount() int    { return h.Count(DIR_SENT) }
+func (h *MemHandler) ArchiveCount() int { return h.Count(DIR_ARCHIVE) }
+func (h *MemHandler) FailedCount() int  { return h.Count(DIR_FAILED) }
+
+// Snapshot returns a copy of the messages in the given folder, ordered by MID.
+func (h *MemHandler) Snapshot(folder string) ([]*fbb.Message, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	msgs := h.folders[folder]
+	MIDs := make([]string, 0, len(msgs))
+	for MID := range msgs {
+		MIDs = append(MIDs, MID)
+	}
+	sort.Strings(MIDs)
+
+	out := make([]*fbb.Message, 0, len(MIDs))
+	for _, MID := range MIDs {
+		m, err := parseMessage(msgs[MID])
+		if err != nil {
+			return out, err
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// Count returns the number of messages in the given folder.
+func (h *MemHandler) Count(folder string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.folders[folder])
+}
+
+// Get returns a copy of the message identified by MID in the given folder.
+func (h *MemHandler) Get(folder, MID string) (*fbb.Message, bool) {
+	h.mu.Lock()
+	data, ok := h.folders[folder][MID]
+	h.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	m, err := parseMessage(data)
+	return m, err == nil
+}
+
+func (h *MemHandler) AddOut(msg *fbb.Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	h.folders[DIR_OUTBOX][msg.MID()] = data
+	h.mu.Unlock()
+
+	h.changed(DIR_OUTBOX, msg.MID())
+	return nil
+}
+
+func (h *MemHandler) ProcessInbound(msgs ...*fbb.Message) error {
+	encoded := make([][]byte, len(msgs))
+	for i, m := range msgs {
+		m.Header.Set("X-Unread", "true")
+		data, err := m.Bytes()
+		if err != nil {
+			return err
+		}
+		encoded[i] = data
+	}
+
+	now := time.Now()
+	h.mu.Lock()
+	for MID, t := range h.received {
+		if h.expired(t, now) {
+			delete(h.received, MID)
+		}
+	}
+	for i, m := range msgs {
+		h.folders[DIR_INBOX][m.MID()] = encoded[i]
+		h.received[m.MID()] = now
+	}
+	h.mu.Unlock()
+
+	for _, m := range msgs {
+		h.changed(DIR_INBOX, m.MID())
+	}
+	return nil
+}
+
+func (h *MemHandler) GetInboundAnswer(p fbb.Proposal) fbb.ProposalAnswer {
+	if h.sendOnly {
+		return fbb.Defer
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.folders[DIR_INBOX][p.MID()]; ok {
+		return fbb.Reject
+	}
+	if t, ok := h.received[p.MID()]; ok && !h.expired(t, time.Now()) {
+		return fbb.Reject
+	}
+	return fbb.Accept
+}
+
+// expired reports whether a MID received at t should be forgotten. The caller must hold h.mu.
+func (h *MemHandler) expired(t, now time.Time) bool {
+	return h.HistoryRetention > 0 && now.Sub(t) > h.HistoryRetention
+}
+
+// SetSent moves the message identified by MID from the outbox to the sent folder.
+//
+// Errors are logged. See SetSentErr.
+func (h *MemHandler) SetSent(MID string, rejected bool) {
+	if err := h.SetSentErr(MID, rejected); err != nil {
+		log.Println(err)
+	}
+}
+
+// SetSentErr is like SetSent, but returns any error.
+//
+// It implements fbb.OutboundErrHandler.
+func (h *MemHandler) SetSentErr(MID string, rejected bool) error {
+	return h.move(MID, DIR_OUTBOX, DIR_SENT)
+}
+
+// Folders returns the folders of this mailbox, both system and user created.
+func (h *MemHandler) Folders() ([]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	folders := make([]string, 0, len(h.folders))
+	for folder := range h.folders {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+	return folders, nil
+}
+
+// CreateFolder creates a new user folder.
+func (h *MemHandler) CreateFolder(name string) error {
+	folder, err := validFolder(name)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.folders[folder]; ok {
+		return fmt.Errorf("%s: %w", folder, ErrFolderExists)
+	}
+	h.folders[folder] = make(map[string][]byte)
+	return nil
+}
+
+// DeleteFolder deletes a user folder.
+//
+// As there is no trash, any messages in the folder are discarded.
+func (h *MemHandler) DeleteFolder(name string) error {
+	folder, err := validFolder(name)
+	if err != nil {
+		return err
+	}
+	if IsSystemFolder(folder) {
+		return ErrFolderReserved
+	}
+	h.mu.Lock()
+	msgs, ok := h.folders[folder]
+	delete(h.folders, folder)
+	h.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%s: %w", folder, ErrFolderNotFound)
+	}
+	for MID := range msgs {
+		h.changed(folder, MID)
+	}
+	return nil
+}
+
+// Move moves the message identified by MID from one folder to another.
+func (h *MemHandler) Move(MID, from, to string) error {
+	from, to, err := validTransfer(MID, from, to)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return fmt.Errorf("%s: %w", to, ErrMessageExists)
+	}
+	return h.transfer(MID, from, to, false, true)
+}
+
+// Copy copies the message identified by MID from one folder to another.
+func (h *MemHandler) Copy(MID, from, to string) error {
+	from, to, err := validTransfer(MID, from, to)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return fmt.Errorf("%s: %w", to, ErrMessageExists)
+	}
+	return h.transfer(MID, from, to, true, true)
+}
+
+// move moves the message identified by MID from one folder to another, replacing any message with the same MID.
+func (h *MemHandler) move(MID, from, to string) error {
+	return h.transfer(MID, from, to, false, false)
+}
+
+// transfer moves (or copies) the message identified by MID from one folder to another.
+//
+// If exclusive is true, ErrMessageExists is returned if the destination folder
+// already has a message with the same MID.
+func (h *MemHandler) transfer(MID, from, to string, copy, exclusive bool) error {
+	h.mu.Lock()
+	data, ok := h.folders[from][MID]
+	dst, found := h.folders[to]
+	_, exists := dst[MID]
+	var err error
+	switch {
+	case !found:
+		err = fmt.Errorf("%s: %w", to, ErrFolderNotFound)
+	case !ok:
+		err = fmt.Errorf("%s in %s: %w", MID, from, ErrNotFound)
+	case exclusive && exists:
+		err = fmt.Errorf("%s in %s: %w", MID, to, ErrMessageExists)
+	default:
+		if !copy {
+			delete(h.folders[from], MID)
+		}
+		dst[MID] = data
+	}
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if !copy {
+		h.changed(from, MID)
+	}
+	h.changed(to, MID)
+	return nil
+}
+
+func (h *MemHandler) SetDeferred(MID string) {
+	if err := h.SetDeferredErr(MID); err != nil {
+		log.Println(err)
+	}
+}
+
+// SetDeferredErr is like SetDeferred, but returns any error.
+//
+// It implements fbb.OutboundErrHandler.
+func (h *MemHandler) SetDeferredErr(MID string) error {
+	h.mu.Lock()
+	h.deferred[MID] = true
+	h.mu.Unlock()
+
+	if err := h.updateOutbound(MID, func(msg *fbb.Message) {
+		msg.Header.Set(HEADER_X_LAST_ANSWER, AnswerDeferred)
+	}); err != nil {
+		return fmt.Errorf("Unable to record deferral of %s: %w", MID, err)
+	}
+	return nil
+}
+
+// GetOutbound returns the outbound messages ready for delivery.
+//
+// See DirHandler.GetOutbound.
+func (h *MemHandler) GetOutbound(fws ...fbb.Address) []*fbb.Message {
+	all, err := h.Outbox()
+	if err != nil {
+		log.Println(err)
+	}
+
+	return selectOutbound(h, h.Retry, all, time.Now(), fws)
+}
+
+func (h *MemHandler) sessionState(MID string) (deferred, offered bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.deferred[MID], h.attempted[MID]
+}
+
+func (h *MemHandler) attempt(MID string, now time.Time) error {
+	h.mu.Lock()
+	first := h.attempted != nil && !h.attempted[MID]
+	if first {
+		h.attempted[MID] = true
+	}
+	h.mu.Unlock()
+	if !first {
+		return nil
+	}
+	return h.updateOutbound(MID, func(msg *fbb.Message) { recordAttempt(msg, now) })
+}
+
+// fail moves the outbound message identified by MID to the failed folder with the given reason.
+func (h *MemHandler) fail(MID, reason string) error {
+	err := h.updateOutbound(MID, func(msg *fbb.Message) {
+		msg.Header.Set(HEADER_X_FAILURE_REASON, reason)
+	})
+	if err != nil {
+		return err
+	}
+	return h.move(MID, DIR_OUTBOX, DIR_FAILED)
+}
+
+// updateOutbound re-encodes the outbound message identified by MID after applying fn to it.
+func (h *MemHandler) updateOutbound(MID string, fn func(msg *fbb.Message)) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	data, ok := h.folders[DIR_OUTBOX][MID]
+	if !ok {
+		return fmt.Errorf("Outbound message %s not found", MID)
+	}
+	msg, err := parseMessage(data)
+	if err != nil {
+		return err
+	}
+	fn(msg)
+	if data, err = msg.Bytes(); err != nil {
+		return err
+	}
+	h.folders[DIR_OUTBOX][MID] = data
+	return nil
+}
+
+func (h *MemHandler) changed(folder, MID string) {
+	if h.OnChange != nil {
+		h.OnChange(folder, MID)
+	}
+}
+
+func parseMessage(data []byte) (*fbb.Message, error) {
+	msg := new(fbb.Message)
+	if err := msg.ReadFrom(bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("Unable to parse message: %s", err)
+	}
+	return msg, nil
+}
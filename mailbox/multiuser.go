@@ -0,0 +1,265 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// MultiUserHandler is a mailbox handler serving several callsigns (e.g. a
+// personal call and a number of club or tactical calls) from one station.
+//
+// Each callsign has its own DirHandler sub-mailbox located at UserPath(root, callsign).
+// Inbound messages are routed to the sub-mailbox of each local recipient, and
+// outbound messages are collected from all sub-mailboxes. Messages not
+// addressed to any of the callsigns are routed to the primary callsign.
+//
+// The auxiliary callsigns should be registered with the session, so that
+// messages are requested on their behalf:
+//
+//	session.AddAuxiliaryAddress(h.AuxAddresses()...)
+type MultiUserHandler struct {
+	root     string
+	primary  string
+	sendOnly bool
+
+	mu       sync.Mutex
+	users    map[string]*DirHandler // Keyed by callsign
+	owner    map[string]string      // Callsign of outbound MIDs offered in this session
+	prepared bool                   // Prepare has been called
+}
+
+// NewMultiUserHandler returns a MultiUserHandler for the mailbox rooted at root,
+// serving the primary callsign mycall and the given auxiliary callsigns.
+//
+// If sendOnly is true, all inbound messages will be deferred.
+func NewMultiUserHandler(root string, sendOnly bool, mycall string, aux ...string) *MultiUserHandler {
+	h := &MultiUserHandler{
+		root:     root,
+		primary:  strings.ToUpper(mycall),
+		sendOnly: sendOnly,
+		users:    make(map[string]*DirHandler),
+	}
+	for _, call := range append([]string{mycall}, aux...) {
+		h.AddUser(call) // Not prepared yet, so it can't fail
+	}
+	return h
+}
+
+// AddUser adds a callsign to the handler, and returns its sub-mailbox.
+//
+// The sub-mailbox of an already added callsign is returned as is. If the
+// handler has already been prepared, the new sub-mailbox is prepared as well,
+// and the callsign is not added if that fails.
+func (h *MultiUserHandler) AddUser(callsign string) (*DirHandler, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	callsign = strings.ToUpper(callsign)
+	if u, ok := h.users[callsign]; ok {
+		return u, nil
+	}
+	u := NewDirHandler(UserPath(h.root, callsign), h.sendOnly)
+	if h.prepared {
+		if err := u.Prepare(); err != nil {
+			return nil, fmt.Errorf("Unable to prepare mailbox of %s: %w", callsign, err)
+		}
+	}
+	h.users[callsign] = u
+	return u, nil
+}
+
+// User returns the sub-mailbox of the given callsign, or nil if the callsign is not served by this handler.
+func (h *MultiUserHandler) User(callsign string) *DirHandler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.users[strings.ToUpper(callsign)]
+}
+
+// Users returns the callsigns served by this handler, starting with the primary callsign.
+func (h *MultiUserHandler) Users() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	calls := []string{h.primary}
+	for call := range h.users {
+		if call != h.primary {
+			calls = append(calls, call)
+		}
+	}
+	sort.Strings(calls[1:])
+	return calls
+}
+
+// AuxAddresses returns the addresses of the auxiliary callsigns served by this handler.
+func (h *MultiUserHandler) AuxAddresses() []fbb.Address {
+	calls := h.Users()[1:]
+	addrs := make([]fbb.Address, len(calls))
+	for i, call := range calls {
+		addrs[i] = fbb.Address{Addr: call}
+	}
+	return addrs
+}
+
+func (h *MultiUserHandler) Prepare() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.owner = make(map[string]string)
+	h.prepared = true
+	for call, u := range h.users {
+		if err := u.Prepare(); err != nil {
+			return fmt.Errorf("Unable to prepare mailbox of %s: %w", call, err)
+		}
+	}
+	return nil
+}
+
+// recipients returns the sub-mailboxes the given inbound message should be delivered to.
+func (h *MultiUserHandler) recipients(msg *fbb.Message) []*DirHandler {
+	var users []*DirHandler
+	seen := make(map[string]bool)
+	for _, addr := range msg.Receivers() {
+		call := strings.ToUpper(addr.Addr)
+		if addr.Proto != "" || seen[call] {
+			continue
+		}
+		if u, ok := h.users[call]; ok {
+			seen[call] = true
+			users = append(users, u)
+		}
+	}
+	if len(users) == 0 {
+		users = append(users, h.users[h.primary])
+	}
+	return users
+}
+
+// ProcessInbound delivers each message to the sub-mailbox of every local recipient.
+func (h *MultiUserHandler) ProcessInbound(msgs ...*fbb.Message) error {
+	h.mu.Lock()
+	routes := make(map[*DirHandler][]*fbb.Message)
+	var order []*DirHandler
+	for _, m := range msgs {
+		for _, u := range h.recipients(m) {
+			if _, ok := routes[u]; !ok {
+				order = append(order, u)
+			}
+			routes[u] = append(routes[u], m)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, u := range order {
+		if err := u.ProcessInbound(routes[u]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetInboundAnswer rejects messages already received by any of the sub-mailboxes.
+//
+// A message addressed to several local callsigns is delivered to all of them
+// at once, so it's sufficient that one of them has received it.
+func (h *MultiUserHandler) GetInboundAnswer(p fbb.Proposal) fbb.ProposalAnswer {
+	if h.sendOnly {
+		return fbb.Defer
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, u := range h.users {
+		if answer := u.GetInboundAnswer(p); answer != fbb.Accept {
+			return answer
+		}
+	}
+	return fbb.Accept
+}
+
+// GetOutbound returns the outbound messages of all sub-mailboxes.
+//
+// See DirHandler.GetOutbound.
+func (h *MultiUserHandler) GetOutbound(fws ...fbb.Address) []*fbb.Message {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var out []*fbb.Message
+	for _, call := range h.sortedUsers() {
+		for _, m := range h.users[call].GetOutbound(fws...) {
+			if owner, ok := h.owner[m.MID()]; ok && owner != call {
+				log.Printf("Duplicate outbound message %s in mailboxes of %s and %s", m.MID(), owner, call)
+				continue
+			}
+			h.owner[m.MID()] = call
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// SetSent moves the message identified by MID to the sent folder of the sub-mailbox it was sent from.
+//
+// Errors are logged. See SetSentErr.
+func (h *MultiUserHandler) SetSent(MID string, rejected bool) {
+	if err := h.SetSentErr(MID, rejected); err != nil {
+		log.Println(err)
+	}
+}
+
+// SetSentErr is like SetSent, but returns any error.
+//
+// It implements fbb.OutboundErrHandler.
+func (h *MultiUserHandler) SetSentErr(MID string, rejected bool) error {
+	u, err := h.ownerOf(MID)
+	if err != nil {
+		return err
+	}
+	return u.SetSentErr(MID, rejected)
+}
+
+func (h *MultiUserHandler) SetDeferred(MID string) {
+	if err := h.SetDeferredErr(MID); err != nil {
+		log.Println(err)
+	}
+}
+
+// SetDeferredErr is like SetDeferred, but returns any error.
+//
+// It implements fbb.OutboundErrHandler.
+func (h *MultiUserHandler) SetDeferredErr(MID string) error {
+	u, err := h.ownerOf(MID)
+	if err != nil {
+		return err
+	}
+	return u.SetDeferredErr(MID)
+}
+
+// ownerOf returns the sub-mailbox the outbound message identified by MID was collected from.
+func (h *MultiUserHandler) ownerOf(MID string) (*DirHandler, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	call, ok := h.owner[MID]
+	if !ok {
+		return nil, fmt.Errorf("Unknown outbound message %s", MID)
+	}
+	return h.users[call], nil
+}
+
+// sortedUsers returns the callsigns in a stable order. The caller must hold h.mu.
+func (h *MultiUserHandler) sortedUsers() []string {
+	calls := make([]string, 0, len(h.users))
+	for call := range h.users {
+		calls = append(calls, call)
+	}
+	sort.Strings(calls)
+	return calls
+}
@@ -0,0 +1,119 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"testing"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+func TestMultiUserRouting(t *testing.T) {
+	h := NewMultiUserHandler(t.TempDir(), false, "LA5NTA", "emcomm-1", "EMCOMM-2")
+	if err := h.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	if aux := h.AuxAddresses(); len(aux) != 2 || aux[0].String() != "EMCOMM-1" || aux[1].String() != "EMCOMM-2" {
+		t.Errorf("Unexpected aux addresses: %v", aux)
+	}
+
+	toAux := newTestMessage("N0CALL", "EMCOMM-1@winlink.org")
+	toBoth := newTestMessage("N0CALL", "EMCOMM-2")
+	toBoth.AddCc("LA5NTA")
+	toOther := newTestMessage("N0CALL", "foo@example.com")
+
+	if err := h.ProcessInbound(toAux, toBoth, toOther); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]int{"LA5NTA": 2, "EMCOMM-1": 1, "EMCOMM-2": 1}
+	for call, n := range expect {
+		if got := h.User(call).InboxCount(); got != n {
+			t.Errorf("Expected %d messages in inbox of %s, got %d", n, call, got)
+		}
+	}
+
+	p, err := toAux.Proposal(fbb.BasicProposal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer := h.GetInboundAnswer(*p); answer != fbb.Reject {
+		t.Errorf("Expected already received message to be rejected, got %c", answer)
+	}
+}
+
+func TestMultiUserOutbound(t *testing.T) {
+	h := NewMultiUserHandler(t.TempDir(), false, "LA5NTA", "EMCOMM-1")
+	if err := h.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	fromPrimary := newTestMessage("LA5NTA", "N0CALL")
+	fromAux := newTestMessage("EMCOMM-1", "N0CALL")
+	p2p := newTestMessage("EMCOMM-1", "LA1B")
+	if err := h.User("LA5NTA").AddOut(fromPrimary); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []*fbb.Message{fromAux, p2p} {
+		if err := h.User("EMCOMM-1").AddOut(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if out := h.GetOutbound(fbb.AddressFromString("LA1B")); len(out) != 1 || out[0].MID() != p2p.MID() {
+		t.Errorf("Expected only the message to the forwarder, got %v", out)
+	}
+
+	if err := h.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	// The P2P message was offered (and not answered) in the previous session, and is offered again.
+	out := h.GetOutbound()
+	if len(out) != 3 {
+		t.Fatalf("Expected 3 outbound messages, got %d", len(out))
+	}
+
+	if err := h.SetSentErr(fromAux.MID(), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetDeferredErr(fromPrimary.MID()); err != nil {
+		t.Fatal(err)
+	}
+	if n := h.User("EMCOMM-1").SentCount(); n != 1 {
+		t.Errorf("Expected 1 sent message for EMCOMM-1, got %d", n)
+	}
+	if n := h.User("LA5NTA").SentCount(); n != 0 {
+		t.Errorf("Expected no sent messages for LA5NTA, got %d", n)
+	}
+	if err := h.SetSentErr("UNKNOWN", false); err == nil {
+		t.Errorf("Expected error for unknown MID")
+	}
+}
+
+func TestMultiUserAddUserAfterPrepare(t *testing.T) {
+	h := NewMultiUserHandler(t.TempDir(), false, "LA5NTA")
+	if err := h.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := h.AddUser("EMCOMM-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := newTestMessage("EMCOMM-1", "N0CALL")
+	if err := u.AddOut(msg); err != nil {
+		t.Fatal(err)
+	}
+	if out := h.GetOutbound(); len(out) != 1 {
+		t.Fatalf("Expected 1 outbound message, got %d", len(out))
+	}
+	if err := h.SetDeferredErr(msg.MID()); err != nil {
+		t.Fatal(err)
+	}
+	if out := h.GetOutbound(); len(out) != 0 {
+		t.Errorf("Deferred message offered again in the same session")
+	}
+}
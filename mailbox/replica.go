@@ -0,0 +1,685 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	replicaDirName     = ".replica"
+	replicaIDFile      = "id"
+	replicaLogFile     = "changes.jsonl"
+	replicaCursorsFile = "cursors.json"
+)
+
+// ChangeKind is the kind of a replicated Change.
+type ChangeKind int
+
+const (
+	ChangeLocation ChangeKind = iota // The folders containing the message changed (new, moved, sent or deleted).
+	ChangeFlags                      // The flags of the message changed.
+)
+
+// Change is an entry in the change log of a Replica.
+//
+// A change holds the resulting state of the message, not the operation,
+// so that applying it is idempotent.
+type Change struct {
+	Seq uint64 // Position in the change log of the replica it was read from.
+
+	MID     string
+	Kind    ChangeKind
+	Folders []string `json:",omitempty"` // For ChangeLocation. Empty if the message was deleted.
+	Flags   Flags    `json:",omitempty"` // For ChangeFlags.
+
+	// The time the change was detected, and the ID of the replica where it originated.
+	Time    time.Time
+	Replica string
+}
+
+// supersedes reports whether c should replace the state given by prev (of the same MID and kind).
+//
+// Changes are ordered by time, with ties broken by replica ID. Outbound messages
+// are special: a message that has left the outbox (sent, failed or moved by the
+// user) is never put back in the outbox, and leaving the outbox always wins.
+// This guarantees that a message sent from one replica is never proposed again
+// by another, regardless of clock skew.
+func (c Change) supersedes(prev Change) bool {
+	if c.Kind == ChangeLocation {
+		switch cur, old := inFolder(c.Folders, DIR_OUTBOX), inFolder(prev.Folders, DIR_OUTBOX); {
+		case cur && !old:
+			return false
+		case !cur && old:
+			return true
+		}
+	}
+	if !c.Time.Equal(prev.Time) {
+		return c.Time.After(prev.Time)
+	}
+	return c.Replica > prev.Replica
+}
+
+// validate returns an error if the MID or any of the folders of c is invalid.
+//
+// Changes are received from remote peers, and must never refer to paths outside the mailbox.
+func (c Change) validate() error {
+	if err := validMID(c.MID); err != nil {
+		return err
+	}
+	switch c.Kind {
+	case ChangeLocation:
+		for _, folder := range c.Folders {
+			if f, err := validFolder(folder); err != nil {
+				return err
+			} else if f != folder {
+				return fmt.Errorf("%w: %q", ErrInvalidFolder, folder)
+			}
+		}
+	case ChangeFlags:
+	default:
+		return fmt.Errorf("Unknown change kind %d", c.Kind)
+	}
+	return nil
+}
+
+func inFolder(folders []string, folder string) bool {
+	for _, f := range folders {
+		if f == folder {
+			return true
+		}
+	}
+	return false
+}
+
+// replicaState is the last known state of a message.
+type replicaState struct {
+	location, flags *Change
+}
+
+// Replica tracks the changes of a DirHandler mailbox for two-way replication with other mailboxes.
+//
+// Changes are detected by comparing the mailbox with the change log, so that
+// changes made by any process are replicated. The change log is stored in a
+// hidden directory in the mailbox root. See Sync.
+type Replica struct {
+	h  *DirHandler
+	id string
+
+	mu        sync.Mutex
+	seq       uint64
+	logOffset int64 // Size of the change log read into state.
+	state     map[string]*replicaState
+}
+
+// errNotProvided is returned by applyLocation if the message is not present in either mailbox.
+var errNotProvided = errors.New("message not provided")
+
+// OpenReplica opens the replication state of the given mailbox, creating it if needed.
+func OpenReplica(h *DirHandler) (*Replica, error) {
+	dir := filepath.Join(h.MBoxPath, replicaDirName)
+	if err := os.MkdirAll(dir, os.ModeDir|os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	r := &Replica{h: h, state: make(map[string]*replicaState)}
+	id, err := ioutil.ReadFile(filepath.Join(dir, replicaIDFile))
+	switch {
+	case os.IsNotExist(err):
+		buf := make([]byte, 8)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		id = []byte(hex.EncodeToString(buf))
+		if err := writeFileAtomic(filepath.Join(dir, replicaIDFile), id, 0644); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	}
+	r.id = strings.TrimSpace(string(id))
+
+	if err := r.catchUp(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ID returns the unique ID of this replica.
+func (r *Replica) ID() (string, error) { return r.id, nil }
+
+func (r *Replica) path(name string) string {
+	return filepath.Join(r.h.MBoxPath, replicaDirName, name)
+}
+
+func (r *Replica) update(c Change) {
+	if c.Seq > r.seq {
+		r.seq = c.Seq
+	}
+	s, ok := r.state[c.MID]
+	if !ok {
+		s = new(replicaState)
+		r.state[c.MID] = s
+	}
+	c2 := c
+	switch c.Kind {
+	case ChangeLocation:
+		s.location = &c2
+	case ChangeFlags:
+		s.flags = &c2
+	}
+}
+
+func (r *Replica) readLog(since uint64) ([]Change, error) {
+	f, err := os.Open(r.path(replicaLogFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var changes []Change
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		var c Change
+		if err := json.Unmarshal(s.Bytes(), &c); err != nil {
+			continue // Ignore a partially written line
+		}
+		if c.Seq > since {
+			changes = append(changes, c)
+		}
+	}
+	return changes, s.Err()
+}
+
+// catchUp reads the changes appended to the change log since it was last read,
+// e.g. by another process sharing the mailbox.
+//
+// The caller must hold r.mu, and the mailbox lock unless r is being opened.
+func (r *Replica) catchUp() error {
+	f, err := os.Open(r.path(replicaLogFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(r.logOffset, io.SeekStart); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return nil // Ignore a partially written line
+		} else if err != nil {
+			return err
+		}
+		r.logOffset += int64(len(line))
+		var c Change
+		if err := json.Unmarshal(line, &c); err == nil {
+			r.update(c)
+		}
+	}
+}
+
+// appendLog assigns sequence numbers to the given changes, and appends them to the change log. The caller must hold r.mu.
+//
+// The sequence numbers are assigned under the mailbox lock, after the changes
+// logged by other processes sharing the mailbox.
+func (r *Replica) appendLog(changes []Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	unlock, err := lockMailbox(r.h.MBoxPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := r.catchUp(); err != nil {
+		return fmt.Errorf("Unable to read change log: %w", err)
+	}
+
+	f, err := os.OpenFile(r.path(replicaLogFile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for i := range changes {
+		changes[i].Seq = r.seq + uint64(i) + 1
+		data, err := json.Marshal(changes[i])
+		if err != nil {
+			f.Close()
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		r.update(c)
+	}
+	r.logOffset += int64(buf.Len())
+	return nil
+}
+
+// Record detects the changes made to the mailbox since the last call, and adds them to the change log.
+func (r *Replica) Record() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.record()
+}
+
+func (r *Replica) record() error {
+	folders, err := listFolders(r.h.MBoxPath)
+	if err != nil {
+		return err
+	}
+	locations := make(map[string][]string)
+	for _, folder := range folders {
+		MIDs, err := r.h.folderMIDs(folder)
+		if err != nil {
+			return err
+		}
+		for _, MID := range MIDs {
+			locations[MID] = append(locations[MID], folder)
+		}
+	}
+	store, err := readFlags(r.h.MBoxPath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var changes []Change
+	for _, MID := range sortedKeys(locations) {
+		cur := locations[MID]
+		sort.Strings(cur)
+		s := r.state[MID]
+		if s == nil || s.location == nil || !equalStrings(s.location.Folders, cur) {
+			changes = append(changes, Change{MID: MID, Kind: ChangeLocation, Folders: cur, Time: now, Replica: r.id})
+		}
+
+		var flags Flags
+		if rec, ok := store[MID]; ok {
+			flags = rec.Flags
+		} else if s != nil && s.flags != nil {
+			continue // Derived from the (unchanged) message header
+		} else if msg, err := OpenMessage(r.h.messagePath(cur[0], MID)); err == nil {
+			flags = store.flags(msg)
+		} else {
+			continue
+		}
+		if s == nil || s.flags == nil || s.flags.Flags != flags {
+			changes = append(changes, Change{MID: MID, Kind: ChangeFlags, Flags: flags, Time: now, Replica: r.id})
+		}
+	}
+
+	// Deleted messages
+	for MID, s := range r.state {
+		if _, ok := locations[MID]; !ok && s.location != nil && len(s.location.Folders) > 0 {
+			changes = append(changes, Change{MID: MID, Kind: ChangeLocation, Time: now, Replica: r.id})
+		}
+	}
+	return r.appendLog(changes)
+}
+
+// Changes records any new changes, and returns the change log entries after since.
+func (r *Replica) Changes(since uint64) ([]Change, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record(); err != nil {
+		return nil, err
+	}
+	return r.readLog(since)
+}
+
+// Message returns the raw message identified by MID, from any folder.
+func (r *Replica) Message(MID string) ([]byte, error) {
+	folders, err := r.h.Locate(MID)
+	if err != nil {
+		return nil, err
+	}
+	if len(folders) == 0 {
+		return nil, fmt.Errorf("%s: %w", MID, ErrNotFound)
+	}
+	return ioutil.ReadFile(r.h.messagePath(folders[0], MID))
+}
+
+// Missing returns the MIDs not found in any folder of this replica.
+func (r *Replica) Missing(MIDs []string) ([]string, error) {
+	var missing []string
+	for _, MID := range MIDs {
+		folders, err := r.h.Locate(MID)
+		if err != nil {
+			return nil, err
+		}
+		if len(folders) == 0 {
+			missing = append(missing, MID)
+		}
+	}
+	return missing, nil
+}
+
+// Cursor returns the sequence number of the last change received from the given replica.
+func (r *Replica) Cursor(peerID string) (uint64, error) {
+	cursors, err := r.readCursors()
+	return cursors[peerID], err
+}
+
+func (r *Replica) readCursors() (map[string]uint64, error) {
+	cursors := make(map[string]uint64)
+	data, err := ioutil.ReadFile(r.path(replicaCursorsFile))
+	if os.IsNotExist(err) {
+		return cursors, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return cursors, json.Unmarshal(data, &cursors)
+}
+
+// Apply merges the changes received from the given replica into the mailbox.
+//
+// messages holds the raw messages (keyed by MID) not already present in this
+// mailbox. Changes originating from this replica, and changes superseded by
+// the local state, are ignored. The cursor of the peer is advanced to the
+// last change.
+//
+// A location change is skipped if the message is neither present in this
+// mailbox nor provided in messages, as it was removed from the peer before
+// it could be fetched. The removal is then received as a later change.
+//
+// The whole batch is rejected if any change refers to an invalid MID or folder.
+func (r *Replica) Apply(peerID string, changes []Change, messages map[string][]byte) error {
+	for _, c := range changes {
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("Invalid change from %s: %w", peerID, err)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Local changes must be in the log before they're compared with the remote ones.
+	if err := r.record(); err != nil {
+		return err
+	}
+
+	var cursor uint64
+	for _, c := range changes {
+		if c.Seq > cursor {
+			cursor = c.Seq
+		}
+		if c.Replica == r.id {
+			continue
+		}
+
+		var prev *Change
+		if s := r.state[c.MID]; s != nil && c.Kind == ChangeLocation {
+			prev = s.location
+		} else if s != nil {
+			prev = s.flags
+		}
+		if prev != nil && !c.supersedes(*prev) {
+			continue
+		}
+
+		var err error
+		switch c.Kind {
+		case ChangeLocation:
+			err = r.applyLocation(c, messages[c.MID])
+		case ChangeFlags:
+			err = r.applyFlags(c)
+		}
+		if err == errNotProvided {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("Unable to apply change of %s: %w", c.MID, err)
+		}
+
+		// Keep the origin and time, so that the change is resolved the same way everywhere.
+		if err := r.appendLog([]Change{c}); err != nil {
+			return err
+		}
+	}
+
+	cursors, err := r.readCursors()
+	if err != nil {
+		return err
+	}
+	if cursor > cursors[peerID] {
+		cursors[peerID] = cursor
+	}
+	data, err := json.Marshal(cursors)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(r.path(replicaCursorsFile), data, 0644)
+}
+
+func (r *Replica) applyLocation(c Change, data []byte) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	cur, err := r.h.Locate(c.MID)
+	if err != nil {
+		return err
+	}
+	if len(cur) > 0 {
+		data, err = ioutil.ReadFile(r.h.messagePath(cur[0], c.MID))
+		if err != nil {
+			return err
+		}
+	} else if len(c.Folders) > 0 && data == nil {
+		return errNotProvided
+	}
+
+	var changed []string
+	err = r.h.locked(func() error {
+		for _, folder := range c.Folders {
+			if inFolder(cur, folder) {
+				continue
+			}
+			if err := os.MkdirAll(r.h.folderPath(folder), os.ModeDir|os.ModePerm); err != nil {
+				return err
+			}
+			if err := writeFileAtomic(r.h.messagePath(folder, c.MID), data, 0644); err != nil {
+				return err
+			}
+			changed = append(changed, r.h.messageRel(folder, c.MID))
+		}
+		for _, folder := range cur {
+			if inFolder(c.Folders, folder) {
+				continue
+			}
+			if err := os.Remove(r.h.messagePath(folder, c.MID)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			changed = append(changed, r.h.messageRel(folder, c.MID))
+		}
+		if len(c.Folders) == 0 {
+			return r.h.dropFlags(c.MID)
+		}
+		return nil
+	})
+	r.h.reindex(changed...)
+	r.h.notifyWatchers(changed...)
+	return err
+}
+
+func (r *Replica) applyFlags(c Change) error {
+	if folders, err := r.h.Locate(c.MID); err != nil || len(folders) == 0 {
+		return err // The message is gone, nothing to flag.
+	}
+	return r.h.SetFlags(c.MID, c.Flags, ^c.Flags)
+}
+
+// ReplicaPeer is a replica taking part in Sync, e.g. a local *Replica or a *RemoteReplica.
+type ReplicaPeer interface {
+	ID() (string, error)
+	Changes(since uint64) ([]Change, error)
+	Message(MID string) ([]byte, error)
+	Missing(MIDs []string) ([]string, error)
+	Cursor(peerID string) (uint64, error)
+	Apply(peerID string, changes []Change, messages map[string][]byte) error
+}
+
+// SyncStats summarizes a Sync.
+type SyncStats struct {
+	Pulled, Pushed int // Number of new changes received from and sent to the peer.
+}
+
+// Sync performs a two-way replication between the local replica and peer.
+//
+// New messages, sent/deferred/failed state (the folder of the message) and
+// flags are replicated in both directions. Conflicting changes are resolved
+// deterministically (see Change), so both mailboxes end up in the same state.
+func Sync(local *Replica, peer ReplicaPeer) (SyncStats, error) {
+	var stats SyncStats
+	peerID, err := peer.ID()
+	if err != nil {
+		return stats, err
+	}
+	if peerID == local.id {
+		return stats, fmt.Errorf("Unable to sync replica with itself")
+	}
+
+	// Pull
+	cursor, err := local.Cursor(peerID)
+	if err != nil {
+		return stats, err
+	}
+	changes, err := peer.Changes(cursor)
+	if err != nil {
+		return stats, err
+	}
+	missing, err := local.Missing(newMIDs(changes))
+	if err != nil {
+		return stats, err
+	}
+	messages, err := fetchMessages(peer, missing)
+	if err != nil {
+		return stats, err
+	}
+	if err := local.Apply(peerID, changes, messages); err != nil {
+		return stats, err
+	}
+	stats.Pulled = countForeign(changes, local.id)
+
+	// Push
+	if cursor, err = peer.Cursor(local.id); err != nil {
+		return stats, err
+	}
+	if changes, err = local.Changes(cursor); err != nil {
+		return stats, err
+	}
+	if missing, err = peer.Missing(newMIDs(changes)); err != nil {
+		return stats, err
+	}
+	if messages, err = fetchMessages(local, missing); err != nil {
+		return stats, err
+	}
+	if err := peer.Apply(local.id, changes, messages); err != nil {
+		return stats, err
+	}
+	stats.Pushed = countForeign(changes, peerID)
+	return stats, nil
+}
+
+// countForeign returns the number of changes not originating from the given replica.
+func countForeign(changes []Change, replicaID string) (n int) {
+	for _, c := range changes {
+		if c.Replica != replicaID {
+			n++
+		}
+	}
+	return n
+}
+
+// newMIDs returns the MIDs of the location changes placing a message in a folder.
+func newMIDs(changes []Change) []string {
+	seen := make(map[string]bool)
+	var MIDs []string
+	for _, c := range changes {
+		if c.Kind == ChangeLocation && len(c.Folders) > 0 && !seen[c.MID] {
+			seen[c.MID] = true
+			MIDs = append(MIDs, c.MID)
+		}
+	}
+	return MIDs
+}
+
+// fetchMessages returns the given messages of a peer.
+//
+// Messages deleted from the peer after the change was logged are left out (a
+// later change will tell). Any other error is returned.
+func fetchMessages(from ReplicaPeer, MIDs []string) (map[string][]byte, error) {
+	messages := make(map[string][]byte, len(MIDs))
+	var failed []string
+	errs := make(map[string]error)
+	for _, MID := range MIDs {
+		data, err := from.Message(MID)
+		if err != nil {
+			failed = append(failed, MID)
+			errs[MID] = err
+			continue
+		}
+		messages[MID] = data
+	}
+	if len(failed) == 0 {
+		return messages, nil
+	}
+
+	gone, err := from.Missing(failed)
+	if err != nil {
+		return nil, err
+	}
+	if len(gone) < len(failed) {
+		for _, MID := range failed {
+			if !inFolder(gone, MID) {
+				return nil, fmt.Errorf("Unable to fetch %s: %w", MID, errs[MID])
+			}
+		}
+	}
+	return messages, nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
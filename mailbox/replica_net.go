@@ -0,0 +1,135 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"net"
+	"net/rpc"
+)
+
+const replicaServiceName = "Replica"
+
+// ReplicaApplyArgs is the wire format of a ReplicaPeer.Apply call.
+type ReplicaApplyArgs struct {
+	PeerID   string
+	Changes  []Change
+	Messages map[string][]byte
+}
+
+// ReplicaService exposes a Replica over net/rpc. See ServeReplica.
+type ReplicaService struct{ r *Replica }
+
+func (s *ReplicaService) ID(_ struct{}, reply *string) (err error) {
+	*reply, err = s.r.ID()
+	return err
+}
+
+func (s *ReplicaService) Changes(since uint64, reply *[]Change) (err error) {
+	*reply, err = s.r.Changes(since)
+	return err
+}
+
+func (s *ReplicaService) Message(MID string, reply *[]byte) (err error) {
+	if err := validMID(MID); err != nil {
+		return err
+	}
+	*reply, err = s.r.Message(MID)
+	return err
+}
+
+func (s *ReplicaService) Missing(MIDs []string, reply *[]string) (err error) {
+	for _, MID := range MIDs {
+		if err := validMID(MID); err != nil {
+			return err
+		}
+	}
+	*reply, err = s.r.Missing(MIDs)
+	return err
+}
+
+func (s *ReplicaService) Cursor(peerID string, reply *uint64) (err error) {
+	*reply, err = s.r.Cursor(peerID)
+	return err
+}
+
+func (s *ReplicaService) Apply(args ReplicaApplyArgs, _ *struct{}) error {
+	for _, c := range args.Changes {
+		if err := c.validate(); err != nil {
+			return err
+		}
+	}
+	return s.r.Apply(args.PeerID, args.Changes, args.Messages)
+}
+
+// ServeReplica accepts connections on l and serves r to remote peers (see DialReplica).
+//
+// ServeReplica blocks until l is closed. The connection is not authenticated,
+// so l should only be reachable from trusted (e.g. local) networks.
+func ServeReplica(l net.Listener, r *Replica) error {
+	srv := rpc.NewServer()
+	if err := srv.RegisterName(replicaServiceName, &ReplicaService{r}); err != nil {
+		return err
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go srv.ServeConn(conn)
+	}
+}
+
+// RemoteReplica is a ReplicaPeer served by ServeReplica on another station.
+type RemoteReplica struct{ c *rpc.Client }
+
+// DialReplica connects to a replica served by ServeReplica at the given TCP address.
+func DialReplica(addr string) (*RemoteReplica, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return NewRemoteReplica(conn), nil
+}
+
+// NewRemoteReplica returns a RemoteReplica communicating over conn.
+func NewRemoteReplica(conn net.Conn) *RemoteReplica {
+	return &RemoteReplica{rpc.NewClient(conn)}
+}
+
+// Close closes the connection.
+func (r *RemoteReplica) Close() error { return r.c.Close() }
+
+func (r *RemoteReplica) ID() (id string, err error) {
+	err = r.call("ID", struct{}{}, &id)
+	return id, err
+}
+
+func (r *RemoteReplica) Changes(since uint64) (changes []Change, err error) {
+	err = r.call("Changes", since, &changes)
+	return changes, err
+}
+
+func (r *RemoteReplica) Message(MID string) (data []byte, err error) {
+	err = r.call("Message", MID, &data)
+	return data, err
+}
+
+func (r *RemoteReplica) Missing(MIDs []string) (missing []string, err error) {
+	err = r.call("Missing", MIDs, &missing)
+	return missing, err
+}
+
+func (r *RemoteReplica) Cursor(peerID string) (seq uint64, err error) {
+	err = r.call("Cursor", peerID, &seq)
+	return seq, err
+}
+
+func (r *RemoteReplica) Apply(peerID string, changes []Change, messages map[string][]byte) error {
+	return r.call("Apply", ReplicaApplyArgs{peerID, changes, messages}, &struct{}{})
+}
+
+func (r *RemoteReplica) call(method string, args, reply interface{}) error {
+	return r.c.Call(replicaServiceName+"."+method, args, reply)
+}
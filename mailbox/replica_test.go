@@ -0,0 +1,239 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestReplica(t *testing.T) (*DirHandler, *Replica) {
+	h := newTestDirHandler(t)
+	r, err := OpenReplica(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, r
+}
+
+func assertFolders(t *testing.T, h *DirHandler, MID string, expect ...string) {
+	t.Helper()
+	folders, err := h.Locate(MID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(folders, expect) {
+		t.Errorf("%s: expected in %v, got %v", MID, expect, folders)
+	}
+}
+
+func TestReplicaSync(t *testing.T) {
+	base, baseReplica := newTestReplica(t)
+	laptop, laptopReplica := newTestReplica(t)
+
+	// Serve the base station over TCP
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go ServeReplica(l, baseReplica)
+	remote, err := DialReplica(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+
+	sync := func() {
+		t.Helper()
+		if _, err := Sync(laptopReplica, remote); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// New inbound on the base, new outbound on the laptop
+	in := newTestMessage("N0CALL", "LA5NTA")
+	if err := base.ProcessInbound(in); err != nil {
+		t.Fatal(err)
+	}
+	out := newTestMessage("LA5NTA", "N0CALL")
+	if err := laptop.AddOut(out); err != nil {
+		t.Fatal(err)
+	}
+	sync()
+	assertFolders(t, laptop, in.MID(), DIR_INBOX)
+	assertFolders(t, base, out.MID(), DIR_OUTBOX)
+
+	// Read on the laptop, sent from the base
+	if err := laptop.MarkRead(in.MID(), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.SetSentErr(out.MID(), false); err != nil {
+		t.Fatal(err)
+	}
+	sync()
+	assertFolders(t, laptop, out.MID(), DIR_SENT)
+	if flags, _ := base.Flags(in.MID()); !flags.Has(FlagRead) {
+		t.Errorf("Read flag not replicated")
+	}
+	if msgs := laptop.GetOutbound(); len(msgs) != 0 {
+		t.Errorf("Sent message proposed from the other station")
+	}
+
+	// Nothing more to do
+	stats, err := Sync(laptopReplica, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pulled != 0 || stats.Pushed != 0 {
+		t.Errorf("Expected no changes, got %+v", stats)
+	}
+}
+
+func TestReplicaSentWins(t *testing.T) {
+	a, ra := newTestReplica(t)
+	b, rb := newTestReplica(t)
+
+	msg := newTestMessage("LA5NTA", "N0CALL")
+	if err := a.AddOut(msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Sync(ra, rb); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sent from a, while b touches its (still outbound) copy afterwards
+	if err := a.SetSentErr(msg.MID(), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Move(msg.MID(), DIR_OUTBOX, DIR_ARCHIVE); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Move(msg.MID(), DIR_ARCHIVE, DIR_OUTBOX); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Sync(rb, ra); err != nil {
+		t.Fatal(err)
+	}
+	assertFolders(t, a, msg.MID(), DIR_SENT)
+	assertFolders(t, b, msg.MID(), DIR_SENT)
+}
+
+func TestReplicaHostileChanges(t *testing.T) {
+	base, baseReplica := newTestReplica(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go ServeReplica(l, baseReplica)
+	remote, err := DialReplica(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+
+	good := newTestMessage("N0CALL", "LA5NTA")
+	data, _ := good.Bytes()
+	outside := filepath.Join(filepath.Dir(base.MBoxPath), "x")
+	now := time.Now()
+
+	for _, c := range []Change{
+		{MID: good.MID(), Kind: ChangeLocation, Folders: []string{"../../x"}},
+		{MID: good.MID(), Kind: ChangeLocation, Folders: []string{"/inbox/../../x/"}},
+		{MID: "../../foo", Kind: ChangeLocation, Folders: []string{DIR_INBOX}},
+		{MID: "../x/foo", Kind: ChangeFlags, Flags: FlagRead},
+	} {
+		c.Time, c.Replica = now, "evil"
+		batch := []Change{{MID: good.MID(), Kind: ChangeLocation, Folders: []string{DIR_INBOX}, Time: now, Replica: "evil"}, c}
+		messages := map[string][]byte{good.MID(): data, c.MID: data}
+		if err := remote.Apply("evil", batch, messages); err == nil {
+			t.Errorf("Expected %+v to be rejected", c)
+		}
+		if err := baseReplica.Apply("evil", batch, messages); err == nil {
+			t.Errorf("Expected %+v to be rejected locally", c)
+		}
+	}
+	if _, err := remote.Message("../replica/id"); err == nil {
+		t.Errorf("Expected invalid MID to be rejected")
+	}
+
+	// The batch is rejected as a whole
+	assertFolders(t, base, good.MID())
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("Path outside the mailbox was created")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(filepath.Dir(base.MBoxPath)), "foo"+Ext)); !os.IsNotExist(err) {
+		t.Errorf("Message written outside the mailbox")
+	}
+}
+
+func TestReplicaDeletedBeforeSync(t *testing.T) {
+	base, baseReplica := newTestReplica(t)
+	laptop, laptopReplica := newTestReplica(t)
+
+	// Logged on the base, then deleted before the first sync
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := base.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := baseReplica.Record(); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Delete(msg.MID(), DIR_INBOX); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := Sync(laptopReplica, baseReplica); err != nil {
+			t.Fatalf("Sync %d: %s", i, err)
+		}
+	}
+	assertFolders(t, laptop, msg.MID())
+
+	// Replication continues with later changes
+	next := newTestMessage("N0CALL", "LA5NTA")
+	if err := base.ProcessInbound(next); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Sync(laptopReplica, baseReplica); err != nil {
+		t.Fatal(err)
+	}
+	assertFolders(t, laptop, next.MID(), DIR_INBOX)
+}
+
+func TestReplicaSharedLog(t *testing.T) {
+	h, r1 := newTestReplica(t)
+	r2, err := OpenReplica(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two replicas (e.g. processes) of the same mailbox recording in turn
+	for i, r := range []*Replica{r1, r2, r1, r2} {
+		if err := h.ProcessInbound(newTestMessage("N0CALL", "LA5NTA")); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Record(); err != nil {
+			t.Fatalf("Record %d: %s", i, err)
+		}
+	}
+
+	changes, err := r1.readLog(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range changes {
+		if c.Seq != uint64(i+1) {
+			t.Fatalf("Expected sequence number %d, got %d", i+1, c.Seq)
+		}
+	}
+	if len(changes) < 4 {
+		t.Errorf("Expected at least 4 changes, got %d", len(changes))
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// RetentionRule limits the content of a mailbox folder. Zero value limits are ignored.
+type RetentionRule struct {
+	Folder string // The folder, e.g. DIR_SENT.
+
+	MaxAge   time.Duration // Messages older than this (by date) are removed.
+	MaxCount int           // Only the most recent messages are kept.
+	MaxSize  int64         // The most recent messages are kept up to this total size (in bytes).
+
+	// Messages with one of these precedences are never removed, and do not
+	// count towards MaxCount and MaxSize.
+	Exempt []fbb.Precedence
+
+	// KeepFlagged prevents flagged messages (see FlagFlagged) from being removed.
+	// Like exempt messages, they do not count towards MaxCount and MaxSize.
+	KeepFlagged bool
+}
+
+// RetentionPolicy is a set of retention rules applied by DirHandler.ApplyRetention.
+type RetentionPolicy struct {
+	Rules []RetentionRule
+
+	// If BundleDir is set, removed messages are saved to a dated, compressed
+	// (tar.gz) bundle per folder in this directory before they are removed.
+	BundleDir string
+}
+
+// RetentionReport lists the messages removed (or to be removed in a dry run) by a retention policy.
+type RetentionReport struct {
+	DryRun  bool
+	Removed []RetentionEntry
+	Bundles []string // Bundle files written.
+}
+
+// RetentionEntry is a message removed by a retention policy.
+type RetentionEntry struct {
+	Folder string
+	MID    string
+	Date   time.Time
+	Size   int64
+	Reason string
+
+	file string // Path of the message file, which is not necessarily named by the MID.
+}
+
+// Size returns the total size of the removed messages.
+func (r RetentionReport) Size() (n int64) {
+	for _, e := range r.Removed {
+		n += e.Size
+	}
+	return n
+}
+
+func (r RetentionReport) String() string {
+	var b strings.Builder
+	verb := "Removed"
+	if r.DryRun {
+		verb = "Would remove"
+	}
+	fmt.Fprintf(&b, "%s %d message(s), %d bytes\n", verb, len(r.Removed), r.Size())
+	for _, e := range r.Removed {
+		fmt.Fprintf(&b, "%s%s\t%s\t%d\t%s\n", e.Folder, e.MID, e.Date.Format(time.RFC3339), e.Size, e.Reason)
+	}
+	for _, f := range r.Bundles {
+		fmt.Fprintf(&b, "Bundle: %s\n", f)
+	}
+	return b.String()
+}
+
+// retentionCandidate is a message evaluated by a retention rule.
+type retentionCandidate struct {
+	RetentionEntry
+	precedence fbb.Precedence
+	flagged    bool
+}
+
+// ApplyRetention removes the messages exceeding the limits of the given policy.
+//
+// If dryRun is true, nothing is removed. The returned report lists what
+// was (or would be) removed. Messages that can't be removed are logged and
+// left in place.
+func (h *DirHandler) ApplyRetention(p RetentionPolicy, dryRun bool) (RetentionReport, error) {
+	report := RetentionReport{DryRun: dryRun}
+	now := time.Now()
+	for _, rule := range p.Rules {
+		remove, err := h.evalRetention(rule, now)
+		if err != nil {
+			return report, err
+		}
+		if len(remove) == 0 || dryRun {
+			report.Removed = append(report.Removed, remove...)
+			continue
+		}
+
+		if p.BundleDir != "" {
+			bundle, err := h.writeBundle(p.BundleDir, rule.Folder, remove, now)
+			if err != nil {
+				return report, fmt.Errorf("Unable to write retention bundle: %w", err)
+			}
+			report.Bundles = append(report.Bundles, bundle)
+		}
+		for _, e := range remove {
+			if err := h.removeRetained(e); err != nil {
+				log.Printf("Unable to remove %s: %s", e.file, err)
+				continue
+			}
+			report.Removed = append(report.Removed, e)
+		}
+	}
+	return report, nil
+}
+
+// removeRetained deletes the message file of e, and its flags unless other copies remain.
+func (h *DirHandler) removeRetained(e RetentionEntry) error {
+	rel := path.Join(e.Folder, filepath.Base(e.file))
+	return h.locked(func() error {
+		if err := os.Remove(e.file); err != nil {
+			return err
+		}
+		if validMID(e.MID) != nil {
+			return nil // No flags can be stored for it
+		}
+		return h.dropFlags(e.MID)
+	}, rel)
+}
+
+// evalRetention returns the messages of the rule's folder to be removed.
+func (h *DirHandler) evalRetention(rule RetentionRule, now time.Time) ([]RetentionEntry, error) {
+	folder, err := validFolder(rule.Folder)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(h.folderPath(folder))
+	if err != nil {
+		return nil, err
+	}
+	store, err := readFlags(h.MBoxPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []retentionCandidate
+	for _, fi := range infos {
+		if !isMessageFile(fi) {
+			continue
+		}
+		file := path.Join(h.folderPath(folder), fi.Name())
+		msg, err := OpenMessage(file)
+		if err != nil {
+			continue // Left for quarantine
+		}
+		date := msg.Date()
+		if date.IsZero() {
+			date = fi.ModTime()
+		}
+		candidates = append(candidates, retentionCandidate{
+			RetentionEntry: RetentionEntry{
+				Folder: folder,
+				MID:    msg.MID(),
+				Date:   date,
+				Size:   fi.Size(),
+				file:   file,
+			},
+			precedence: msg.Precedence(),
+			flagged:    store.flags(msg).Has(FlagFlagged),
+		})
+	}
+
+	// Most recent first
+	sort.Slice(candidates, func(i, j int) bool {
+		if !candidates[i].Date.Equal(candidates[j].Date) {
+			return candidates[i].Date.After(candidates[j].Date)
+		}
+		return candidates[i].MID < candidates[j].MID
+	})
+
+	var (
+		remove []RetentionEntry
+		count  int
+		size   int64
+	)
+	for _, c := range candidates {
+		if rule.exempt(c) {
+			continue
+		}
+		switch {
+		case rule.MaxAge > 0 && now.Sub(c.Date) > rule.MaxAge:
+			c.Reason = fmt.Sprintf("older than %s", rule.MaxAge)
+		case rule.MaxCount > 0 && count >= rule.MaxCount:
+			c.Reason = fmt.Sprintf("more than %d messages", rule.MaxCount)
+		case rule.MaxSize > 0 && size+c.Size > rule.MaxSize:
+			c.Reason = fmt.Sprintf("folder larger than %d bytes", rule.MaxSize)
+		default:
+			count++
+			size += c.Size
+			continue
+		}
+		remove = append(remove, c.RetentionEntry)
+	}
+	return remove, nil
+}
+
+func (rule RetentionRule) exempt(c retentionCandidate) bool {
+	if rule.KeepFlagged && c.flagged {
+		return true
+	}
+	for _, p := range rule.Exempt {
+		if p == c.precedence {
+			return true
+		}
+	}
+	return false
+}
+
+// writeBundle writes the given messages to a new tar.gz file in dir, and returns the file name.
+func (h *DirHandler) writeBundle(dir, folder string, entries []RetentionEntry, now time.Time) (string, error) {
+	if err := os.MkdirAll(dir, os.ModeDir|os.ModePerm); err != nil {
+		return "", err
+	}
+
+	base := fmt.Sprintf("%s-%s", strings.Trim(normFolder(folder), "/"), now.Format("2006-01-02"))
+	name := filepath.Join(dir, base+".tar.gz")
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	for i := 1; os.IsExist(err); i++ {
+		name = filepath.Join(dir, fmt.Sprintf("%s-%d.tar.gz", base, i))
+		f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = writeTarGz(f, func(tw *tar.Writer) error {
+		for _, e := range entries {
+			data, err := ioutil.ReadFile(e.file)
+			if err != nil {
+				return err
+			}
+			hdr := &tar.Header{
+				Name:    filepath.Base(e.file),
+				Mode:    0644,
+				Size:    int64(len(data)),
+				ModTime: e.Date,
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if _, err := tw.Write(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name)
+		return "", err
+	}
+	return name, nil
+}
+
+func writeTarGz(f *os.File, fn func(tw *tar.Writer) error) error {
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	if err := fn(tw); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,133 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+func TestRetention(t *testing.T) {
+	h := newTestDirHandler(t)
+
+	// Five sent messages, one per day
+	var msgs []*fbb.Message
+	for i := 0; i < 5; i++ {
+		msg := newTestMessage("LA5NTA", "N0CALL")
+		msg.SetDate(time.Now().Add(-time.Duration(i) * 24 * time.Hour))
+		if i == 4 {
+			msg.SetSubject("//WL2K Z/ Flash traffic")
+		}
+		if err := h.AddOut(msg); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.SetSentErr(msg.MID(), false); err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := h.SetFlags(msgs[3].MID(), FlagFlagged, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := RetentionPolicy{
+		Rules: []RetentionRule{{
+			Folder:      DIR_SENT,
+			MaxAge:      36 * time.Hour,
+			MaxCount:    1,
+			Exempt:      []fbb.Precedence{fbb.PrecedenceFlash},
+			KeepFlagged: true,
+		}},
+		BundleDir: filepath.Join(t.TempDir(), "bundles"),
+	}
+
+	// Message 0 is kept (most recent), 1 exceeds the count, 2 is too old,
+	// 3 is flagged and 4 has flash precedence.
+	report, err := h.ApplyRetention(policy, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Removed) != 2 || report.Removed[0].MID != msgs[1].MID() || report.Removed[1].MID != msgs[2].MID() {
+		t.Fatalf("Unexpected dry run report:\n%s", report)
+	}
+	if h.SentCount() != 5 {
+		t.Errorf("Messages removed in dry run")
+	}
+
+	report, err = h.ApplyRetention(policy, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Removed) != 2 || h.SentCount() != 3 {
+		t.Errorf("Expected 2 messages removed, got %d (%d left)", len(report.Removed), h.SentCount())
+	}
+	if len(report.Bundles) != 1 {
+		t.Fatalf("Expected 1 bundle, got %v", report.Bundles)
+	}
+
+	f, err := os.Open(report.Bundles[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var n int
+	for ; ; n++ {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		msg := new(fbb.Message)
+		if err := msg.ReadFrom(tr); err != nil {
+			t.Errorf("Unable to read %s from bundle: %s", hdr.Name, err)
+		}
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 messages in bundle, got %d", n)
+	}
+}
+
+func TestRetentionByFile(t *testing.T) {
+	h := newTestDirHandler(t)
+	msg := newTestMessage("LA5NTA", "N0CALL")
+	msg.SetDate(time.Now().Add(-48 * time.Hour))
+	data, err := msg.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A message file not named by the MID of the message
+	if err := ioutil.WriteFile(path.Join(h.MBoxPath, DIR_SENT, "COPY"+Ext), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := RetentionPolicy{Rules: []RetentionRule{{Folder: DIR_SENT, MaxAge: 24 * time.Hour}}}
+	report, err := h.ApplyRetention(policy, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Removed) != 1 || h.SentCount() != 0 {
+		t.Errorf("Expected message file to be removed, got %d removed (%d left)", len(report.Removed), h.SentCount())
+	}
+
+	for _, folder := range []string{"../outside", "", ".mids"} {
+		policy := RetentionPolicy{Rules: []RetentionRule{{Folder: folder, MaxCount: 1}}}
+		if _, err := h.ApplyRetention(policy, false); !errors.Is(err, ErrInvalidFolder) {
+			t.Errorf("%q: Expected ErrInvalidFolder, got %v", folder, err)
+		}
+	}
+}
@@ -0,0 +1,481 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// HEADER_AUTO_REPLY marks messages sent by a rule's auto-reply. Such messages are never replied to.
+const HEADER_AUTO_REPLY = "X-Auto-Reply"
+
+// The file holding the time of the last auto-reply to each sender, in the mailbox root.
+const autoReplyFile = ".autoreply.json"
+
+// DefaultReplyInterval is the default minimum time between auto-replies to the same sender.
+const DefaultReplyInterval = 24 * time.Hour
+
+// RuleSet is an ordered list of inbound message rules.
+//
+// Rule sets are stored as JSON, e.g.:
+//
+//	{"Rules": [
+//	  {"Name": "Spam", "Match": {"From": "*@spam.example"}, "Reject": true, "Stop": true},
+//	  {"Name": "Large", "Match": {"MinSize": 100000}, "Reject": true},
+//	  {"Name": "Weather", "Match": {"Subject": "^(GRIB|WX)"}, "File": "/weather/", "MarkRead": true},
+//	  {"Name": "Urgent", "Match": {"Precedence": "Flash"}, "Flag": true, "Forward": ["LA1B"]},
+//	  {"Name": "Away", "NotAfter": "2026-08-01T00:00:00Z", "Reply": "On a trip until August."}
+//	]}
+type RuleSet struct {
+	Rules []Rule
+}
+
+// Rule is an inbound message rule. The actions of a rule are applied to all messages matching it.
+type Rule struct {
+	Name  string
+	Match RuleMatch
+
+	// The rule is only active within this period. Zero values are ignored.
+	NotBefore, NotAfter time.Time
+
+	// Reject rejects matching proposals before they are downloaded.
+	//
+	// B2F proposals only carry the subject and the size of the message, so a
+	// rule matching anything else (e.g. the sender) is evaluated after
+	// download. Such messages are moved to the trash instead.
+	Reject bool
+
+	File     string   // Move the message to this folder, created if needed. The first matching rule wins.
+	Flag     bool     // Flag the message (see FlagFlagged).
+	MarkRead bool     // Mark the message as read.
+	Forward  []string // Forward a copy of the message to these addresses via the outbox.
+	Reply    string   // Send an auto-reply with this text to the sender via the outbox.
+
+	Stop bool // Stop evaluating the following rules.
+}
+
+// RuleMatch is the condition of a Rule. Empty fields match any message, and all non-empty fields must match.
+type RuleMatch struct {
+	From       string // Sender address. Case insensitive, with shell patterns (e.g. "*@winlink.org").
+	To         string // Any recipient address, like From.
+	Subject    string // Regular expression matched against the subject (case insensitive).
+	Precedence string // Precedence name (e.g. "Flash"). See fbb.Precedence.
+	MinSize    int    // Minimum message size in bytes.
+	MaxSize    int    // Maximum message size in bytes.
+
+	subject *regexp.Regexp
+}
+
+// LoadRules reads a rule set from the given JSON file.
+func LoadRules(filename string) (*RuleSet, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rs, err := ParseRules(f)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse rules (%s): %w", filename, err)
+	}
+	return rs, nil
+}
+
+// ParseRules reads a JSON encoded rule set from r.
+func ParseRules(r io.Reader) (*RuleSet, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	rs := new(RuleSet)
+	if err := dec.Decode(rs); err != nil {
+		return nil, err
+	}
+	return rs, rs.compile()
+}
+
+func (rs *RuleSet) compile() error {
+	for i := range rs.Rules {
+		m := &rs.Rules[i].Match
+		if m.Subject != "" {
+			re, err := regexp.Compile("(?i)" + m.Subject)
+			if err != nil {
+				return fmt.Errorf("Rule %q: %w", rs.Rules[i].Name, err)
+			}
+			m.subject = re
+		}
+		for _, pattern := range []string{m.From, m.To} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("Rule %q: invalid pattern %q", rs.Rules[i].Name, pattern)
+			}
+		}
+		if m.Precedence != "" && !validPrecedence(m.Precedence) {
+			return fmt.Errorf("Rule %q: unknown precedence %q", rs.Rules[i].Name, m.Precedence)
+		}
+	}
+	return nil
+}
+
+func validPrecedence(name string) bool {
+	for p := fbb.PrecedenceFlash; p <= fbb.PrecedenceRoutine; p++ {
+		if strings.EqualFold(p.String(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) active(now time.Time) bool {
+	return (r.NotBefore.IsZero() || !now.Before(r.NotBefore)) && (r.NotAfter.IsZero() || now.Before(r.NotAfter))
+}
+
+// proposalOnly reports whether the match can be evaluated without the message content.
+func (m RuleMatch) proposalOnly() bool { return m.From == "" && m.To == "" }
+
+func (m RuleMatch) matches(subject string, size int, from fbb.Address, receivers []fbb.Address) bool {
+	switch {
+	case m.subject != nil && !m.subject.MatchString(subject):
+		return false
+	case m.Precedence != "" && !strings.EqualFold(fbb.PrecedenceFromSubject(subject).String(), m.Precedence):
+		return false
+	case m.MinSize > 0 && size < m.MinSize:
+		return false
+	case m.MaxSize > 0 && size > m.MaxSize:
+		return false
+	case m.From != "" && !matchAddr(m.From, from):
+		return false
+	case m.To != "":
+		for _, addr := range receivers {
+			if matchAddr(m.To, addr) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchAddr(pattern string, addr fbb.Address) bool {
+	ok, _ := path.Match(strings.ToUpper(pattern), strings.ToUpper(addr.String()))
+	if !ok && addr.Proto == "" {
+		ok, _ = path.Match(strings.ToUpper(pattern), strings.ToUpper(addr.Addr))
+	}
+	return ok
+}
+
+// RuleResult is the outcome of the rules for one message.
+type RuleResult struct {
+	MID     string
+	From    string
+	Subject string
+
+	Rules    []string // The names of the matching rules.
+	Reject   bool
+	File     string
+	Flag     bool
+	MarkRead bool
+	Forward  []string
+	Reply    []string
+}
+
+// Matched reports whether any rule matched the message.
+func (r RuleResult) Matched() bool { return len(r.Rules) > 0 }
+
+func (r RuleResult) String() string {
+	var actions []string
+	if r.Reject {
+		actions = append(actions, "reject")
+	}
+	if r.File != "" {
+		actions = append(actions, "file to "+r.File)
+	}
+	if r.Flag {
+		actions = append(actions, "flag")
+	}
+	if r.MarkRead {
+		actions = append(actions, "mark read")
+	}
+	for _, addr := range r.Forward {
+		actions = append(actions, "forward to "+addr)
+	}
+	if len(r.Reply) > 0 {
+		actions = append(actions, "reply")
+	}
+	return fmt.Sprintf("%s\t%s\t%q\t[%s]\t%s", r.MID, r.From, r.Subject, strings.Join(r.Rules, ", "), strings.Join(actions, ", "))
+}
+
+// Eval returns the outcome of the rule set for the given message at the given time.
+func (rs *RuleSet) Eval(msg *fbb.Message, now time.Time) RuleResult {
+	res := RuleResult{MID: msg.MID(), From: msg.From().String(), Subject: msg.Subject()}
+	size := msg.BodySize()
+	for _, f := range msg.Files() {
+		size += f.Size()
+	}
+	for _, r := range rs.Rules {
+		if !r.active(now) || !r.Match.matches(msg.Subject(), size, msg.From(), msg.Receivers()) {
+			continue
+		}
+		res.Rules = append(res.Rules, r.Name)
+		res.Reject = res.Reject || r.Reject
+		if res.File == "" {
+			res.File = r.File
+		}
+		res.Flag = res.Flag || r.Flag
+		res.MarkRead = res.MarkRead || r.MarkRead
+		res.Forward = append(res.Forward, r.Forward...)
+		if r.Reply != "" {
+			res.Reply = append(res.Reply, r.Reply)
+		}
+		if r.Stop {
+			break
+		}
+	}
+	return res
+}
+
+// evalProposal returns the name of the first rule rejecting the proposal, if any.
+func (rs *RuleSet) evalProposal(p *fbb.Proposal, now time.Time) (string, bool) {
+	for _, r := range rs.Rules {
+		if !r.active(now) {
+			continue
+		}
+		if !r.Match.proposalOnly() {
+			if r.Stop {
+				break // Might stop the evaluation for this message, we can't tell yet
+			}
+			continue
+		}
+		if !r.Match.matches(p.Title(), p.Size(), fbb.Address{}, nil) {
+			continue
+		}
+		if r.Reject {
+			return r.Name, true
+		}
+		if r.Stop {
+			break
+		}
+	}
+	return "", false
+}
+
+// RulesHandler is a DirHandler applying a RuleSet to inbound messages.
+//
+// Proposals are rejected by GetInboundAnswer, and the remaining actions are
+// applied by ProcessInbound after the messages are saved to the inbox.
+// Failing actions are logged, as the messages have already been received.
+type RulesHandler struct {
+	*DirHandler
+
+	Rules *RuleSet
+
+	// ReplyInterval is the minimum time between auto-replies to the same sender.
+	//
+	// The time of the last auto-reply is persisted in the mailbox, so that the
+	// interval is honoured across restarts and processes sharing the mailbox.
+	ReplyInterval time.Duration
+
+	mycall string
+	mu     sync.Mutex
+}
+
+// NewRulesHandler returns a RulesHandler applying rules to the inbound messages of h.
+//
+// mycall is the sender of forwarded messages and auto-replies.
+func NewRulesHandler(h *DirHandler, mycall string, rules *RuleSet) *RulesHandler {
+	return &RulesHandler{
+		DirHandler:    h,
+		Rules:         rules,
+		ReplyInterval: DefaultReplyInterval,
+		mycall:        mycall,
+	}
+}
+
+// GetInboundAnswer rejects proposals rejected by a rule, see Rule.Reject.
+func (h *RulesHandler) GetInboundAnswer(p fbb.Proposal) fbb.ProposalAnswer {
+	answer := h.DirHandler.GetInboundAnswer(p)
+	if answer != fbb.Accept || h.Rules == nil {
+		return answer
+	}
+	if name, reject := h.Rules.evalProposal(&p, time.Now()); reject {
+		log.Printf("Rejecting %s (%s): rule %q", p.MID(), p.Title(), name)
+		return fbb.Reject
+	}
+	return answer
+}
+
+// ProcessInbound saves the messages to the inbox, and applies the rules.
+func (h *RulesHandler) ProcessInbound(msgs ...*fbb.Message) error {
+	if err := h.DirHandler.ProcessInbound(msgs...); err != nil {
+		return err
+	}
+	if h.Rules == nil {
+		return nil
+	}
+	now := time.Now()
+	for _, msg := range msgs {
+		res := h.Rules.Eval(msg, now)
+		if !res.Matched() {
+			continue
+		}
+		if err := h.apply(msg, res, now); err != nil {
+			log.Printf("Unable to apply rules %v to %s: %s", res.Rules, msg.MID(), err)
+		}
+	}
+	return nil
+}
+
+func (h *RulesHandler) apply(msg *fbb.Message, res RuleResult, now time.Time) error {
+	if res.Reject {
+		return h.Trash(msg.MID(), DIR_INBOX)
+	}
+
+	if len(res.Forward) > 0 {
+		fw, err := msg.Forward(h.mycall)
+		if err != nil {
+			return err
+		}
+		fw.AddTo(res.Forward...)
+		if err := h.AddOut(fw); err != nil {
+			return err
+		}
+	}
+	if len(res.Reply) > 0 {
+		ok, err := h.shouldReply(msg, now)
+		if err != nil {
+			return err
+		}
+		if ok {
+			reply, err := autoReply(h.mycall, msg, res.Reply)
+			if err != nil {
+				return err
+			}
+			if err := h.AddOut(reply); err != nil {
+				return err
+			}
+		}
+	}
+
+	var set Flags
+	if res.Flag {
+		set |= FlagFlagged
+	}
+	if res.MarkRead {
+		set |= FlagRead
+	}
+	if set != 0 {
+		if err := h.SetFlags(msg.MID(), set, 0); err != nil {
+			return err
+		}
+	}
+
+	if res.File == "" || normFolder(res.File) == DIR_INBOX {
+		return nil
+	}
+	if err := h.CreateFolder(res.File); err != nil && !errors.Is(err, ErrFolderExists) {
+		return err
+	}
+	return h.Move(msg.MID(), DIR_INBOX, res.File)
+}
+
+// shouldReply reports whether an auto-reply should be sent to the sender of msg, and records it.
+func (h *RulesHandler) shouldReply(msg *fbb.Message, now time.Time) (bool, error) {
+	from := msg.From()
+	if from.IsZero() || from.EqualString(h.mycall) || msg.Header.Get(HEADER_AUTO_REPLY) != "" {
+		return false, nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var reply bool
+	err := h.locked(func() error {
+		replied, err := h.readReplied()
+		if err != nil {
+			return err
+		}
+		if last, ok := replied[from.String()]; ok && now.Sub(last) < h.ReplyInterval {
+			return nil
+		}
+		reply = true
+
+		// Forget senders that may be replied to again anyway
+		for sender, last := range replied {
+			if now.Sub(last) >= h.ReplyInterval {
+				delete(replied, sender)
+			}
+		}
+		replied[from.String()] = now
+		data, err := json.Marshal(replied)
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(path.Join(h.MBoxPath, autoReplyFile), data, 0644)
+	})
+	return reply, err
+}
+
+// readReplied returns the time of the last auto-reply by sender address. The caller must hold the mailbox lock.
+func (h *RulesHandler) readReplied() (map[string]time.Time, error) {
+	replied := make(map[string]time.Time)
+	data, err := ioutil.ReadFile(path.Join(h.MBoxPath, autoReplyFile))
+	if os.IsNotExist(err) {
+		return replied, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &replied); err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %w", autoReplyFile, err)
+	}
+	return replied, nil
+}
+
+// autoReply returns a reply to msg with the given text, quoting the original message.
+func autoReply(mycall string, msg *fbb.Message, text []string) (*fbb.Message, error) {
+	reply, err := msg.Reply(mycall, false)
+	if err != nil {
+		return nil, err
+	}
+	quote, _ := reply.Body()
+	reply.Header.Set(HEADER_AUTO_REPLY, "true")
+	return reply, reply.SetBody(strings.Join(text, "\r\n\r\n") + quote)
+}
+
+// DryRun evaluates the rules against the messages in the given folder, without applying any action.
+//
+// Only messages matching at least one rule are returned.
+func (h *RulesHandler) DryRun(folder string) ([]RuleResult, error) {
+	if h.Rules == nil {
+		return nil, nil
+	}
+	folder, err := validFolder(folder)
+	if err != nil {
+		return nil, err
+	}
+	MIDs, err := h.folderMIDs(folder)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var results []RuleResult
+	for _, MID := range MIDs {
+		msg, err := h.Message(folder, MID)
+		if err != nil {
+			return results, err
+		}
+		if res := h.Rules.Eval(msg, now); res.Matched() {
+			results = append(results, res)
+		}
+	}
+	return results, nil
+}
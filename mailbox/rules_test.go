@@ -0,0 +1,142 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+const testRules = `{"Rules": [
+  {"Name": "Large", "Match": {"MinSize": 1000}, "Reject": true},
+  {"Name": "Friends", "Match": {"From": "LA1B"}, "Stop": true},
+  {"Name": "Spam", "Match": {"From": "*@spam.example"}, "Reject": true, "Stop": true},
+  {"Name": "Binary", "Match": {"Subject": "^bin"}, "Reject": true},
+  {"Name": "Weather", "Match": {"Subject": "^wx"}, "File": "/weather/", "MarkRead": true},
+  {"Name": "Urgent", "Match": {"Precedence": "Flash"}, "Flag": true, "Forward": ["LA1B"]},
+  {"Name": "Away", "Reply": "QRT until Monday"}
+]}`
+
+func newTestRulesHandler(t *testing.T) *RulesHandler {
+	rules, err := ParseRules(strings.NewReader(testRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewRulesHandler(newTestDirHandler(t), "LA5NTA", rules)
+}
+
+func TestParseRulesInvalid(t *testing.T) {
+	for _, data := range []string{
+		`{"Rules": [{"Match": {"Subject": "("}}]}`,
+		`{"Rules": [{"Match": {"Precedence": "Urgent"}}]}`,
+		`{"Rules": [{"Unknown": true}]}`,
+	} {
+		if _, err := ParseRules(strings.NewReader(data)); err == nil {
+			t.Errorf("Expected error for %s", data)
+		}
+	}
+}
+
+func TestRulesProposal(t *testing.T) {
+	h := newTestRulesHandler(t)
+
+	small := newTestMessage("N0CALL", "LA5NTA")
+	large := newTestMessage("N0CALL", "LA5NTA")
+	large.SetBody(strings.Repeat("x", 2000))
+
+	// The sender is unknown before download, so rules after a
+	// sender-dependent stop rule are not applied to proposals.
+	binary := newTestMessage("N0CALL", "LA5NTA")
+	binary.SetSubject("bin data")
+	for _, tt := range []struct {
+		msg    *fbb.Message
+		expect fbb.ProposalAnswer
+	}{{small, fbb.Accept}, {large, fbb.Reject}, {binary, fbb.Accept}} {
+		p, err := tt.msg.Proposal(fbb.BasicProposal)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := h.GetInboundAnswer(*p); got != tt.expect {
+			t.Errorf("%s: expected %c, got %c", tt.msg.Subject(), tt.expect, got)
+		}
+	}
+}
+
+func TestRulesProcessInbound(t *testing.T) {
+	h := newTestRulesHandler(t)
+
+	wx := newTestMessage("N0CALL", "LA5NTA")
+	wx.SetSubject("WX forecast")
+	flash := newTestMessage("N0CALL", "LA5NTA")
+	flash.SetSubject("//WL2K Z/ Mayday")
+	spam := newTestMessage("bulk@spam.example", "LA5NTA")
+	friend := newTestMessage("LA1B", "LA5NTA")
+	if err := h.ProcessInbound(wx, flash, spam, friend); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFolders(t, h.DirHandler, wx.MID(), "/weather/")
+	assertFolders(t, h.DirHandler, spam.MID(), DIR_TRASH)
+	assertFolders(t, h.DirHandler, friend.MID(), DIR_INBOX)
+	if flags, _ := h.Flags(wx.MID()); !flags.Has(FlagRead) {
+		t.Errorf("Expected %s to be marked read", wx.MID())
+	}
+	if flags, _ := h.Flags(flash.MID()); !flags.Has(FlagFlagged) {
+		t.Errorf("Expected %s to be flagged", flash.MID())
+	}
+
+	// One forward (flash) and one auto-reply to N0CALL (only once)
+	outbound, err := h.Outbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var forwards, replies int
+	for _, m := range outbound {
+		switch {
+		case m.Header.Get(HEADER_AUTO_REPLY) != "":
+			replies++
+			if !m.IsOnlyReceiver(fbb.AddressFromString("N0CALL")) {
+				t.Errorf("Auto-reply to unexpected receivers: %v", m.Receivers())
+			}
+			if m.Subject() != "Re: WX forecast" {
+				t.Errorf("Unexpected auto-reply subject %q", m.Subject())
+			}
+		case strings.HasPrefix(m.Subject(), "Fwd: "):
+			forwards++
+			if m.InReplyTo() != flash.MID() {
+				t.Errorf("Forward does not reference the original message")
+			}
+		}
+	}
+	if forwards != 1 || replies != 1 {
+		t.Errorf("Expected 1 forward and 1 reply, got %d and %d", forwards, replies)
+	}
+
+	// The auto-reply interval survives a restart
+	h = NewRulesHandler(NewDirHandler(h.MBoxPath, false), "LA5NTA", h.Rules)
+	again := newTestMessage("N0CALL", "LA5NTA")
+	again.SetSubject("Re: Test message")
+	if err := h.ProcessInbound(again); err != nil {
+		t.Fatal(err)
+	}
+	if n := h.OutboxCount(); n != len(outbound) {
+		t.Errorf("Auto-reply sent again after restart")
+	}
+
+	// Dry run against the inbox only reports, and doesn't touch the outbox
+	outbox := h.OutboxCount()
+	results, err := h.DryRun(DIR_INBOX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Errorf("Expected 3 matching messages, got %v", results)
+	}
+	if h.OutboxCount() != outbox {
+		t.Errorf("Dry run changed the outbox")
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/catalog"
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+// The file holding the last tick of each recurring template, in the mailbox root.
+const scheduleFile = ".schedule.json"
+
+// Schedule adds msg to the outbox, to be delivered between notBefore and expiresAt.
+//
+// A zero notBefore means now, and a zero expiresAt means no expiry. Messages
+// not delivered in time are moved to the failed folder by GetOutbound.
+func (h *DirHandler) Schedule(msg *fbb.Message, notBefore, expiresAt time.Time) error {
+	if !expiresAt.IsZero() && expiresAt.Before(notBefore) {
+		return fmt.Errorf("Unable to schedule %s: expires before it's due", msg.MID())
+	}
+	SetNotBefore(msg, notBefore)
+	SetExpiresAt(msg, expiresAt)
+	return h.AddOut(msg)
+}
+
+// MessageFunc creates a new outbound message for a Recurring tick.
+type MessageFunc func(tick time.Time) (*fbb.Message, error)
+
+// Recurring is a template for a message sent at regular intervals, e.g. a daily position report.
+//
+// A new message (with a new MID) is added to the outbox for every tick at
+// Start + n*Interval. If several ticks have passed since the last run, only
+// one message is created for the most recent tick.
+type Recurring struct {
+	Name     string // Unique name, identifying the template in the schedule state.
+	Start    time.Time
+	Interval time.Duration
+
+	// Expiry (if non-zero) discards each message if not delivered within this
+	// duration after its tick, e.g. so that stale position reports are not sent.
+	Expiry time.Duration
+
+	New MessageFunc
+}
+
+// Tick returns the most recent tick at or before now. The returned time is zero if now is before Start.
+func (r Recurring) Tick(now time.Time) time.Time {
+	if now.Before(r.Start) || r.Interval <= 0 {
+		return time.Time{}
+	}
+	return r.Start.Add(now.Sub(r.Start) / r.Interval * r.Interval)
+}
+
+// PosReportFunc returns a MessageFunc creating a position report from the given template.
+//
+// The date of the report is set to the tick. If report is non-nil, it's called to
+// update the template (e.g. with a fresh GPS fix) before each message is created.
+func PosReportFunc(mycall string, template catalog.PosReport, report func(p *catalog.PosReport) error) MessageFunc {
+	return func(tick time.Time) (*fbb.Message, error) {
+		p := template
+		if report != nil {
+			if err := report(&p); err != nil {
+				return nil, err
+			}
+		}
+		p.Date = tick
+		return p.Message(mycall), nil
+	}
+}
+
+// RunRecurring adds a message to the outbox for every template with a tick due since the last run.
+//
+// The last tick of each template is persisted in the mailbox, so that a message
+// is created once per tick across restarts. The messages are created (by the
+// templates' MessageFunc) without holding the mailbox lock. The schedule state
+// is then re-checked and updated while holding the lock, so processes sharing
+// the mailbox never add the same tick twice. The added messages are returned.
+//
+// An error is returned if a created message has an invalid MID or a MID
+// already in the outbox.
+//
+// GetOutbound calls RunRecurring with the templates in h.Recurring.
+func (h *DirHandler) RunRecurring(now time.Time, templates ...Recurring) ([]*fbb.Message, error) {
+	for _, r := range templates {
+		if r.New == nil {
+			return nil, fmt.Errorf("Recurring message %q has no MessageFunc", r.Name)
+		}
+	}
+
+	h.scheduleMu.Lock()
+	defer h.scheduleMu.Unlock()
+
+	state, err := h.readSchedule()
+	if err != nil {
+		return nil, err
+	}
+
+	type pending struct {
+		name string
+		tick time.Time
+		msg  *fbb.Message
+		data []byte
+	}
+	var due []pending
+	for _, r := range templates {
+		tick := r.Tick(now)
+		if tick.IsZero() || !tick.After(state[r.Name]) {
+			continue
+		}
+		msg, err := r.New(tick)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to create recurring message %q: %w", r.Name, err)
+		}
+		if err := validMID(msg.MID()); err != nil {
+			return nil, fmt.Errorf("Recurring message %q: %w", r.Name, err)
+		}
+		if r.Expiry > 0 {
+			SetExpiresAt(msg, tick.Add(r.Expiry))
+		}
+		data, err := msg.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		due = append(due, pending{r.Name, tick, msg, data})
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+
+	var (
+		created []*fbb.Message
+		changed []string
+	)
+	err = h.locked(func() error {
+		// Another process might have added some of the ticks in the meantime.
+		state, err := h.readSchedule()
+		if err != nil {
+			return err
+		}
+		for _, p := range due {
+			if !p.tick.After(state[p.name]) {
+				continue
+			}
+			rel := path.Join(DIR_OUTBOX, p.msg.MID()+Ext)
+			if _, err := os.Stat(path.Join(h.MBoxPath, rel)); err == nil {
+				return fmt.Errorf("Recurring message %q: %s in %s: %w", p.name, p.msg.MID(), DIR_OUTBOX, ErrMessageExists)
+			}
+			if err := writeFileAtomic(path.Join(h.MBoxPath, rel), p.data, 0644); err != nil {
+				return err
+			}
+			created, changed = append(created, p.msg), append(changed, rel)
+
+			state[p.name] = p.tick
+			if err := h.writeSchedule(state); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	h.reindex(changed...)
+	h.notifyWatchers(changed...)
+	return created, err
+}
+
+func (h *DirHandler) readSchedule() (map[string]time.Time, error) {
+	state := make(map[string]time.Time)
+	data, err := ioutil.ReadFile(filepath.Join(h.MBoxPath, scheduleFile))
+	if os.IsNotExist(err) {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %w", scheduleFile, err)
+	}
+	return state, nil
+}
+
+// writeSchedule persists the schedule state. The caller must hold the mailbox lock.
+func (h *DirHandler) writeSchedule(state map[string]time.Time) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(h.MBoxPath, scheduleFile), data, 0644)
+}
@@ -0,0 +1,170 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pnousiai/wl2k-go/catalog"
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+func TestSchedule(t *testing.T) {
+	h := newTestDirHandler(t)
+	now := time.Now()
+
+	later := newTestMessage("LA5NTA", "N0CALL")
+	if err := h.Schedule(later, now.Add(time.Hour), now.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	stale := newTestMessage("LA5NTA", "N0CALL")
+	if err := h.Schedule(stale, time.Time{}, now.Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Schedule(newTestMessage("LA5NTA", "N0CALL"), now, now.Add(-time.Hour)); err == nil {
+		t.Errorf("Expected error for message expiring before it's due")
+	}
+
+	if msgs := h.GetOutbound(); len(msgs) != 0 {
+		t.Errorf("Expected no messages due, got %d", len(msgs))
+	}
+	assertFolders(t, h, later.MID(), DIR_OUTBOX)
+	assertFolders(t, h, stale.MID(), DIR_FAILED)
+}
+
+func TestRecurring(t *testing.T) {
+	h := newTestDirHandler(t)
+
+	lat, lon := 59.9, 10.7
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	daily := Recurring{
+		Name:     "position",
+		Start:    start,
+		Interval: 24 * time.Hour,
+		Expiry:   time.Hour,
+		New:      PosReportFunc("LA5NTA", catalog.PosReport{Lat: &lat, Lon: &lon}, nil),
+	}
+
+	run := func(now time.Time) []*fbb.Message {
+		t.Helper()
+		created, err := h.RunRecurring(now, daily)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return created
+	}
+
+	if created := run(start.Add(-time.Minute)); len(created) != 0 {
+		t.Errorf("Message created before start")
+	}
+	first := run(start.Add(3 * time.Hour))
+	if len(first) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(first))
+	}
+	if exp := Delivery(first[0]).ExpiresAt; !exp.Equal(start.Add(time.Hour)) {
+		t.Errorf("Unexpected expiry %s", exp)
+	}
+	if created := run(start.Add(5 * time.Hour)); len(created) != 0 {
+		t.Errorf("Expected one message per tick, got %d", len(created))
+	}
+
+	// Survives a restart, and skips missed ticks
+	h = NewDirHandler(h.MBoxPath, false)
+	second := run(start.Add(72*time.Hour + time.Minute))
+	if len(second) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(second))
+	}
+	if second[0].MID() == first[0].MID() {
+		t.Errorf("Recurring message reused MID %s", first[0].MID())
+	}
+	if h.OutboxCount() != 2 {
+		t.Errorf("Expected 2 messages in outbox, got %d", h.OutboxCount())
+	}
+}
+
+func TestRecurringShared(t *testing.T) {
+	base := newTestDirHandler(t)
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	beacon := Recurring{
+		Name:     "beacon",
+		Start:    start,
+		Interval: time.Hour,
+		New: func(tick time.Time) (*fbb.Message, error) {
+			return newTestMessage("LA5NTA", "N0CALL"), nil
+		},
+	}
+
+	// Separate handlers (as in separate processes) sharing the mailbox
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := NewDirHandler(base.MBoxPath, false).RunRecurring(start.Add(time.Minute), beacon); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := base.OutboxCount(); n != 1 {
+		t.Errorf("Expected 1 message for the tick, got %d", n)
+	}
+
+	if _, err := base.RunRecurring(start, Recurring{Name: "broken", Start: start, Interval: time.Hour}); err == nil {
+		t.Errorf("Expected error for template without MessageFunc")
+	}
+}
+
+func TestRecurringMessageFunc(t *testing.T) {
+	h := newTestDirHandler(t)
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	history, err := h.History()
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(New MessageFunc) ([]*fbb.Message, error) {
+		t.Helper()
+		done := make(chan struct{})
+		var created []*fbb.Message
+		go func() {
+			defer close(done)
+			created, err = h.RunRecurring(start, Recurring{Name: t.Name(), Start: start, Interval: time.Hour, New: New})
+		}()
+		select {
+		case <-done:
+			return created, err
+		case <-time.After(5 * time.Second):
+			t.Fatal("RunRecurring deadlocked")
+			return nil, nil
+		}
+	}
+
+	// The MessageFunc may use the mailbox (e.g. the MID history)
+	created, err := run(func(tick time.Time) (*fbb.Message, error) {
+		gen := fbb.NewUniqueMIDGenerator(fbb.DefaultMIDGenerator, history)
+		return fbb.NewMessageWithMIDGenerator(fbb.Private, "LA5NTA", gen), nil
+	})
+	if err != nil || len(created) != 1 {
+		t.Fatalf("Expected 1 message, got %d: %v", len(created), err)
+	}
+
+	// The MID must be valid, and not overwrite another outbound message
+	start = start.Add(time.Hour)
+	for _, MID := range []string{"../../escape", created[0].MID()} {
+		MID := MID
+		if _, err := run(func(tick time.Time) (*fbb.Message, error) {
+			msg := newTestMessage("LA5NTA", "N0CALL")
+			msg.Header.Set(fbb.HEADER_MID, MID)
+			return msg, nil
+		}); err == nil {
+			t.Errorf("Expected error for MID %q", MID)
+		}
+	}
+	if n := h.OutboxCount(); n != 1 {
+		t.Errorf("Expected 1 message in outbox, got %d", n)
+	}
+}
@@ -6,6 +6,7 @@
 package mailbox
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -14,6 +15,8 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pnousiai/wl2k-go/fbb"
 )
@@ -23,15 +26,52 @@ const (
 	DIR_OUTBOX  = "/out/"
 	DIR_SENT    = "/sent/"
 	DIR_ARCHIVE = "/archive/"
+
+	// Outbound messages that could not be delivered are moved here.
+	DIR_FAILED = "/failed/"
+
+	// Unreadable message files found by DirHandler are moved here.
+	DIR_QUARANTINE = "/quarantine/"
 )
 
 const Ext = ".b2f"
 
 // NewDirHandler is a file system (directory) oriented mailbox handler.
+//
+// All writes are atomic (write to temporary file and rename), and modifications
+// are serialized by an advisory lock file in the mailbox directory, so that a
+// mailbox can safely be shared by several handlers and processes.
 type DirHandler struct {
 	MBoxPath string
-	deferred map[string]bool
-	sendOnly bool
+
+	// Retry controls when outbound messages are offered for delivery.
+	// The delivery state is persisted in the outbox message files.
+	Retry RetryPolicy
+
+	// HistoryRetention is how long received MIDs are remembered (see History).
+	// It must be set before the first call to Prepare.
+	HistoryRetention time.Duration
+
+	// Retention (if set) is applied by Prepare. See ApplyRetention.
+	Retention *RetentionPolicy
+
+	// Recurring messages due are added to the outbox by GetOutbound. See RunRecurring.
+	Recurring []Recurring
+
+	deferred  map[string]bool
+	attempted map[string]bool // Outbound MIDs offered in this session.
+	sendOnly  bool
+
+	indexMu sync.Mutex
+	index   *Index // Opened by Index()
+
+	historyMu sync.Mutex
+	history   *History // Opened by History()
+
+	watchMu  sync.Mutex
+	watchers []*Watcher
+
+	scheduleMu sync.Mutex
 }
 
 // NewDirHandler wraps the directory given by path as a DirHandler.
@@ -39,30 +79,119 @@ type DirHandler struct {
 // If sendOnly is true, all inbound messages will be deferred.
 func NewDirHandler(path string, sendOnly bool) *DirHandler {
 	return &DirHandler{
-		MBoxPath: path,
-		sendOnly: sendOnly,
+		MBoxPath:         path,
+		Retry:            DefaultRetryPolicy,
+		HistoryRetention: DefaultHistoryRetention,
+		sendOnly:         sendOnly,
 	}
 }
 
 func (h *DirHandler) Prepare() (err error) {
 	h.deferred = make(map[string]bool)
-	return ensureDirStructure(h.MBoxPath)
+	h.attempted = make(map[string]bool)
+	if err := ensureDirStructure(h.MBoxPath); err != nil {
+		return err
+	}
+	if _, err = h.History(); err != nil {
+		return err
+	}
+
+	if h.Retention != nil {
+		// Failing to prune is not a reason to abort the session.
+		if _, err := h.ApplyRetention(*h.Retention, false); err != nil {
+			log.Printf("Unable to apply mailbox retention policy: %s", err)
+		}
+	}
+	return nil
 }
 
-func (h *DirHandler) Inbox() ([]*fbb.Message, error) {
-	return LoadMessageDir(path.Join(h.MBoxPath, DIR_INBOX))
+// History returns the received-MID history of this mailbox, opening it on first use.
+//
+// Once opened, the history is kept up to date by ProcessInbound and consulted by GetInboundAnswer.
+func (h *DirHandler) History() (*History, error) {
+	h.historyMu.Lock()
+	defer h.historyMu.Unlock()
+	if h.history != nil {
+		return h.history, nil
+	}
+	history, err := OpenHistory(h.MBoxPath, h.HistoryRetention)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open MID history: %w", err)
+	}
+	h.history = history
+	return history, nil
 }
 
-func (h *DirHandler) Outbox() ([]*fbb.Message, error) {
-	return LoadMessageDir(path.Join(h.MBoxPath, DIR_OUTBOX))
+func (h *DirHandler) Inbox() ([]*fbb.Message, error)   { return h.loadDir(DIR_INBOX) }
+func (h *DirHandler) Outbox() ([]*fbb.Message, error)  { return h.loadDir(DIR_OUTBOX) }
+func (h *DirHandler) Sent() ([]*fbb.Message, error)    { return h.loadDir(DIR_SENT) }
+func (h *DirHandler) Archive() ([]*fbb.Message, error) { return h.loadDir(DIR_ARCHIVE) }
+func (h *DirHandler) Failed() ([]*fbb.Message, error)  { return h.loadDir(DIR_FAILED) }
+
+// loadDir loads all messages in the given mailbox folder.
+//
+// Unreadable message files are moved to DIR_QUARANTINE.
+func (h *DirHandler) loadDir(dir string) ([]*fbb.Message, error) {
+	msgs, err := loadMessageDir(path.Join(h.MBoxPath, dir), h.quarantine)
+	if err != nil {
+		return msgs, err
+	}
+	store, err := readFlags(h.MBoxPath)
+	if err != nil {
+		log.Printf("Unable to read message flags: %s", err)
+		return msgs, nil
+	}
+	for _, m := range msgs {
+		store.apply(m)
+	}
+	return msgs, nil
 }
 
-func (h *DirHandler) Sent() ([]*fbb.Message, error) {
-	return LoadMessageDir(path.Join(h.MBoxPath, DIR_SENT))
+// quarantine moves a message file that can not be parsed to the quarantine folder.
+//
+// Other errors (e.g. too many open files or permission denied) are only logged,
+// as the file might be readable later.
+func (h *DirHandler) quarantine(filePath string, err error) {
+	if !errors.Is(err, ErrInvalidMessage) {
+		log.Println(err)
+		return
+	}
+
+	err = h.locked(func() error {
+		// The file might have been replaced since it was read.
+		if _, err := OpenMessage(filePath); !errors.Is(err, ErrInvalidMessage) {
+			return nil
+		}
+		log.Printf("Quarantining unreadable message file: %s", err)
+		dir := path.Join(h.MBoxPath, DIR_QUARANTINE)
+		if err := os.MkdirAll(dir, os.ModeDir|os.ModePerm); err != nil {
+			return fmt.Errorf("Unable to create quarantine directory: %w", err)
+		}
+		return os.Rename(filePath, path.Join(dir, filepath.Base(filePath)))
+	})
+	if err != nil {
+		log.Printf("Unable to quarantine %s: %s", filePath, err)
+	}
 }
 
-func (h *DirHandler) Archive() ([]*fbb.Message, error) {
-	return LoadMessageDir(path.Join(h.MBoxPath, DIR_ARCHIVE))
+// lock acquires the mailbox lock. See lockMailbox.
+func (h *DirHandler) lock() (unlock func(), err error) { return lockMailbox(h.MBoxPath) }
+
+// locked runs fn while holding the mailbox lock.
+//
+// The mailbox index (if opened) and watchers are updated with the given message
+// files (relative to the mailbox root) after the lock is released.
+func (h *DirHandler) locked(fn func() error, changed ...string) error {
+	unlock, err := h.lock()
+	if err != nil {
+		return fmt.Errorf("Unable to lock mailbox: %w", err)
+	}
+	err = fn()
+	unlock()
+
+	h.reindex(changed...)
+	h.notifyWatchers(changed...)
+	return err
 }
 
 // InboxCount returns the number of messages in the inbox. -1 on error.
@@ -70,103 +199,178 @@ func (h *DirHandler) InboxCount() int   { return countFiles(path.Join(h.MBoxPath
 func (h *DirHandler) OutboxCount() int  { return countFiles(path.Join(h.MBoxPath, DIR_OUTBOX)) }
 func (h *DirHandler) SentCount() int    { return countFiles(path.Join(h.MBoxPath, DIR_SENT)) }
 func (h *DirHandler) ArchiveCount() int { return countFiles(path.Join(h.MBoxPath, DIR_ARCHIVE)) }
+func (h *DirHandler) FailedCount() int  { return countFiles(path.Join(h.MBoxPath, DIR_FAILED)) }
 
 func (h *DirHandler) AddOut(msg *fbb.Message) error {
+	if err := validMID(msg.MID()); err != nil {
+		return err
+	}
 	data, err := msg.Bytes()
 	if err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(path.Join(h.MBoxPath, DIR_OUTBOX, msg.MID()+Ext), data, 0644)
+	rel := path.Join(DIR_OUTBOX, msg.MID()+Ext)
+	return h.locked(func() error {
+		return writeFileAtomic(path.Join(h.MBoxPath, rel), data, 0644)
+	}, rel)
 }
 
 func (h *DirHandler) ProcessInbound(msgs ...*fbb.Message) (err error) {
-	dir := path.Join(h.MBoxPath, DIR_INBOX)
-	for _, m := range msgs {
-		filename := path.Join(dir, m.MID()+Ext)
+	changed := make([]string, len(msgs))
+	for i, m := range msgs {
+		if err := validMID(m.MID()); err != nil {
+			return err
+		}
+		changed[i] = path.Join(DIR_INBOX, m.MID()+Ext)
+	}
 
-		m.Header.Set("X-Unread", "true")
+	err = h.locked(func() error {
+		for i, m := range msgs {
+			filename := path.Join(h.MBoxPath, changed[i])
 
-		data, err := m.Bytes()
-		if err != nil {
-			return err
+			m.Header.Set("X-Unread", "true")
+
+			data, err := m.Bytes()
+			if err != nil {
+				return err
+			}
+
+			if err = writeFileAtomic(filename, data, 0664); err != nil {
+				return fmt.Errorf("Unable to write received message (%s): %s", filename, err)
+			}
 		}
+		return nil
+	}, changed...)
+	if err != nil {
+		return err
+	}
 
-		if err = ioutil.WriteFile(filename, data, 0664); err != nil {
-			return fmt.Errorf("Unable to write received message (%s): %s", filename, err)
+	history, err := h.History()
+	if err == nil {
+		MIDs := make([]string, len(msgs))
+		for i, m := range msgs {
+			MIDs[i] = m.MID()
 		}
+		err = history.Add(MIDs...)
 	}
-	return
+	if err != nil {
+		// The messages are safely stored in the inbox, no need to fail the exchange.
+		log.Printf("Unable to record received messages: %s", err)
+	}
+	return nil
 }
 
 func (h *DirHandler) GetInboundAnswer(p fbb.Proposal) fbb.ProposalAnswer {
 	if h.sendOnly {
 		return fbb.Defer
 	}
+	if err := validMID(p.MID()); err != nil {
+		log.Printf("Rejecting proposal: %s", err)
+		return fbb.Reject
+	}
 
 	// Check if file exists
 	f, err := os.Open(path.Join(h.MBoxPath, DIR_INBOX, p.MID()+Ext))
 	if err == nil {
 		f.Close()
 		return fbb.Reject
-	} else if os.IsNotExist(err) {
-		return fbb.Accept
-	} else if err != nil {
+	} else if !os.IsNotExist(err) {
 		log.Printf("Unable to determin if %s has been received: %s", p.MID(), err)
 	}
 
+	// The message might have been archived or deleted since it was received
+	if history, err := h.History(); err != nil {
+		log.Println(err)
+	} else if history.HasMID(p.MID()) {
+		return fbb.Reject
+	}
+
 	return fbb.Accept
 }
 
+// SetSent moves the message identified by MID from the outbox to the sent folder.
+//
+// Errors are logged. See SetSentErr.
 func (h *DirHandler) SetSent(MID string, rejected bool) {
-	oldPath := path.Join(h.MBoxPath, DIR_OUTBOX, MID+Ext)
-	newPath := path.Join(h.MBoxPath, DIR_SENT, MID+Ext)
+	if err := h.SetSentErr(MID, rejected); err != nil {
+		log.Println(err)
+	}
+}
+
+// SetSentErr is like SetSent, but returns any error.
+//
+// It implements fbb.OutboundErrHandler.
+func (h *DirHandler) SetSentErr(MID string, rejected bool) error {
+	return h.move(MID, DIR_OUTBOX, DIR_SENT)
+}
 
-	if err := os.Rename(oldPath, newPath); err != nil {
-		log.Fatalf("Unable to move %s to %s: %s", oldPath, newPath, err)
+// move moves the message identified by MID from one folder to another.
+func (h *DirHandler) move(MID, from, to string) error {
+	if err := validMID(MID); err != nil {
+		return err
 	}
+	oldRel, newRel := path.Join(from, MID+Ext), path.Join(to, MID+Ext)
+	return h.locked(func() error {
+		oldPath, newPath := path.Join(h.MBoxPath, oldRel), path.Join(h.MBoxPath, newRel)
+		if err := os.Rename(oldPath, newPath); err != nil {
+			return fmt.Errorf("Unable to move %s to %s: %w", oldPath, newPath, err)
+		}
+		return nil
+	}, oldRel, newRel)
 }
 
+// SetDeferred records that the remote deferred the message identified by MID.
+//
+// Errors are logged. See SetDeferredErr.
 func (h *DirHandler) SetDeferred(MID string) {
+	if err := h.SetDeferredErr(MID); err != nil {
+		log.Println(err)
+	}
+}
+
+// SetDeferredErr is like SetDeferred, but returns any error.
+//
+// It implements fbb.OutboundErrHandler.
+//
+// The deferral is persisted, and the message will not be offered again
+// until the backoff given by h.Retry has elapsed.
+func (h *DirHandler) SetDeferredErr(MID string) error {
 	h.deferred[MID] = true
+	if err := h.recordAnswer(MID, AnswerDeferred); err != nil {
+		return fmt.Errorf("Unable to record deferral of %s: %w", MID, err)
+	}
+	return nil
 }
 
+// GetOutbound returns the outbound messages ready for delivery.
+//
+// Messages are held back until their HEADER_X_NOT_BEFORE time and the
+// backoff after the last deferral (see RetryPolicy) has elapsed. Expired messages
+// are moved to the failed folder.
 func (h *DirHandler) GetOutbound(fws ...fbb.Address) []*fbb.Message {
-	all, err := LoadMessageDir(path.Join(h.MBoxPath, DIR_OUTBOX))
+	now := time.Now()
+	if len(h.Recurring) > 0 {
+		if _, err := h.RunRecurring(now, h.Recurring...); err != nil {
+			log.Println(err)
+		}
+	}
+
+	all, err := h.loadDir(DIR_OUTBOX)
 	if err != nil {
 		log.Println(err)
 	}
 
-	deliver := make([]*fbb.Message, 0, len(all))
-	for _, m := range all {
-		if h.deferred[m.MID()] {
-			continue
-		}
-
-		// Check unsent messages that are addressed to one of the
-		// forwarder addresses of the remote.
-		if len(fws) > 0 {
-			for _, fw := range fws {
-				if m.IsOnlyReceiver(fw) {
-					deliver = append(deliver, m)
-					break
-				}
-			}
-			continue
-		}
+	return selectOutbound(h, h.Retry, all, now, fws)
+}
 
-		if len(fws) == 0 && m.Header.Get("X-P2POnly") == "true" {
-			continue // The message is P2POnly and remote is CMS
+func isOnlyReceiverOf(m *fbb.Message, fws []fbb.Address) bool {
+	for _, fw := range fws {
+		if m.IsOnlyReceiver(fw) {
+			return true
 		}
-
-		// Remove private headers
-		m.Header.Del("X-P2POnly")
-		m.Header.Del("X-FilePath")
-		m.Header.Del("X-Unread")
-
-		deliver = append(deliver, m)
 	}
-	return deliver
+	return false
 }
 
 // Deprecated: implementers should choose their own directories
@@ -197,6 +401,10 @@ func ensureDirStructure(mboxPath string) (err error) {
 		return
 	} else if err = os.MkdirAll(path.Join(mboxPath, DIR_ARCHIVE), mode); err != nil {
 		return
+	} else if err = os.MkdirAll(path.Join(mboxPath, DIR_FAILED), mode); err != nil {
+		return
+	} else if err = os.MkdirAll(path.Join(mboxPath, DIR_TRASH), mode); err != nil {
+		return
 	}
 	return
 }
@@ -211,10 +419,33 @@ func countFiles(dirPath string) int {
 		return -1
 	}
 
-	return len(files)
+	var n int
+	for _, file := range files {
+		if isMessageFile(file) {
+			n++
+		}
+	}
+	return n
 }
 
+func isMessageFile(file os.FileInfo) bool {
+	switch {
+	case file.IsDir(), file.Name()[0] == '.':
+		return false
+	default:
+		return strings.EqualFold(filepath.Ext(file.Name()), Ext)
+	}
+}
+
+// LoadMessageDir loads all messages found in dirPath.
+//
+// Unreadable message files are logged and skipped, so that a single corrupt
+// file does not prevent the rest of the folder from being loaded.
 func LoadMessageDir(dirPath string) ([]*fbb.Message, error) {
+	return loadMessageDir(dirPath, func(_ string, err error) { log.Println(err) })
+}
+
+func loadMessageDir(dirPath string, onError func(filePath string, err error)) ([]*fbb.Message, error) {
 	files, err := ioutil.ReadDir(dirPath)
 	if err != nil {
 		return nil, fmt.Errorf("Unable to read dir (%s): %s", dirPath, err)
@@ -223,17 +454,15 @@ func LoadMessageDir(dirPath string) ([]*fbb.Message, error) {
 	msgs := make([]*fbb.Message, 0, len(files))
 
 	for _, file := range files {
-		if file.IsDir() || file.Name()[0] == '.' {
+		if !isMessageFile(file) {
 			continue
 		}
 
-		if !strings.EqualFold(filepath.Ext(file.Name()), Ext) {
-			continue
-		}
-
-		msg, err := OpenMessage(path.Join(dirPath, file.Name()))
+		filePath := path.Join(dirPath, file.Name())
+		msg, err := OpenMessage(filePath)
 		if err != nil {
-			return nil, err
+			onError(filePath, err)
+			continue
 		}
 
 		msgs = append(msgs, msg)
@@ -242,6 +471,8 @@ func LoadMessageDir(dirPath string) ([]*fbb.Message, error) {
 }
 
 // OpenMessage opens a single a fbb.Message file.
+//
+// The returned error wraps ErrInvalidMessage if the file can not be parsed.
 func OpenMessage(path string) (*fbb.Message, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -252,7 +483,7 @@ func OpenMessage(path string) (*fbb.Message, error) {
 	message := new(fbb.Message)
 	if err := message.ReadFrom(f); err != nil {
 		f.Close()
-		return nil, fmt.Errorf("Unable to parse message (%s): %s", path, err)
+		return nil, fmt.Errorf("Unable to parse message (%s): %w: %s", path, ErrInvalidMessage, err)
 	}
 
 	message.Header.Set("X-FilePath", path)
@@ -263,6 +494,8 @@ func OpenMessage(path string) (*fbb.Message, error) {
 func IsUnread(msg *fbb.Message) bool { return msg.Header.Get("X-Unread") == "true" }
 
 // SetUnread marks the given message as read/unread and re-writes the file to disk.
+//
+// DirHandler.MarkRead should be preferred, as it does not modify the message file.
 func SetUnread(msg *fbb.Message, unread bool) error {
 	if !unread && msg.Header.Get("X-Unread") == "" {
 		return nil
@@ -283,5 +516,13 @@ func SetUnread(msg *fbb.Message, unread bool) error {
 	if filePath == "" {
 		return fmt.Errorf("Missing X-FilePath header")
 	}
-	return ioutil.WriteFile(filePath, data, 0644)
+
+	// The message file is located in a folder directly below the mailbox root.
+	unlock, err := lockMailbox(filepath.Dir(filepath.Dir(filePath)))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return writeFileAtomic(filePath, data, 0644)
 }
@@ -0,0 +1,103 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/pnousiai/wl2k-go/fbb"
+)
+
+func newTestDirHandler(t *testing.T) *DirHandler {
+	h := NewDirHandler(t.TempDir(), false)
+	if err := h.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func newTestMessage(from string, to ...string) *fbb.Message {
+	msg := fbb.NewMessage(fbb.Private, from)
+	msg.AddTo(to...)
+	msg.SetSubject("Test message")
+	msg.SetBody("Hello world")
+	return msg
+}
+
+func TestLoadMessageDirQuarantinesCorruptFiles(t *testing.T) {
+	h := newTestDirHandler(t)
+	if err := h.ProcessInbound(newTestMessage("N0CALL", "LA5NTA")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A truncated message file, e.g. after a crash
+	corrupt := path.Join(h.MBoxPath, DIR_INBOX, "TRUNCATED.b2f")
+	if err := ioutil.WriteFile(corrupt, []byte("Mid: TRUNCATED\r\nBody: 100\r\n\r\nHel"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := h.Inbox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Errorf("Expected 1 message, got %d", len(msgs))
+	}
+	if _, err := os.Stat(path.Join(h.MBoxPath, DIR_QUARANTINE, "TRUNCATED.b2f")); err != nil {
+		t.Errorf("Corrupt file not quarantined: %s", err)
+	}
+	if n := h.InboxCount(); n != 1 {
+		t.Errorf("Expected inbox count 1, got %d", n)
+	}
+}
+
+func TestLoadMessageDirKeepsUnopenableFiles(t *testing.T) {
+	h := newTestDirHandler(t)
+
+	// Open fails (as it would with e.g. too many open files), but the file is not corrupt
+	name := path.Join(h.MBoxPath, DIR_INBOX, "UNOPENABLE.b2f")
+	if err := os.Symlink(path.Join(h.MBoxPath, "missing"), name); err != nil {
+		t.Skip(err)
+	}
+	if _, err := h.Inbox(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(name); err != nil {
+		t.Errorf("File moved after open error: %s", err)
+	}
+	if _, err := os.Lstat(path.Join(h.MBoxPath, DIR_QUARANTINE, "UNOPENABLE.b2f")); !os.IsNotExist(err) {
+		t.Errorf("File quarantined after open error")
+	}
+}
+
+func TestConcurrentAddOut(t *testing.T) {
+	h := newTestDirHandler(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := h.AddOut(newTestMessage("LA5NTA", "N0CALL")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := h.OutboxCount(); n != 20 {
+		t.Errorf("Expected 20 messages in outbox, got %d", n)
+	}
+	files, _ := ioutil.ReadDir(path.Join(h.MBoxPath, DIR_OUTBOX))
+	for _, f := range files {
+		if !isMessageFile(f) {
+			t.Errorf("Unexpected file left in outbox: %s", f.Name())
+		}
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType is the type of a mailbox change Event.
+type EventType int
+
+const (
+	EventAdded        EventType = iota // A message was added to a folder.
+	EventRemoved                       // A message was removed from a folder.
+	EventMoved                         // A message was moved from one folder to another.
+	EventFlagsChanged                  // The flags of a message changed.
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventAdded:
+		return "added"
+	case EventRemoved:
+		return "removed"
+	case EventMoved:
+		return "moved"
+	case EventFlagsChanged:
+		return "flags changed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a change in the mailbox.
+type Event struct {
+	Type   EventType
+	MID    string
+	Folder string // The folder of the message. For EventMoved, the destination folder.
+	From   string // For EventMoved, the source folder.
+	Flags  Flags  // For EventFlagsChanged, the new flags.
+}
+
+// Watcher delivers mailbox change events. See DirHandler.Watch.
+type Watcher struct {
+	// Events delivers the changes in order. It's closed by Close.
+	Events <-chan Event
+
+	h      *DirHandler
+	events chan Event
+
+	queueMu sync.Mutex
+	queue   []Event
+	wake    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	scanMu   sync.Mutex
+	folders  map[string]*folderState
+	flags    flagStore
+	flagsMod time.Time
+}
+
+type folderState struct {
+	modTime time.Time
+	mids    map[string]bool
+}
+
+// Watch returns a Watcher delivering the changes of this mailbox.
+//
+// Changes made through the handler (including those made during a session)
+// are delivered immediately. Changes made by others (e.g. other processes)
+// are detected by polling the mailbox directories every interval. Only
+// directories with a new modification time are re-read. If interval is
+// zero, only changes made through this handler are delivered.
+//
+// The Watcher must be closed when no longer used.
+func (h *DirHandler) Watch(interval time.Duration) (*Watcher, error) {
+	events := make(chan Event)
+	w := &Watcher{
+		Events:  events,
+		h:       h,
+		events:  events,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		folders: make(map[string]*folderState),
+	}
+
+	// Initial state (no events)
+	if err := w.scan(nil, true, false); err != nil {
+		return nil, err
+	}
+
+	h.watchMu.Lock()
+	h.watchers = append(h.watchers, w)
+	h.watchMu.Unlock()
+
+	go w.deliver()
+	if interval > 0 {
+		go w.poll(interval)
+	}
+	return w, nil
+}
+
+// Close stops the watcher and closes the Events channel.
+func (w *Watcher) Close() error {
+	w.once.Do(func() {
+		w.h.watchMu.Lock()
+		for i, other := range w.h.watchers {
+			if other == w {
+				w.h.watchers = append(w.h.watchers[:i], w.h.watchers[i+1:]...)
+				break
+			}
+		}
+		w.h.watchMu.Unlock()
+		close(w.done)
+	})
+	return nil
+}
+
+// notifyWatchers re-scans the folders of the given message files (relative to the mailbox root) for all watchers.
+func (h *DirHandler) notifyWatchers(relPaths ...string) {
+	h.watchMu.Lock()
+	watchers := append([]*Watcher(nil), h.watchers...)
+	h.watchMu.Unlock()
+	if len(watchers) == 0 {
+		return
+	}
+
+	folders := make([]string, 0, len(relPaths))
+	seen := make(map[string]bool)
+	for _, p := range relPaths {
+		folder, _ := path.Split(path.Clean("/" + p))
+		if folder = normFolder(folder); !seen[folder] {
+			seen[folder] = true
+			folders = append(folders, folder)
+		}
+	}
+	for _, w := range watchers {
+		if err := w.scan(folders, true, true); err != nil {
+			log.Printf("Unable to scan mailbox for changes: %s", err)
+		}
+	}
+}
+
+func (w *Watcher) poll(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			if err := w.scan(nil, false, true); err != nil {
+				log.Printf("Unable to scan mailbox for changes: %s", err)
+			}
+		}
+	}
+}
+
+// deliver forwards queued events to the Events channel, so that a slow consumer never blocks the handler.
+func (w *Watcher) deliver() {
+	defer close(w.events)
+	for {
+		w.queueMu.Lock()
+		queue := w.queue
+		w.queue = nil
+		w.queueMu.Unlock()
+
+		for _, e := range queue {
+			select {
+			case w.events <- e:
+			case <-w.done:
+				return
+			}
+		}
+
+		select {
+		case <-w.wake:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *Watcher) emit(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+	w.queueMu.Lock()
+	w.queue = append(w.queue, events...)
+	w.queueMu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// modified reports whether a directory or file with the given modification time should be re-read.
+//
+// Recently modified entries are always re-read, as the modification time
+// resolution of some file systems is too coarse to detect all changes.
+func modified(prev, cur time.Time) bool {
+	return !prev.Equal(cur) || time.Since(cur) < 2*time.Second
+}
+
+// scan compares the given folders (or all folders if nil) and the flags with the
+// last known state, and emits the differences if emit is true.
+func (w *Watcher) scan(folders []string, force, emit bool) error {
+	w.scanMu.Lock()
+	defer w.scanMu.Unlock()
+
+	root := w.h.MBoxPath
+	if folders == nil {
+		all, err := listFolders(root)
+		if err != nil {
+			return err
+		}
+		// Deleted folders
+		present := make(map[string]bool, len(all))
+		for _, f := range all {
+			present[f] = true
+		}
+		for f := range w.folders {
+			if !present[f] {
+				all = append(all, f)
+			}
+		}
+		folders = all
+	}
+
+	added := make(map[string][]string) // MID -> folders
+	removed := make(map[string][]string)
+	for _, folder := range folders {
+		prev := w.folders[folder]
+		fi, err := os.Stat(path.Join(root, folder))
+		if err != nil || !fi.IsDir() {
+			if prev != nil {
+				for MID := range prev.mids {
+					removed[MID] = append(removed[MID], folder)
+				}
+				delete(w.folders, folder)
+			}
+			continue
+		}
+		if prev != nil && !force && !modified(prev.modTime, fi.ModTime()) {
+			continue
+		}
+
+		infos, err := ioutil.ReadDir(path.Join(root, folder))
+		if err != nil {
+			return err
+		}
+		cur := &folderState{modTime: fi.ModTime(), mids: make(map[string]bool, len(infos))}
+		for _, info := range infos {
+			if isMessageFile(info) {
+				cur.mids[strings.TrimSuffix(info.Name(), Ext)] = true
+			}
+		}
+		if prev == nil {
+			prev = &folderState{}
+		}
+		for MID := range cur.mids {
+			if !prev.mids[MID] {
+				added[MID] = append(added[MID], folder)
+			}
+		}
+		for MID := range prev.mids {
+			if !cur.mids[MID] {
+				removed[MID] = append(removed[MID], folder)
+			}
+		}
+		w.folders[folder] = cur
+	}
+
+	flagEvents, err := w.scanFlags(force)
+	if err != nil {
+		return err
+	}
+	if !emit {
+		return nil
+	}
+
+	var events []Event
+	for _, MID := range sortedKeys(removed) {
+		from := removed[MID]
+		to := added[MID]
+		for len(from) > 0 && len(to) > 0 {
+			events = append(events, Event{Type: EventMoved, MID: MID, From: from[0], Folder: to[0]})
+			from, to = from[1:], to[1:]
+		}
+		for _, folder := range from {
+			events = append(events, Event{Type: EventRemoved, MID: MID, Folder: folder})
+		}
+		added[MID] = to
+	}
+	for _, MID := range sortedKeys(added) {
+		for _, folder := range added[MID] {
+			events = append(events, Event{Type: EventAdded, MID: MID, Folder: folder})
+		}
+	}
+	w.emit(append(events, flagEvents...))
+	return nil
+}
+
+// scanFlags returns events for the flags that changed since the last scan. The caller must hold w.scanMu.
+func (w *Watcher) scanFlags(force bool) ([]Event, error) {
+	root := w.h.MBoxPath
+	var modTime time.Time
+	if fi, err := os.Stat(flagsPath(root)); err == nil {
+		modTime = fi.ModTime()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if w.flags != nil && !force && !modified(w.flagsMod, modTime) {
+		return nil, nil
+	}
+
+	store, err := readFlags(root)
+	if err != nil {
+		return nil, err
+	}
+	prev := w.flags
+	w.flags, w.flagsMod = store, modTime
+	if prev == nil {
+		return nil, nil
+	}
+
+	MIDs := make([]string, 0, len(store))
+	for MID := range store {
+		MIDs = append(MIDs, MID)
+	}
+	sort.Strings(MIDs)
+
+	var events []Event
+	for _, MID := range MIDs {
+		r := store[MID]
+		folders := w.locate(MID)
+		if len(folders) == 0 {
+			continue
+		}
+		old, ok := prev[MID]
+		if !ok {
+			// The previous flags were given by the message header
+			msg, err := OpenMessage(path.Join(root, folders[0], MID+Ext))
+			if err != nil {
+				continue
+			}
+			old.Flags = prev.flags(msg)
+		}
+		if old.Flags == r.Flags {
+			continue
+		}
+		for _, folder := range folders {
+			events = append(events, Event{Type: EventFlagsChanged, MID: MID, Folder: folder, Flags: r.Flags})
+		}
+	}
+	return events, nil
+}
+
+// locate returns the folders containing MID according to the last scan. The caller must hold w.scanMu.
+func (w *Watcher) locate(MID string) []string {
+	var folders []string
+	for folder, state := range w.folders {
+		if state.mids[MID] {
+			folders = append(folders, folder)
+		}
+	}
+	sort.Strings(folders)
+	return folders
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
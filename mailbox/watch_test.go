@@ -0,0 +1,88 @@
+// Copyright 2026 Martin Hebnes Pedersen (LA5NTA). All rights reserved.
+// Use of this source code is governed by the MIT-license that can be
+// found in the LICENSE file.
+
+package mailbox
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func nextEvent(t *testing.T, w *Watcher) Event {
+	t.Helper()
+	select {
+	case e := <-w.Events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for event")
+		return Event{}
+	}
+}
+
+func TestWatchHandlerChanges(t *testing.T) {
+	h := newTestDirHandler(t)
+	w, err := h.Watch(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	msg := newTestMessage("N0CALL", "LA5NTA")
+	if err := h.ProcessInbound(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.MarkRead(msg.MID(), true); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Move(msg.MID(), DIR_INBOX, DIR_ARCHIVE); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Delete(msg.MID(), DIR_ARCHIVE); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []Event{
+		{Type: EventAdded, MID: msg.MID(), Folder: DIR_INBOX},
+		{Type: EventFlagsChanged, MID: msg.MID(), Folder: DIR_INBOX, Flags: FlagRead},
+		{Type: EventMoved, MID: msg.MID(), From: DIR_INBOX, Folder: DIR_ARCHIVE},
+		{Type: EventRemoved, MID: msg.MID(), Folder: DIR_ARCHIVE},
+	}
+	for _, want := range expect {
+		if got := nextEvent(t, w); got != want {
+			t.Errorf("Expected %+v, got %+v", want, got)
+		}
+	}
+}
+
+func TestWatchExternalChanges(t *testing.T) {
+	h := newTestDirHandler(t)
+	w, err := h.Watch(10 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// Another process adds a message to the outbox
+	other := NewDirHandler(h.MBoxPath, false)
+	msg := newTestMessage("LA5NTA", "N0CALL")
+	if err := other.AddOut(msg); err != nil {
+		t.Fatal(err)
+	}
+	if e := nextEvent(t, w); e.Type != EventAdded || e.MID != msg.MID() || e.Folder != DIR_OUTBOX {
+		t.Errorf("Unexpected event: %+v", e)
+	}
+
+	if err := os.Remove(path.Join(h.MBoxPath, DIR_OUTBOX, msg.MID()+Ext)); err != nil {
+		t.Fatal(err)
+	}
+	if e := nextEvent(t, w); e.Type != EventRemoved || e.MID != msg.MID() {
+		t.Errorf("Unexpected event: %+v", e)
+	}
+
+	w.Close()
+	for range w.Events {
+	}
+}
@@ -1,9 +1,12 @@
 package tests
 
 import (
+	"errors"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -118,6 +121,93 @@ func TestMultiBlockAllDeferred(t *testing.T) {
 	}
 }
 
+func TestSetSentFailure(t *testing.T) {
+	alice, _ := NewTempStation("N0DE1")
+	defer alice.Cleanup()
+
+	bob, _ := NewTempStation("N0DE2")
+	defer bob.Cleanup()
+
+	for _, msg := range NewRandomMessages(3, alice.Callsign, bob.Callsign) {
+		alice.MBox.AddOut(msg)
+
+		// Block the destination path in alice's sent folder, so that SetSent fails.
+		if err := os.Mkdir(filepath.Join(alice.path, mailbox.DIR_SENT, msg.MID()+mailbox.Ext), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	addr, errs, err := alice.ListenTelnet()
+	if err != nil {
+		t.Fatalf("Unable to start listener: %s", err)
+	}
+
+	conn, err := telnet.Dial(addr, bob.Callsign, "")
+	if err != nil {
+		t.Fatalf("Unable to connect to listener: %s", err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(time.Minute))
+	s := fbb.NewSession(bob.Callsign, bob.Callsign, "", bob.MBox)
+	if _, err := s.Exchange(conn); err != nil {
+		t.Fatalf("Exchange failed at connecting node: %s", err)
+	}
+
+	select {
+	case err := <-errs:
+		var persistErr *fbb.PersistenceError
+		if !errors.As(err, &persistErr) {
+			t.Fatalf("Expected PersistenceError at listening node, got: %v", err)
+		}
+		if n := len(persistErr.Errors); n != 3 {
+			t.Errorf("Expected 3 persistence errors, got %d", n)
+		}
+	case <-time.After(time.Minute):
+		t.Fatalf("Test timeout!")
+	}
+
+	if n := bob.MBox.InboxCount(); n != 3 {
+		t.Errorf("Expected 3 messages in %s's inbox, got %d", bob.Callsign, n)
+	}
+}
+
+func TestExchangeInMemory(t *testing.T) {
+	alice, bob := mailbox.NewMemHandler(false), mailbox.NewMemHandler(false)
+
+	msgs := NewRandomMessages(3, "N0DE1", "N0DE2")
+	for _, msg := range msgs {
+		alice.AddOut(msg)
+	}
+	bob.AddOut(NewRandomMessage("N0DE2", "N0DE1"))
+
+	client, master := net.Pipe()
+	masterErr := make(chan error, 1)
+	go func() {
+		s := fbb.NewSession("N0DE1", "N0DE2", "", alice)
+		s.IsMaster(true)
+		_, err := s.Exchange(master)
+		masterErr <- err
+	}()
+
+	s := fbb.NewSession("N0DE2", "N0DE1", "", bob)
+	if _, err := s.Exchange(client); err != nil {
+		t.Fatalf("Exchange failed at connecting node: %s", err)
+	}
+	if err := <-masterErr; err != nil {
+		t.Fatalf("Exchange failed at listening node: %s", err)
+	}
+
+	if alice.OutboxCount() != 0 || alice.SentCount() != 3 || alice.InboxCount() != 1 {
+		t.Errorf("Unexpected state of N0DE1's mailbox: %d out, %d sent, %d in", alice.OutboxCount(), alice.SentCount(), alice.InboxCount())
+	}
+	for _, msg := range msgs {
+		if _, ok := bob.Get(mailbox.DIR_INBOX, msg.MID()); !ok {
+			t.Errorf("Message %s not received by N0DE2", msg.MID())
+		}
+	}
+}
+
 func NewRandomMessages(n int, from, to string) []*fbb.Message {
 	msgs := make([]*fbb.Message, n)
 	for i := 0; i < n; i++ {
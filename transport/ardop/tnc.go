@@ -17,6 +17,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pnousiai/wl2k-go/maidenhead"
 	"github.com/pnousiai/wl2k-go/transport"
 )
 
@@ -440,7 +441,12 @@ func (tnc *TNC) ARQTimeout() (time.Duration, error) {
 }
 
 // Sets the grid square
+//
+// The grid square must be a 4, 6 or 8 character Maidenhead locator (see package maidenhead).
 func (tnc *TNC) SetGridSquare(gs string) error {
+	if gs != "" && (len(gs) < 4 || len(gs) > 8 || !maidenhead.Valid(gs)) {
+		return fmt.Errorf("Invalid grid square %q: must be a 4, 6 or 8 character Maidenhead locator", gs)
+	}
 	return tnc.set(cmdGridSquare, gs)
 }
 